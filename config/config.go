@@ -2,12 +2,17 @@ package config
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-users-api/tracing"
 )
 
 // Config estructura para manejar la configuración de la aplicación
@@ -17,6 +22,69 @@ type Config struct {
 	Port          string
 	GinMode       string
 	LogLevel      string
+	LogFormat     string // text o json
+
+	// Autenticación JWT
+	JWTAlgorithm      string
+	JWTSecret         string
+	JWTPrivateKeyFile string
+	JWTPublicKeyFile  string
+	JWTIssuer         string
+	JWTAudience       string
+	AccessTokenTTL    time.Duration
+	RefreshTokenTTL   time.Duration
+
+	// Paginación
+	CursorSecret string
+	MaxPageLimit int64
+
+	// Papelera: los usuarios eliminados se purgan al superar la retención
+	TrashRetention     time.Duration
+	TrashPurgeInterval time.Duration
+
+	// BulkMaxItems es el número máximo de elementos en una petición masiva
+	BulkMaxItems int64
+
+	// Importación de usuarios: tamaño máximo del archivo (los mayores que ImportSyncMaxBytes
+	// requieren el modo asíncrono) y tiempo que se conservan los jobs y sus reportes
+	ImportMaxBytes     int64
+	ImportSyncMaxBytes int64
+	ImportRetention    time.Duration
+
+	// Métricas de Prometheus: con MetricsAddr se sirven en un puerto propio (ej. ":9090");
+	// sin él, en /metrics del puerto principal y solo si hay MetricsToken
+	MetricsAddr  string
+	MetricsToken string
+
+	// Trazas de OpenTelemetry: exportador ("none", "otlp" o "stdout"), URL del collector OTLP
+	// y archivo del exportador stdout (vacío escribe en la salida estándar)
+	TracingExporter string
+	TracingEndpoint string
+	TracingFile     string
+
+	// Sondas de salud: timeout de cada comprobación de dependencias y tiempo que el servidor
+	// sigue atendiendo peticiones tras marcarse como no listo, para que el balanceador deje de
+	// enviarle tráfico antes de cerrar las conexiones
+	HealthCheckTimeout time.Duration
+	ShutdownDelay      time.Duration
+
+	// Límite de peticiones: políticas por grupo de rutas (ver models.ParseRateLimitPolicies) y
+	// almacén de los buckets, "memory" (por réplica) o "mongo" (compartido entre réplicas)
+	RateLimits     string
+	RateLimitStore string
+
+	// IdempotencyTTL es el tiempo que se guarda la respuesta de una petición con Idempotency-Key
+	// e IdempotencySecret la clave con la que se cifra antes de guardarla
+	IdempotencyTTL    time.Duration
+	IdempotencySecret string
+
+	// TrustedProxies son las IPs o rangos CIDR de los proxies de los que se acepta
+	// X-Forwarded-For para obtener la IP del cliente; vacío no confía en ninguno
+	TrustedProxies []string
+
+	// EmailProviderRules aplica las reglas de cada proveedor (puntos y "+etiqueta" en Gmail)
+	// al calcular la forma canónica de los emails
+	EmailProviderRules bool
 }
 
 // NewConfig crea una nueva instancia de configuración
@@ -27,9 +95,57 @@ func NewConfig() *Config {
 		Port:          getEnv("PORT", "8080"),
 		GinMode:       getEnv("GIN_MODE", "debug"),
 		LogLevel:      getEnv("LOG_LEVEL", "debug"),
+		LogFormat:     getEnv("LOG_FORMAT", "text"),
+
+		JWTAlgorithm:      getEnv("JWT_ALGORITHM", "HS256"),
+		JWTSecret:         getEnv("JWT_SECRET", ""),
+		JWTPrivateKeyFile: getEnv("JWT_PRIVATE_KEY_FILE", ""),
+		JWTPublicKeyFile:  getEnv("JWT_PUBLIC_KEY_FILE", ""),
+		JWTIssuer:         getEnv("JWT_ISSUER", "go-users-api"),
+		JWTAudience:       getEnv("JWT_AUDIENCE", "go-users-api"),
+		AccessTokenTTL:    getEnvDuration("JWT_ACCESS_TTL", 15*time.Minute),
+		RefreshTokenTTL:   getEnvDuration("JWT_REFRESH_TTL", 7*24*time.Hour),
+
+		CursorSecret: getEnv("CURSOR_SECRET", ""),
+		MaxPageLimit: getEnvInt("MAX_PAGE_LIMIT", 100),
+
+		TrashRetention:     getEnvDuration("TRASH_RETENTION", 30*24*time.Hour),
+		TrashPurgeInterval: getEnvDuration("TRASH_PURGE_INTERVAL", time.Hour),
+		BulkMaxItems:       getEnvInt("BULK_MAX_ITEMS", 500),
+		ImportMaxBytes:     getEnvInt("IMPORT_MAX_BYTES", 50<<20),
+		ImportSyncMaxBytes: getEnvInt("IMPORT_SYNC_MAX_BYTES", 1<<20),
+		ImportRetention:    getEnvDuration("IMPORT_RETENTION", 7*24*time.Hour),
+		EmailProviderRules: getEnvBool("EMAIL_PROVIDER_RULES", false),
+		MetricsAddr:        getEnv("METRICS_ADDR", ""),
+		MetricsToken:       getEnv("METRICS_TOKEN", ""),
+		TracingExporter:    getEnv("TRACING_EXPORTER", "none"),
+		TracingEndpoint:    getEnv("TRACING_ENDPOINT", ""),
+		TracingFile:        getEnv("TRACING_FILE", ""),
+		HealthCheckTimeout: getEnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+		ShutdownDelay:      getEnvDuration("SHUTDOWN_DELAY", 0),
+		RateLimits:         getEnv("RATE_LIMITS", "auth=10/1m,ip=600/1m,users.read=300/1m,users.write=60/1m:20,imports=120/1m,audit=120/1m"),
+		RateLimitStore:     getEnv("RATE_LIMIT_STORE", "memory"),
+		TrustedProxies:     getEnvList("TRUSTED_PROXIES"),
+		IdempotencyTTL:     getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		IdempotencySecret:  getEnv("IDEMPOTENCY_SECRET", ""),
 	}
 }
 
+// Validate comprueba los valores que no tienen un valor por defecto seguro. Fuera del modo debug
+// son obligatorios los secretos que todas las réplicas deben compartir.
+func (c *Config) Validate() error {
+	if c.GinMode == "debug" {
+		return nil
+	}
+	if c.CursorSecret == "" {
+		return errors.New("CURSOR_SECRET is required outside debug mode")
+	}
+	if c.IdempotencySecret == "" {
+		return errors.New("IDEMPOTENCY_SECRET is required outside debug mode")
+	}
+	return nil
+}
+
 // getEnv obtiene una variable de entorno o retorna un valor por defecto
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -38,12 +154,57 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvDuration obtiene una duración (ej. "15m") de una variable de entorno o retorna un valor por defecto
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+		slog.Warn("Invalid duration, using default", "key", key, "value", value, "default", defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvInt obtiene un entero positivo de una variable de entorno o retorna un valor por defecto
+func getEnvInt(key string, defaultValue int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		if number, err := strconv.ParseInt(value, 10, 64); err == nil && number > 0 {
+			return number
+		}
+		slog.Warn("Invalid integer, using default", "key", key, "value", value, "default", defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvBool obtiene un booleano ("true", "false", "1", "0"...) de una variable de entorno o retorna un valor por defecto
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+		slog.Warn("Invalid boolean, using default", "key", key, "value", value, "default", defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvList obtiene una lista separada por comas de una variable de entorno, o nil si no está definida
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // ConnectDB establece la conexión con MongoDB
 func ConnectDB(cfg *Config) (*mongo.Client, *mongo.Database, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	clientOptions := options.Client().ApplyURI(cfg.MongoURI)
+	// El monitor crea un span por cada comando enviado a MongoDB
+	clientOptions := options.Client().ApplyURI(cfg.MongoURI).SetMonitor(tracing.MongoMonitor())
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
 		return nil, nil, err
@@ -55,6 +216,6 @@ func ConnectDB(cfg *Config) (*mongo.Client, *mongo.Database, error) {
 		return nil, nil, err
 	}
 
-	log.Println("Connected to MongoDB successfully")
+	slog.Info("Connected to MongoDB successfully", "database", cfg.MongoDatabase)
 	return client, client.Database(cfg.MongoDatabase), nil
 }
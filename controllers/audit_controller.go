@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"go-users-api/middleware"
+	"go-users-api/models"
+	"go-users-api/services"
+)
+
+// AuditController maneja las peticiones HTTP del registro de auditoría
+type AuditController struct {
+	auditService services.AuditServiceInterface
+}
+
+// NewAuditController crea una nueva instancia del controlador de auditoría
+func NewAuditController(auditService services.AuditServiceInterface) *AuditController {
+	return &AuditController{
+		auditService: auditService,
+	}
+}
+
+// GetUserHistory godoc
+// @Summary Historial de cambios de un usuario
+// @Description Obtiene los cambios registrados sobre un usuario, del más reciente al más antiguo. Los datos personales se muestran enmascarados
+// @Tags audit
+// @Accept json
+// @Produce json
+// @Param id path string true "ID del usuario (ObjectID o UUID)"
+// @Param page query int false "Número de página (default: 1)"
+// @Param limit query int false "Límite de elementos por página (default: 10)"
+// @Param action query string false "Tipo de cambio" Enums(user.created, user.updated, user.deleted, user.restored)
+// @Param actor_id query string false "ID del usuario que realizó el cambio"
+// @Param from query string false "Fecha mínima del cambio (RFC 3339)"
+// @Param to query string false "Fecha máxima del cambio (RFC 3339)"
+// @Success 200 {object} models.AuditEventsResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /users/{id}/history [get]
+func (c *AuditController) GetUserHistory(ctx *gin.Context) {
+	var query models.AuditQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		middleware.RespondWithError(ctx, middleware.BindingError(err))
+		return
+	}
+
+	history, err := c.auditService.GetUserHistory(ctx.Request.Context(), ctx.Param("id"), query)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, history)
+}
+
+// GetAuditEvents godoc
+// @Summary Consultar el registro de auditoría
+// @Description Obtiene los cambios registrados sobre todos los usuarios, filtrados por actor, tipo de cambio y rango de fechas
+// @Tags audit
+// @Accept json
+// @Produce json
+// @Param page query int false "Número de página (default: 1)"
+// @Param limit query int false "Límite de elementos por página (default: 10)"
+// @Param action query string false "Tipo de cambio" Enums(user.created, user.updated, user.deleted, user.restored)
+// @Param actor_id query string false "ID del usuario que realizó el cambio"
+// @Param from query string false "Fecha mínima del cambio (RFC 3339)"
+// @Param to query string false "Fecha máxima del cambio (RFC 3339)"
+// @Success 200 {object} models.AuditEventsResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /audit [get]
+func (c *AuditController) GetAuditEvents(ctx *gin.Context) {
+	var query models.AuditQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		middleware.RespondWithError(ctx, middleware.BindingError(err))
+		return
+	}
+
+	events, err := c.auditService.QueryEvents(ctx.Request.Context(), query)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, events)
+}
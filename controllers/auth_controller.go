@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"go-users-api/middleware"
+	"go-users-api/models"
+	"go-users-api/services"
+)
+
+// AuthController maneja las peticiones HTTP de autenticación
+type AuthController struct {
+	authService services.AuthServiceInterface
+}
+
+// NewAuthController crea una nueva instancia del controlador de autenticación
+func NewAuthController(authService services.AuthServiceInterface) *AuthController {
+	return &AuthController{
+		authService: authService,
+	}
+}
+
+// Login godoc
+// @Summary Iniciar sesión
+// @Description Verifica email y contraseña y retorna un token de acceso y uno de refresco
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body models.LoginRequest true "Credenciales del usuario"
+// @Success 200 {object} models.TokenResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/login [post]
+func (c *AuthController) Login(ctx *gin.Context) {
+	var req models.LoginRequest
+
+	// Validar datos de entrada
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		middleware.RespondWithError(ctx, middleware.BindingError(err))
+		return
+	}
+
+	// Autenticar y emitir tokens
+	tokens, err := c.authService.Login(ctx.Request.Context(), req)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// Refresh godoc
+// @Summary Renovar tokens
+// @Description Rota el token de refresco y emite un nuevo par de tokens. Reutilizar un token ya rotado revoca toda la sesión.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body models.RefreshTokenRequest true "Token de refresco"
+// @Success 200 {object} models.TokenResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/refresh [post]
+func (c *AuthController) Refresh(ctx *gin.Context) {
+	var req models.RefreshTokenRequest
+
+	// Validar datos de entrada
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		middleware.RespondWithError(ctx, middleware.BindingError(err))
+		return
+	}
+
+	// Rotar token de refresco
+	tokens, err := c.authService.Refresh(ctx.Request.Context(), req.RefreshToken)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// Logout godoc
+// @Summary Cerrar sesión
+// @Description Revoca la sesión asociada al token de refresco
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body models.RefreshTokenRequest true "Token de refresco"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/logout [post]
+func (c *AuthController) Logout(ctx *gin.Context) {
+	var req models.RefreshTokenRequest
+
+	// Validar datos de entrada
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		middleware.RespondWithError(ctx, middleware.BindingError(err))
+		return
+	}
+
+	// Revocar sesión
+	if err := c.authService.Logout(ctx.Request.Context(), req.RefreshToken); err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Logged out successfully",
+	})
+}
+
+// LogoutAll godoc
+// @Summary Cerrar todas las sesiones
+// @Description Revoca todas las sesiones (tokens de refresco) del usuario autenticado
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.SuccessResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /auth/logout-all [post]
+func (c *AuthController) LogoutAll(ctx *gin.Context) {
+	userID := ctx.GetString(middleware.ContextUserID)
+
+	// Revocar todas las sesiones del usuario
+	if err := c.authService.LogoutAll(ctx.Request.Context(), userID); err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "All sessions logged out successfully",
+	})
+}
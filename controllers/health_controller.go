@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-users-api/models"
+	"go-users-api/services"
+)
+
+// HealthController maneja las sondas de salud que usan Kubernetes y los balanceadores
+type HealthController struct {
+	healthService services.HealthServiceInterface
+}
+
+// NewHealthController crea una nueva instancia del controlador de salud
+func NewHealthController(healthService services.HealthServiceInterface) *HealthController {
+	return &HealthController{
+		healthService: healthService,
+	}
+}
+
+// Livez godoc
+// @Summary Sonda de liveness
+// @Description Indica que el proceso está en ejecución y atiende peticiones. No comprueba dependencias: un fallo de MongoDB no debe provocar el reinicio del pod
+// @Tags health
+// @Produce json
+// @Success 200 {object} models.HealthReport
+// @Router /livez [get]
+func (c *HealthController) Livez(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, models.HealthReport{Status: models.HealthUp, Time: time.Now().UTC()})
+}
+
+// Readyz godoc
+// @Summary Sonda de readiness
+// @Description Comprueba las dependencias (MongoDB) con un timeout corto e informa del estado y la latencia de cada una. Responde 503 mientras la API arranca, cuando una dependencia falla y desde que comienza el apagado
+// @Tags health
+// @Produce json
+// @Success 200 {object} models.HealthReport
+// @Failure 503 {object} models.HealthReport
+// @Router /readyz [get]
+func (c *HealthController) Readyz(ctx *gin.Context) {
+	report := c.healthService.Readiness(ctx.Request.Context())
+
+	status := http.StatusOK
+	if report.Status != models.HealthUp {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.JSON(status, report)
+}
+
+// Startupz godoc
+// @Summary Sonda de startup
+// @Description Responde 503 hasta que terminan las migraciones y la creación de índices, y 200 a partir de entonces
+// @Tags health
+// @Produce json
+// @Success 200 {object} models.HealthReport
+// @Failure 503 {object} models.HealthReport
+// @Router /startupz [get]
+func (c *HealthController) Startupz(ctx *gin.Context) {
+	if !c.healthService.Started() {
+		ctx.JSON(http.StatusServiceUnavailable, models.HealthReport{Status: models.HealthStarting, Time: time.Now().UTC()})
+		return
+	}
+	ctx.JSON(http.StatusOK, models.HealthReport{Status: models.HealthUp, Time: time.Now().UTC()})
+}
@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"go-users-api/middleware"
+	"go-users-api/models"
+	"go-users-api/services"
+)
+
+// multipartOverhead es el margen sobre el tamaño máximo del archivo para el resto del formulario multipart
+const multipartOverhead = 64 << 10
+
+// ImportController maneja las peticiones HTTP de importación de usuarios
+type ImportController struct {
+	importService services.ImportServiceInterface
+}
+
+// NewImportController crea una nueva instancia del controlador de importación
+func NewImportController(importService services.ImportServiceInterface) *ImportController {
+	return &ImportController{
+		importService: importService,
+	}
+}
+
+// ImportUsers godoc
+// @Summary Importar usuarios desde un archivo
+// @Description Crea usuarios a partir de un archivo CSV (con cabecera) o NDJSON, validando cada fila con las mismas reglas que el alta. Con dry_run=true solo informa los errores por número de línea. Con async=true el archivo se importa en segundo plano (obligatorio por encima de IMPORT_SYNC_MAX_BYTES) y se consulta en GET /imports/{id}
+// @Tags imports
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "Archivo CSV o NDJSON"
+// @Param format formData string false "Formato del archivo; por defecto se deduce de la extensión" Enums(csv, ndjson)
+// @Param dry_run formData bool false "Solo validar, sin crear usuarios"
+// @Param async formData bool false "Importar en segundo plano"
+// @Param mapping formData string false "Objeto JSON columna CSV -> campo (name, email, age, phone, address, password, roles)"
+// @Param delimiter formData string false "Separador de columnas CSV (default: ,)"
+// @Success 200 {object} models.ImportResult "Todas las filas se importaron"
+// @Success 207 {object} models.ImportResult "Alguna fila se rechazó"
+// @Success 202 {object} models.ImportJob "Importación asíncrona iniciada"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /users/import [post]
+func (c *ImportController) ImportUsers(ctx *gin.Context) {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, c.importService.MaxFileSize()+multipartOverhead)
+
+	var query models.ImportQuery
+	if err := ctx.ShouldBind(&query); err != nil {
+		middleware.RespondWithError(ctx, uploadError(err))
+		return
+	}
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			err = models.NewValidationError(models.FieldError{Field: "file", Message: "is required"})
+		}
+		middleware.RespondWithError(ctx, uploadError(err))
+		return
+	}
+
+	opts, err := importOptions(query, header)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+	// Las filas que asignan roles se rechazan si el usuario autenticado no puede gestionarlos
+	opts.AllowRoles = middleware.HasPermission(ctx, models.PermUsersManageRoles)
+
+	file, err := header.Open()
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+	defer file.Close()
+
+	if query.Async {
+		job, err := c.importService.StartImport(ctx.Request.Context(), file, header.Size, opts, validateRequest)
+		if err != nil {
+			middleware.RespondWithError(ctx, err)
+			return
+		}
+		ctx.Header("Location", "/api/v1/imports/"+job.ID.Hex())
+		ctx.JSON(http.StatusAccepted, job)
+		return
+	}
+
+	result, err := c.importService.ImportUsers(ctx.Request.Context(), file, header.Size, opts, validateRequest)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	status := http.StatusOK
+	if result.Rejected > 0 {
+		status = http.StatusMultiStatus
+	}
+	ctx.JSON(status, result)
+}
+
+// GetImportJob godoc
+// @Summary Consultar una importación asíncrona
+// @Description Obtiene el estado y el progreso de una importación. Solo puede consultarla quien la inició o un usuario con acceso a datos personales
+// @Tags imports
+// @Accept json
+// @Produce json
+// @Param id path string true "ID de la importación"
+// @Success 200 {object} models.ImportJob
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /imports/{id} [get]
+func (c *ImportController) GetImportJob(ctx *gin.Context) {
+	job, ok := c.findJob(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job)
+}
+
+// GetImportRejections godoc
+// @Summary Descargar las filas rechazadas de una importación
+// @Description Descarga el reporte de filas rechazadas en el formato del archivo importado: en CSV, las columnas originales precedidas de la línea y el error; en NDJSON, un objeto por fila. Mientras la importación está en curso contiene las filas procesadas hasta el momento
+// @Tags imports
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param id path string true "ID de la importación"
+// @Success 200 {file} file
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /imports/{id}/rejected [get]
+func (c *ImportController) GetImportRejections(ctx *gin.Context) {
+	job, ok := c.findJob(ctx)
+	if !ok {
+		return
+	}
+
+	contentType, extension := "text/csv; charset=utf-8", "csv"
+	if job.Format == models.ImportNDJSON {
+		contentType, extension = "application/x-ndjson", "ndjson"
+	}
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%s-rejected.%s"`, job.ID.Hex(), extension))
+	ctx.Status(http.StatusOK)
+
+	// El reporte se escribe a medida que se lee; si falla a mitad ya no se puede cambiar el código de estado
+	if err := c.importService.WriteRejections(ctx.Request.Context(), job, ctx.Writer); err != nil {
+		slog.ErrorContext(ctx.Request.Context(), "Error writing import rejections", "job_id", job.ID.Hex(), "error", err)
+	}
+}
+
+// findJob obtiene el job de la ruta y verifica que el usuario autenticado pueda verlo.
+// Un job ajeno se responde como inexistente para no revelar su existencia.
+func (c *ImportController) findJob(ctx *gin.Context) (*models.ImportJob, bool) {
+	job, err := c.importService.GetImportJob(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return nil, false
+	}
+
+	claims, _ := middleware.GetClaims(ctx)
+	if job.CreatedBy != claims.Subject && !middleware.HasPermission(ctx, models.PermUsersReadPII) {
+		middleware.RespondWithError(ctx, models.ErrImportNotFound)
+		return nil, false
+	}
+	return job, true
+}
+
+// importOptions valida los parámetros de la importación; el formato se deduce de la
+// extensión o del tipo del archivo si no se indica
+func importOptions(query models.ImportQuery, header *multipart.FileHeader) (models.ImportOptions, error) {
+	opts := models.ImportOptions{
+		Format:    models.ImportFormat(query.Format),
+		DryRun:    query.DryRun,
+		Delimiter: ',',
+		FileName:  header.Filename,
+	}
+
+	if opts.Format == "" {
+		contentType := header.Header.Get("Content-Type")
+		switch extension := strings.ToLower(filepath.Ext(header.Filename)); {
+		case extension == ".csv", strings.HasPrefix(contentType, "text/csv"):
+			opts.Format = models.ImportCSV
+		case extension == ".ndjson", extension == ".jsonl", strings.HasPrefix(contentType, "application/x-ndjson"):
+			opts.Format = models.ImportNDJSON
+		default:
+			return opts, models.NewValidationError(models.FieldError{Field: "format", Message: "cannot be detected from the file, use csv or ndjson"})
+		}
+	}
+
+	if query.Mapping != "" {
+		if err := json.Unmarshal([]byte(query.Mapping), &opts.Mapping); err != nil {
+			return opts, models.NewValidationError(models.FieldError{Field: "mapping", Message: "must be a JSON object of CSV column names to fields"})
+		}
+	}
+
+	if query.Delimiter != "" {
+		if utf8.RuneCountInString(query.Delimiter) != 1 {
+			return opts, models.NewValidationError(models.FieldError{Field: "delimiter", Message: "must be a single character"})
+		}
+		opts.Delimiter, _ = utf8.DecodeRuneInString(query.Delimiter)
+	}
+
+	return opts, nil
+}
+
+// uploadError traduce los errores al leer el formulario, incluido el límite de tamaño del cuerpo
+func uploadError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return fmt.Errorf("%w (max %d bytes)", models.ErrFileTooLarge, maxBytesErr.Limit-multipartOverhead)
+	}
+	if errors.Is(err, models.ErrValidation) {
+		return err
+	}
+	return middleware.BindingError(err)
+}
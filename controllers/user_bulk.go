@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"go-users-api/middleware"
+	"go-users-api/models"
+)
+
+// BulkCreateUsers godoc
+// @Summary Crear usuarios en bloque
+// @Description Crea varios usuarios en una sola petición (hasta BULK_MAX_ITEMS). Cada elemento tiene su propio resultado (created, conflict, invalid...); con atomic=true se crean todos o ninguno y con dry_run=true solo se valida
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body models.BulkCreateRequest true "Usuarios a crear"
+// @Param Idempotency-Key header string false "Clave única de la operación; los reintentos con la misma clave repiten la respuesta original"
+// @Success 200 {object} models.BulkResponse "Todos los elementos se aplicaron"
+// @Success 207 {object} models.BulkResponse "Algún elemento falló"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /users/bulk [post]
+func (c *UserController) BulkCreateUsers(ctx *gin.Context) {
+	var req models.BulkCreateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		middleware.RespondWithError(ctx, middleware.BindingError(err))
+		return
+	}
+
+	// Solo quien puede gestionar roles puede asignarlos
+	for _, item := range req.Users {
+		if len(item.Roles) > 0 && !c.canManageRoles(ctx) {
+			return
+		}
+	}
+
+	response, err := c.userService.BulkCreateUsers(ctx.Request.Context(), req, validateRequest)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	respondBulk(ctx, response)
+}
+
+// BulkUpdateUsers godoc
+// @Summary Modificar usuarios en bloque
+// @Description Aplica a cada usuario indicado un JSON Merge Patch (RFC 7396) con las mismas validaciones que PATCH. Cada elemento puede exigir una versión; con atomic=true se modifican todos o ninguno
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body models.BulkUpdateRequest true "Cambios por usuario"
+// @Param Idempotency-Key header string false "Clave única de la operación; los reintentos con la misma clave repiten la respuesta original"
+// @Success 200 {object} models.BulkResponse "Todos los elementos se aplicaron"
+// @Success 207 {object} models.BulkResponse "Algún elemento falló"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /users/bulk [patch]
+func (c *UserController) BulkUpdateUsers(ctx *gin.Context) {
+	var req models.BulkUpdateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		middleware.RespondWithError(ctx, middleware.BindingError(err))
+		return
+	}
+
+	// Solo quien puede gestionar roles puede modificarlos; los elementos que lo intenten sin
+	// permiso se informan como forbidden
+	allowRoles := middleware.HasPermission(ctx, models.PermUsersManageRoles)
+	response, err := c.userService.BulkUpdateUsers(ctx.Request.Context(), req, allowRoles, validateRequest)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	respondBulk(ctx, response)
+}
+
+// BulkDeleteUsers godoc
+// @Summary Eliminar usuarios en bloque
+// @Description Mueve a la papelera los usuarios indicados (ObjectID o UUID). Con atomic=true se eliminan todos o ninguno
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body models.BulkDeleteRequest true "IDs de los usuarios a eliminar"
+// @Param Idempotency-Key header string false "Clave única de la operación; los reintentos con la misma clave repiten la respuesta original"
+// @Success 200 {object} models.BulkResponse "Todos los elementos se aplicaron"
+// @Success 207 {object} models.BulkResponse "Algún elemento falló"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /users/bulk/delete [post]
+func (c *UserController) BulkDeleteUsers(ctx *gin.Context) {
+	var req models.BulkDeleteRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		middleware.RespondWithError(ctx, middleware.BindingError(err))
+		return
+	}
+
+	response, err := c.userService.BulkDeleteUsers(ctx.Request.Context(), req)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	respondBulk(ctx, response)
+}
+
+// respondBulk responde 200 si todos los elementos se aplicaron y 207 Multi-Status si alguno falló
+func respondBulk(ctx *gin.Context, response *models.BulkResponse) {
+	status := http.StatusOK
+	if response.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	ctx.JSON(status, response)
+}
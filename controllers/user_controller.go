@@ -1,10 +1,16 @@
 package controllers
 
 import (
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 
+	"go-users-api/middleware"
 	"go-users-api/models"
 	"go-users-api/services"
 )
@@ -28,97 +34,122 @@ func NewUserController(userService services.UserServiceInterface) *UserControlle
 // @Accept json
 // @Produce json
 // @Param user body models.CreateUserRequest true "Datos del usuario"
+// @Param Idempotency-Key header string false "Clave única de la operación; los reintentos con la misma clave repiten la respuesta original"
 // @Success 201 {object} models.SuccessResponse{data=models.UserResponse}
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
 // @Router /users [post]
 func (c *UserController) CreateUser(ctx *gin.Context) {
 	var req models.CreateUserRequest
 
 	// Validar datos de entrada
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "Validation Error",
-			Message: err.Error(),
-			Code:    http.StatusBadRequest,
-		})
+		middleware.RespondWithError(ctx, middleware.BindingError(err))
+		return
+	}
+
+	// Solo quien puede gestionar roles puede asignarlos
+	if len(req.Roles) > 0 && !c.canManageRoles(ctx) {
 		return
 	}
 
 	// Validar datos del usuario
 	if err := c.userService.ValidateUserData(req); err != nil {
-		ctx.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "Validation Error",
-			Message: err.Error(),
-			Code:    http.StatusBadRequest,
-		})
+		middleware.RespondWithError(ctx, err)
 		return
 	}
 
 	// Crear usuario
 	user, err := c.userService.CreateUser(ctx.Request.Context(), req)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "email already exists" {
-			status = http.StatusConflict
-		}
-
-		ctx.JSON(status, models.ErrorResponse{
-			Error:   "Error creating user",
-			Message: err.Error(),
-			Code:    status,
-		})
+		middleware.RespondWithError(ctx, err)
 		return
 	}
 
+	middleware.SetETag(ctx, user.Version)
 	ctx.JSON(http.StatusCreated, models.SuccessResponse{
 		Message: "User created successfully",
-		Data:    user.ToResponse(),
+		Data:    c.toResponse(ctx, user),
 	})
 }
 
 // GetUsers godoc
 // @Summary Obtener lista de usuarios
-// @Description Obtiene la lista paginada de todos los usuarios
+// @Description Obtiene la lista paginada de usuarios, con filtros, búsqueda y ordenamiento
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param page query int false "Número de página (default: 1)"
 // @Param limit query int false "Límite de elementos por página (default: 10)"
+// @Param name query string false "Nombre empieza por (sin distinguir mayúsculas)"
+// @Param email query string false "Email empieza por (sin distinguir mayúsculas; requiere users:read:pii)"
+// @Param min_age query int false "Edad mínima"
+// @Param max_age query int false "Edad máxima"
+// @Param created_from query string false "Creado desde (RFC 3339)"
+// @Param created_to query string false "Creado hasta (RFC 3339)"
+// @Param q query string false "Búsqueda de texto libre en nombre, email y dirección (requiere users:read:pii)"
+// @Param sort query string false "Campos de ordenamiento separados por coma, '-' para descendente (ej. name,-age); ordenar por email requiere users:read:pii"
+// @Param cursor query string false "Cursor opaco de next_cursor/prev_cursor; vacío para la primera página en modo cursor"
+// @Param include_total query bool false "Incluir el total de resultados (default: true)"
 // @Success 200 {object} models.UsersResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
 // @Router /users [get]
 func (c *UserController) GetUsers(ctx *gin.Context) {
-	// Obtener parámetros de paginación
-	page := ctx.DefaultQuery("page", "1")
-	limit := ctx.DefaultQuery("limit", "10")
+	// Obtener parámetros de paginación y filtros
+	var query models.UserListQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		middleware.RespondWithError(ctx, middleware.BindingError(err))
+		return
+	}
+	if !c.canQueryPII(ctx, query) {
+		return
+	}
 
 	// Obtener usuarios
-	users, err := c.userService.GetUsers(ctx.Request.Context(), page, limit)
+	users, err := c.userService.GetUsers(ctx.Request.Context(), query)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Error getting users",
-			Message: err.Error(),
-			Code:    http.StatusInternalServerError,
-		})
+		middleware.RespondWithError(ctx, err)
 		return
 	}
 
+	// Ocultar datos personales si el usuario no tiene permiso para verlos
+	if !middleware.HasPermission(ctx, models.PermUsersReadPII) {
+		for i := range users.Users {
+			users.Users[i] = users.Users[i].MaskPII()
+		}
+	}
+
 	ctx.JSON(http.StatusOK, users)
 }
 
 // GetUserByID godoc
 // @Summary Obtener usuario por ID
-// @Description Obtiene un usuario específico por su ID
+// @Description Obtiene un usuario específico por su ID (ObjectID o UUID)
 // @Tags users
 // @Accept json
 // @Produce json
-// @Param id path string true "ID del usuario"
+// @Param id path string true "ID del usuario (ObjectID o UUID)"
+// @Param If-None-Match header string false "ETag de la versión que ya tiene el cliente"
 // @Success 200 {object} models.SuccessResponse{data=models.UserResponse}
+// @Success 304 "El usuario no cambió"
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
 // @Router /users/{id} [get]
 func (c *UserController) GetUserByID(ctx *gin.Context) {
 	id := ctx.Param("id")
@@ -126,93 +157,218 @@ func (c *UserController) GetUserByID(ctx *gin.Context) {
 	// Obtener usuario
 	user, err := c.userService.GetUserByID(ctx.Request.Context(), id)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "user not found" {
-			status = http.StatusNotFound
-		} else if err.Error() == "invalid user ID" {
-			status = http.StatusBadRequest
-		}
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	c.respondWithUser(ctx, user)
+}
 
-		ctx.JSON(status, models.ErrorResponse{
-			Error:   "Error getting user",
-			Message: err.Error(),
-			Code:    status,
-		})
+// GetUserByUUID godoc
+// @Summary Obtener usuario por UUID
+// @Description Obtiene un usuario específico por su UUID público
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param uuid path string true "UUID del usuario"
+// @Param If-None-Match header string false "ETag de la versión que ya tiene el cliente"
+// @Success 200 {object} models.SuccessResponse{data=models.UserResponse}
+// @Success 304 "El usuario no cambió"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /users/by-uuid/{uuid} [get]
+func (c *UserController) GetUserByUUID(ctx *gin.Context) {
+	user, err := c.userService.GetUserByUUID(ctx.Request.Context(), ctx.Param("uuid"))
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
 		return
 	}
 
+	c.respondWithUser(ctx, user)
+}
+
+// GetUserByEmail godoc
+// @Summary Obtener usuario por email
+// @Description Obtiene el usuario activo con el email indicado (se compara la forma canónica del email)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param email query string true "Email del usuario"
+// @Param If-None-Match header string false "ETag de la versión que ya tiene el cliente"
+// @Success 200 {object} models.SuccessResponse{data=models.UserResponse}
+// @Success 304 "El usuario no cambió"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /users/by-email [get]
+func (c *UserController) GetUserByEmail(ctx *gin.Context) {
+	var query models.UserEmailQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		middleware.RespondWithError(ctx, middleware.BindingError(err))
+		return
+	}
+
+	user, err := c.userService.GetUserByEmail(ctx.Request.Context(), query.Email)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	c.respondWithUser(ctx, user)
+}
+
+// respondWithUser responde con el usuario y su ETag, o con 304 si el cliente ya tiene la versión actual
+func (c *UserController) respondWithUser(ctx *gin.Context, user *models.User) {
+	if middleware.NotModified(ctx, user.Version) {
+		return
+	}
+
+	middleware.SetETag(ctx, user.Version)
 	ctx.JSON(http.StatusOK, models.SuccessResponse{
 		Message: "User retrieved successfully",
-		Data:    user.ToResponse(),
+		Data:    c.toResponse(ctx, user),
 	})
 }
 
 // UpdateUser godoc
-// @Summary Actualizar usuario
-// @Description Actualiza los datos de un usuario existente
+// @Summary Reemplazar usuario
+// @Description Reemplaza todos los datos editables de un usuario existente; los campos opcionales omitidos se vacían
 // @Tags users
 // @Accept json
 // @Produce json
-// @Param id path string true "ID del usuario"
-// @Param user body models.UpdateUserRequest true "Datos actualizados del usuario"
+// @Param id path string true "ID del usuario (ObjectID o UUID)"
+// @Param If-Match header string false "ETag de la versión a modificar; si no es la actual se responde 412"
+// @Param user body models.ReplaceUserRequest true "Datos completos del usuario"
 // @Success 200 {object} models.SuccessResponse{data=models.UserResponse}
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Failure 409 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
 // @Router /users/{id} [put]
 func (c *UserController) UpdateUser(ctx *gin.Context) {
 	id := ctx.Param("id")
-	var req models.UpdateUserRequest
+	var req models.ReplaceUserRequest
 
 	// Validar datos de entrada
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "Validation Error",
-			Message: err.Error(),
-			Code:    http.StatusBadRequest,
-		})
+		middleware.RespondWithError(ctx, middleware.BindingError(err))
+		return
+	}
+
+	// Solo quien puede gestionar roles puede modificarlos; una lista vacía también los reemplaza
+	if req.Roles != nil && !c.canManageRoles(ctx) {
+		return
+	}
+
+	expectedVersion, err := middleware.IfMatchVersion(ctx)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
 		return
 	}
 
 	// Actualizar usuario
-	user, err := c.userService.UpdateUser(ctx.Request.Context(), id, req)
+	user, err := c.userService.ReplaceUser(ctx.Request.Context(), id, req, expectedVersion)
 	if err != nil {
-		status := http.StatusInternalServerError
-		switch err.Error() {
-		case "user not found":
-			status = http.StatusNotFound
-		case "invalid user ID":
-			status = http.StatusBadRequest
-		case "email already exists":
-			status = http.StatusConflict
-		}
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	middleware.SetETag(ctx, user.Version)
+	ctx.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "User updated successfully",
+		Data:    c.toResponse(ctx, user),
+	})
+}
+
+// PatchUser godoc
+// @Summary Modificar usuario parcialmente
+// @Description Aplica un JSON Merge Patch (RFC 7396) o un JSON Patch (RFC 6902) sobre los datos editables del usuario
+// @Tags users
+// @Accept application/merge-patch+json,application/json-patch+json
+// @Produce json
+// @Param id path string true "ID del usuario (ObjectID o UUID)"
+// @Param If-Match header string false "ETag de la versión a modificar; si no es la actual se responde 412"
+// @Param patch body object true "Documento de modificación"
+// @Param Idempotency-Key header string false "Clave única de la operación; los reintentos con la misma clave repiten la respuesta original"
+// @Success 200 {object} models.SuccessResponse{data=models.UserResponse}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /users/{id} [patch]
+func (c *UserController) PatchUser(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	body, err := ctx.GetRawData()
+	if err != nil {
+		middleware.RespondWithError(ctx, middleware.BindingError(err))
+		return
+	}
+
+	patch, err := models.NewUserPatch(ctx.ContentType(), body)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	expectedVersion, err := middleware.IfMatchVersion(ctx)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
 
-		ctx.JSON(status, models.ErrorResponse{
-			Error:   "Error updating user",
-			Message: err.Error(),
-			Code:    status,
-		})
+	// Modificar usuario; el resultado se valida igual que el cuerpo de un PUT y solo quien puede
+	// gestionar roles puede cambiarlos
+	allowRoles := middleware.HasPermission(ctx, models.PermUsersManageRoles)
+	user, err := c.userService.PatchUser(ctx.Request.Context(), id, patch, expectedVersion, allowRoles, validateRequest)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
 		return
 	}
 
+	middleware.SetETag(ctx, user.Version)
 	ctx.JSON(http.StatusOK, models.SuccessResponse{
 		Message: "User updated successfully",
-		Data:    user.ToResponse(),
+		Data:    c.toResponse(ctx, user),
 	})
 }
 
 // DeleteUser godoc
 // @Summary Eliminar usuario
-// @Description Elimina un usuario del sistema
+// @Description Mueve un usuario a la papelera; se elimina definitivamente tras el periodo de retención
 // @Tags users
 // @Accept json
 // @Produce json
-// @Param id path string true "ID del usuario"
+// @Param id path string true "ID del usuario (ObjectID o UUID)"
 // @Success 200 {object} models.SuccessResponse
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
 // @Router /users/{id} [delete]
 func (c *UserController) DeleteUser(ctx *gin.Context) {
 	id := ctx.Param("id")
@@ -220,22 +376,186 @@ func (c *UserController) DeleteUser(ctx *gin.Context) {
 	// Eliminar usuario
 	err := c.userService.DeleteUser(ctx.Request.Context(), id)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "user not found" {
-			status = http.StatusNotFound
-		} else if err.Error() == "invalid user ID" {
-			status = http.StatusBadRequest
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "User deleted successfully",
+	})
+}
+
+// GetDeletedUsers godoc
+// @Summary Listar la papelera
+// @Description Obtiene los usuarios eliminados que aún no se han purgado, con los mismos filtros y paginación que el listado
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param page query int false "Número de página (default: 1)"
+// @Param limit query int false "Límite de elementos por página (default: 10)"
+// @Param q query string false "Búsqueda de texto libre en nombre, email y dirección (requiere users:read:pii)"
+// @Param sort query string false "Campos de ordenamiento separados por coma, '-' para descendente (ej. name,-age); ordenar por email requiere users:read:pii"
+// @Success 200 {object} models.UsersResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /users/trash [get]
+func (c *UserController) GetDeletedUsers(ctx *gin.Context) {
+	var query models.UserListQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		middleware.RespondWithError(ctx, middleware.BindingError(err))
+		return
+	}
+	if !c.canQueryPII(ctx, query) {
+		return
+	}
+
+	users, err := c.userService.GetDeletedUsers(ctx.Request.Context(), query)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+
+	// Ocultar datos personales si el usuario no tiene permiso para verlos
+	if !middleware.HasPermission(ctx, models.PermUsersReadPII) {
+		for i := range users.Users {
+			users.Users[i] = users.Users[i].MaskPII()
 		}
+	}
 
-		ctx.JSON(status, models.ErrorResponse{
-			Error:   "Error deleting user",
-			Message: err.Error(),
-			Code:    status,
-		})
+	ctx.JSON(http.StatusOK, users)
+}
+
+// ExportUsers godoc
+// @Summary Exportar usuarios
+// @Description Descarga todos los usuarios que cumplen los filtros, sin paginar, en CSV, NDJSON o XLSX. El archivo se genera a medida que se leen los usuarios de la base de datos. Los datos personales se ocultan si el usuario no tiene el permiso users:read:pii
+// @Tags users
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param format query string false "Formato del archivo (default: csv)" Enums(csv, ndjson, xlsx)
+// @Param columns query string false "Columnas separadas por coma (default: todas): id, uuid, name, email, age, phone, address, roles, version, created_at, updated_at"
+// @Param name query string false "Filtrar por nombre (búsqueda parcial)"
+// @Param email query string false "Filtrar por email (búsqueda parcial; requiere users:read:pii)"
+// @Param min_age query int false "Edad mínima"
+// @Param max_age query int false "Edad máxima"
+// @Param created_from query string false "Creados desde (RFC3339)"
+// @Param created_to query string false "Creados hasta (RFC3339)"
+// @Param q query string false "Búsqueda de texto libre en nombre, email y dirección (requiere users:read:pii)"
+// @Param sort query string false "Campos de ordenamiento separados por coma, '-' para descendente (ej. name,-age); ordenar por email requiere users:read:pii"
+// @Success 200 {file} file
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /users/export [get]
+func (c *UserController) ExportUsers(ctx *gin.Context) {
+	var query models.UserExportQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		middleware.RespondWithError(ctx, middleware.BindingError(err))
+		return
+	}
+	if !c.canQueryPII(ctx, query.ListQuery()) {
+		return
+	}
+
+	export, err := c.userService.PrepareUserExport(ctx.Request.Context(), query)
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
+		return
+	}
+	export.MaskPII = !middleware.HasPermission(ctx, models.PermUsersReadPII)
+
+	filename := fmt.Sprintf("users-%s.%s", time.Now().UTC().Format("20060102T150405Z"), export.Format)
+	ctx.Header("Content-Type", export.Format.ContentType())
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	if err := c.userService.ExportUsers(ctx.Request.Context(), export, ctx.Writer); err != nil {
+		// Si aún no se ha enviado nada se responde el error; si no, el archivo queda truncado
+		if !ctx.Writer.Written() {
+			ctx.Writer.Header().Del("Content-Type")
+			ctx.Writer.Header().Del("Content-Disposition")
+			middleware.RespondWithError(ctx, err)
+			return
+		}
+		slog.ErrorContext(ctx.Request.Context(), "Error exporting users", "error", err)
+	}
+}
+
+// RestoreUser godoc
+// @Summary Restaurar usuario
+// @Description Saca un usuario de la papelera
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "ID del usuario (ObjectID o UUID)"
+// @Param Idempotency-Key header string false "Clave única de la operación; los reintentos con la misma clave repiten la respuesta original"
+// @Success 200 {object} models.SuccessResponse{data=models.UserResponse}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /users/{id}/restore [post]
+func (c *UserController) RestoreUser(ctx *gin.Context) {
+	user, err := c.userService.RestoreUser(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		middleware.RespondWithError(ctx, err)
 		return
 	}
 
+	middleware.SetETag(ctx, user.Version)
 	ctx.JSON(http.StatusOK, models.SuccessResponse{
-		Message: "User deleted successfully",
+		Message: "User restored successfully",
+		Data:    c.toResponse(ctx, user),
 	})
 }
+
+// validateRequest valida una petición con el validador de Gin y sus mensajes por campo
+func validateRequest(req any) error {
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		return middleware.BindingError(err)
+	}
+	return nil
+}
+
+// toResponse convierte el usuario a respuesta ocultando los datos personales si el usuario
+// autenticado no tiene el permiso users:read:pii
+func (c *UserController) toResponse(ctx *gin.Context, user *models.User) models.UserResponse {
+	response := user.ToResponse()
+	if !middleware.HasPermission(ctx, models.PermUsersReadPII) {
+		return response.MaskPII()
+	}
+	return response
+}
+
+// canQueryPII verifica que el usuario autenticado pueda filtrar u ordenar por datos personales
+// y responde 403 si no puede
+func (c *UserController) canQueryPII(ctx *gin.Context, query models.UserListQuery) bool {
+	params := query.PIIParams()
+	if len(params) == 0 || middleware.HasPermission(ctx, models.PermUsersReadPII) {
+		return true
+	}
+
+	middleware.RespondWithError(ctx, fmt.Errorf("%w to filter or sort by %s", models.ErrForbidden, strings.Join(params, ", ")))
+	return false
+}
+
+// canManageRoles verifica que el usuario autenticado pueda asignar roles y responde 403 si no puede
+func (c *UserController) canManageRoles(ctx *gin.Context) bool {
+	if middleware.HasPermission(ctx, models.PermUsersManageRoles) {
+		return true
+	}
+
+	middleware.RespondWithError(ctx, fmt.Errorf("%w to assign roles", models.ErrForbidden))
+	return false
+}
@@ -0,0 +1,134 @@
+// Package logging configura el logger estructurado (log/slog) de la aplicación: nivel y formato
+// desde la configuración, campos de la petición tomados del contexto y ocultación de datos personales.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"go-users-api/models"
+	"go-users-api/reqctx"
+)
+
+// Formatos de salida soportados
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// redacted reemplaza el valor de los atributos secretos
+const redacted = "[REDACTED]"
+
+// secretKeys son los atributos cuyo valor nunca se registra
+var secretKeys = map[string]bool{
+	"password":      true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"authorization": true,
+	"secret":        true,
+}
+
+// piiKeys son los atributos con datos personales y la función que los oculta
+var piiKeys = map[string]func(string) string{
+	"email":   models.MaskEmail,
+	"phone":   models.MaskPhone,
+	"address": models.MaskAddress,
+}
+
+// emailPattern encuentra emails dentro de textos libres, como mensajes o errores de MongoDB
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// New crea el logger con el nivel (debug, info, warn, error) y el formato (text, json) indicados.
+// Si alguno no es válido se usa el valor por defecto (info, text) y se retorna un error que lo explica.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var errs []string
+
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		logLevel = slog.LevelInfo
+		errs = append(errs, fmt.Sprintf("invalid LOG_LEVEL %q, using info", level))
+	}
+
+	opts := &slog.HandlerOptions{Level: logLevel, ReplaceAttr: redactAttr}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	case FormatText, "":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		handler = slog.NewTextHandler(w, opts)
+		errs = append(errs, fmt.Sprintf("invalid LOG_FORMAT %q, using text", format))
+	}
+
+	logger := slog.New(contextHandler{handler})
+	if len(errs) > 0 {
+		return logger, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return logger, nil
+}
+
+// redactAttr oculta los secretos y los datos personales antes de escribir cada atributo,
+// incluido el mensaje
+func redactAttr(_ []string, attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	if secretKeys[key] {
+		return slog.String(attr.Key, redacted)
+	}
+
+	switch value := attr.Value.Resolve(); value.Kind() {
+	case slog.KindString:
+		if mask, ok := piiKeys[key]; ok {
+			return slog.String(attr.Key, mask(value.String()))
+		}
+		return slog.String(attr.Key, RedactText(value.String()))
+	case slog.KindAny:
+		// Los errores pueden incluir emails, por ejemplo en los errores de clave duplicada
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, RedactText(err.Error()))
+		}
+	}
+	return attr
+}
+
+// RedactText oculta los emails que aparecen en un texto libre
+func RedactText(text string) string {
+	return emailPattern.ReplaceAllStringFunc(text, models.MaskEmail)
+}
+
+// contextHandler añade a cada registro el identificador de la petición, la traza y el usuario
+// autenticado guardados en el contexto, por lo que los servicios solo necesitan usar las funciones
+// *Context de slog
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle implementa slog.Handler
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := reqctx.RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	if traceID := reqctx.TraceID(ctx); traceID != "" {
+		record.AddAttrs(slog.String("trace_id", traceID))
+	}
+	if actor := reqctx.Actor(ctx); actor != "" {
+		record.AddAttrs(slog.String("user_id", actor))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs implementa slog.Handler
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implementa slog.Handler
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -21,7 +21,9 @@ package main
 
 import (
 	"context"
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -34,9 +36,13 @@ import (
 	"go-users-api/config"
 	"go-users-api/controllers"
 	_ "go-users-api/docs"
+	"go-users-api/logging"
+	"go-users-api/metrics"
+	"go-users-api/models"
 	"go-users-api/repository"
 	"go-users-api/routes"
 	"go-users-api/services"
+	"go-users-api/tracing"
 )
 
 // @title API Users BRM
@@ -58,44 +64,157 @@ import (
 // @in header
 // @name Authorization
 func main() {
+	migrateEmails := flag.Bool("migrate-emails", false, "recalculate the canonical email of every user and exit")
+	flag.Parse()
+
 	// Cargar variables de entorno desde .env
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using system environment variables")
-	}
+	envErr := godotenv.Load()
 
 	// Inicializar configuración
 	cfg := config.NewConfig()
 
+	// Configurar el logger estructurado; log.Printf de dependencias externas también pasa por él
+	logger, err := logging.New(os.Stdout, cfg.LogLevel, cfg.LogFormat)
+	slog.SetDefault(logger)
+	if err != nil {
+		slog.Warn("Invalid logging configuration", "error", err)
+	}
+	if envErr != nil {
+		slog.Info("No .env file found, using system environment variables")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fatal("Invalid configuration", err)
+	}
+
 	// Configurar el modo de Gin desde la configuración
 	if cfg.GinMode == "release" {
 		gin.SetMode(gin.ReleaseMode)
 	}
+	gin.DebugPrintRouteFunc = func(method, path, handler string, _ int) {
+		slog.Debug("Route registered", "method", method, "path", path, "handler", handler)
+	}
+
+	// Configurar las trazas antes de conectar a MongoDB para trazar también sus comandos
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter: cfg.TracingExporter,
+		Endpoint: cfg.TracingEndpoint,
+		File:     cfg.TracingFile,
+	})
+	if err != nil {
+		fatal("Error configuring tracing", err)
+	}
 
 	// Conectar a MongoDB
 	client, db, err := config.ConnectDB(cfg)
 	if err != nil {
-		log.Fatal("Error connecting to database:", err)
+		fatal("Error connecting to database", err)
 	}
 	defer func() {
 		if err := client.Disconnect(context.Background()); err != nil {
-			log.Fatal("Error disconnecting from database:", err)
+			fatal("Error disconnecting from database", err)
 		}
 	}()
 
 	// Inicializar repositorios
 	userRepo := repository.NewUserRepository(db)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	importRepo := repository.NewImportRepository(db)
+	rateLimitRepo := repository.NewRateLimitRepository(db)
+	idempotencyRepo := repository.NewIdempotencyRepository(db)
+
+	// Con -migrate-emails se recalcula el email canónico de todos los usuarios (por ejemplo al
+	// cambiar EMAIL_PROVIDER_RULES) y se termina sin iniciar el servidor
+	canonicalEmail := func(email string) string { return models.CanonicalEmail(email, cfg.EmailProviderRules) }
+	if *migrateEmails {
+		migrated, err := userRepo.MigrateEmails(context.Background(), canonicalEmail, true)
+		if err != nil {
+			fatal("Error migrating user emails", err)
+		}
+		slog.Info("Migrated user emails", "count", migrated)
+		return
+	}
+
+	// Las sondas de salud comprueban MongoDB; la API no está lista hasta terminar el arranque
+	healthService := services.NewHealthService(cfg.HealthCheckTimeout, services.HealthCheck{
+		Name:  "mongodb",
+		Check: func(ctx context.Context) error { return client.Ping(ctx, nil) },
+	})
+
+	// Las operaciones del repositorio de usuarios se miden en las métricas de MongoDB y se trazan
+	observedUserRepo := repository.NewObservedUserRepository(userRepo)
 
 	// Inicializar servicios
-	userService := services.NewUserService(userRepo)
+	auditService := services.NewAuditService(auditRepo, cfg)
+	userService := services.NewTracedUserService(services.NewUserService(observedUserRepo, auditService, cfg))
+	tokenService, err := services.NewTokenService(cfg)
+	if err != nil {
+		fatal("Error configuring JWT authentication", err)
+	}
+	authService := services.NewAuthService(userService, tokenService, refreshTokenRepo)
+	importService := services.NewImportService(importRepo, userService, cfg)
+
+	// Límite de peticiones por cliente; con varias réplicas los buckets se comparten en MongoDB
+	rateLimitPolicies, err := models.ParseRateLimitPolicies(cfg.RateLimits)
+	if err != nil {
+		fatal("Error configuring rate limits", err)
+	}
+	var rateLimitStore repository.RateLimitRepositoryInterface
+	switch cfg.RateLimitStore {
+	case "memory":
+		rateLimitStore = repository.NewMemoryRateLimitRepository()
+	case "mongo":
+		rateLimitStore = rateLimitRepo
+	default:
+		fatal("Error configuring rate limits", fmt.Errorf("unknown rate limit store %q, use memory or mongo", cfg.RateLimitStore))
+	}
+	rateLimitService := services.NewRateLimitService(rateLimitStore, rateLimitPolicies)
+	idempotencyService := services.NewIdempotencyService(idempotencyRepo, cfg)
 
 	// Inicializar controladores
 	userController := controllers.NewUserController(userService)
+	authController := controllers.NewAuthController(authService)
+	auditController := controllers.NewAuditController(auditService)
+	importController := controllers.NewImportController(importService)
+	healthController := controllers.NewHealthController(healthService)
 
-	// Configurar router
-	router := gin.Default()
+	// Configurar router; el logging y la recuperación de pánicos los añade SetupRoutes
+	router := gin.New()
+
+	// La IP del cliente (auditoría, logs y límite de peticiones) solo se toma de X-Forwarded-For
+	// si la petición llega desde uno de los proxies de confianza
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		fatal("Error configuring trusted proxies", err)
+	}
+
+	// Métricas: en un servidor propio si METRICS_ADDR está definido; si no, en /metrics del
+	// servidor principal protegidas con METRICS_TOKEN
+	var metricsServer *http.Server
+	var metricsHandler http.Handler
+	switch {
+	case cfg.MetricsAddr != "":
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler(cfg.MetricsToken))
+		metricsServer = &http.Server{Addr: cfg.MetricsAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	case cfg.MetricsToken != "":
+		metricsHandler = metrics.Handler(cfg.MetricsToken)
+	default:
+		slog.Warn("Metrics disabled: set METRICS_ADDR or METRICS_TOKEN to expose /metrics")
+	}
 
 	// Configurar rutas
-	routes.SetupRoutes(router, userController)
+	routes.SetupRoutes(router, routes.Dependencies{
+		UserController:     userController,
+		AuthController:     authController,
+		AuditController:    auditController,
+		ImportController:   importController,
+		HealthController:   healthController,
+		TokenService:       tokenService,
+		RateLimitService:   rateLimitService,
+		IdempotencyService: idempotencyService,
+		MetricsHandler:     metricsHandler,
+	})
 
 	// Configurar servidor usando la configuración
 	server := &http.Server{
@@ -109,23 +228,100 @@ func main() {
 
 	// Iniciar servidor en goroutine
 	go func() {
-		log.Printf("Server starting on port %s", cfg.Port)
+		slog.Info("Server starting", "port", cfg.Port)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Error starting server: %v", err)
+			fatal("Error starting server", err)
 		}
 	}()
 
+	if metricsServer != nil {
+		go func() {
+			slog.Info("Metrics server starting", "addr", cfg.MetricsAddr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("Error starting metrics server", err)
+			}
+		}()
+	}
+
+	// Completar el email canónico de los usuarios que aún no lo tienen; debe ejecutarse antes de
+	// crear el índice único. El servidor ya atiende las sondas, pero /startupz y /readyz responden
+	// 503 hasta que termine.
+	migrated, err := userRepo.MigrateEmails(context.Background(), canonicalEmail, false)
+	if err != nil {
+		fatal("Error migrating user emails", err)
+	}
+	if migrated > 0 {
+		slog.Info("Migrated user emails", "count", migrated)
+	}
+
+	// Completar el nombre en minúsculas que usa el filtro name
+	migrated, err = userRepo.MigrateNames(context.Background())
+	if err != nil {
+		fatal("Error migrating user names", err)
+	}
+	if migrated > 0 {
+		slog.Info("Migrated user names", "count", migrated)
+	}
+
+	// Crear índices
+	if err := userRepo.EnsureIndexes(context.Background()); err != nil {
+		fatal("Error creating user indexes", err)
+	}
+	if err := refreshTokenRepo.EnsureIndexes(context.Background()); err != nil {
+		fatal("Error creating refresh token indexes", err)
+	}
+	if err := auditRepo.EnsureIndexes(context.Background()); err != nil {
+		fatal("Error creating audit indexes", err)
+	}
+	if err := importRepo.EnsureIndexes(context.Background()); err != nil {
+		fatal("Error creating import indexes", err)
+	}
+	if err := rateLimitRepo.EnsureIndexes(context.Background()); err != nil {
+		fatal("Error creating rate limit indexes", err)
+	}
+	if err := idempotencyRepo.EnsureIndexes(context.Background()); err != nil {
+		fatal("Error creating idempotency indexes", err)
+	}
+	healthService.MarkStarted()
+	slog.Info("Startup completed")
+
+	// Iniciar jobs en segundo plano; se detienen al cancelar jobsCtx durante el apagado
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go services.NewPurgeJob(userService, cfg.TrashPurgeInterval, cfg.TrashRetention).Run(jobsCtx)
+	go importService.Run(jobsCtx)
+
 	// Esperar señal de terminación
 	<-quit
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server")
+
+	// Dejar de estar listo antes de cerrar nada, para que el balanceador retire el pod mientras
+	// el servidor aún atiende las peticiones en curso
+	healthService.MarkShuttingDown()
+	time.Sleep(cfg.ShutdownDelay)
+	stopJobs()
 
 	// Contexto con timeout para shutdown graceful
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+		fatal("Server forced to shutdown", err)
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			slog.Error("Error shutting down metrics server", "error", err)
+		}
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Error flushing traces", "error", err)
+	}
+
+	slog.Info("Server exited")
+}
 
-	log.Println("Server exited")
+// fatal registra un error que impide continuar y termina el proceso
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
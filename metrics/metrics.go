@@ -0,0 +1,131 @@
+// Package metrics define las métricas de la aplicación en formato Prometheus: peticiones HTTP,
+// operaciones de MongoDB, contadores de negocio y estadísticas del runtime de Go.
+package metrics
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"go-users-api/models"
+)
+
+// namespace es el prefijo de las métricas propias de la aplicación
+const namespace = "users_api"
+
+// Registry contiene todas las métricas que expone Handler. Se usa un registro propio en lugar
+// del global de Prometheus para no exponer métricas que registren las dependencias.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests cuenta las peticiones por método, plantilla de ruta (ej. /api/v1/users/:id) y estado
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration mide la latencia de las peticiones con las mismas etiquetas que HTTPRequests
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route template and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// MongoOperationDuration mide la latencia de cada operación del repositorio de usuarios
+	MongoOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongo_operation_duration_seconds",
+		Help:      "Latency of user repository operations against MongoDB.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation"})
+
+	// MongoOperationErrors cuenta las operaciones del repositorio que fallaron por un error de
+	// MongoDB; los resultados esperados, como un usuario inexistente, no se cuentan
+	MongoOperationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mongo_operation_errors_total",
+		Help:      "User repository operations that failed with a MongoDB error.",
+	}, []string{"operation"})
+
+	// UserChanges cuenta los cambios sobre usuarios por acción de auditoría (user.created, user.deleted...)
+	UserChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "user_changes_total",
+		Help:      "Changes applied to users by audit action.",
+	}, []string{"action"})
+
+	// UserConflicts cuenta las escrituras rechazadas por un conflicto, por motivo
+	UserConflicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "user_conflicts_total",
+		Help:      "User writes rejected because of a conflict, by reason.",
+	}, []string{"reason"})
+
+	// RateLimited cuenta las peticiones rechazadas por superar el límite, por política
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected because the client exceeded its rate limit, by policy.",
+	}, []string{"policy"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		MongoOperationDuration,
+		MongoOperationErrors,
+		UserChanges,
+		UserConflicts,
+		RateLimited,
+	)
+}
+
+// conflictReasons asigna a cada error de conflicto la etiqueta reason de UserConflicts
+var conflictReasons = []struct {
+	err    error
+	reason string
+}{
+	{models.ErrEmailTaken, "email_taken"},
+	{models.ErrVersionConflict, "version_conflict"},
+	{models.ErrPreconditionFailed, "precondition_failed"},
+	{models.ErrPatchTestFailed, "patch_test_failed"},
+}
+
+// ObserveConflict incrementa UserConflicts si err es un conflicto; el resto de errores se ignoran
+func ObserveConflict(err error) {
+	for _, conflict := range conflictReasons {
+		if errors.Is(err, conflict.err) {
+			UserConflicts.WithLabelValues(conflict.reason).Inc()
+			return
+		}
+	}
+}
+
+// Handler expone las métricas en el formato de texto de Prometheus. Si token no está vacío,
+// exige la cabecera "Authorization: Bearer <token>".
+func Handler(token string) http.Handler {
+	handler := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+	if token == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
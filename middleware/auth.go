@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go-users-api/models"
+	"go-users-api/reqctx"
+	"go-users-api/services"
+)
+
+// Claves usadas para guardar la identidad autenticada en el contexto de Gin
+const (
+	ContextUserID = "user_id"
+	ContextClaims = "claims"
+)
+
+// Auth middleware que exige un JWT válido en el header Authorization
+func Auth(tokenService services.TokenServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			RespondWithError(c, models.ErrMissingToken)
+			return
+		}
+
+		claims, err := tokenService.ParseAccessToken(tokenString)
+		if err != nil {
+			RespondWithError(c, err)
+			return
+		}
+
+		c.Set(ContextUserID, claims.Subject)
+		c.Set(ContextClaims, claims)
+		c.Request = c.Request.WithContext(reqctx.WithActor(c.Request.Context(), claims.Subject))
+		c.Next()
+	}
+}
+
+// GetClaims obtiene los claims del token autenticado desde el contexto
+func GetClaims(c *gin.Context) (*services.TokenClaims, bool) {
+	value, exists := c.Get(ContextClaims)
+	if !exists {
+		return nil, false
+	}
+	claims, ok := value.(*services.TokenClaims)
+	return claims, ok
+}
+
+// bearerToken extrae el token de un header "Authorization: Bearer <token>"
+func bearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
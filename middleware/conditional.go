@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go-users-api/models"
+)
+
+// ETag genera la etiqueta de entidad correspondiente a una versión del recurso
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// SetETag agrega el header ETag con la versión del recurso. La etiqueta solo depende de la versión,
+// pero el cuerpo cambia según los permisos del cliente (los datos personales se enmascaran), por lo
+// que Vary: Authorization impide que una caché entregue a un cliente la respuesta de otro.
+func SetETag(c *gin.Context, version int64) {
+	c.Header("ETag", ETag(version))
+	c.Header("Vary", "Authorization")
+}
+
+// IfMatchVersion obtiene la versión exigida por el header If-Match.
+// Retorna nil si el header no se envió o es "*". Como If-Match usa comparación fuerte,
+// una etiqueta débil o con formato desconocido nunca coincide y se responde 412.
+func IfMatchVersion(c *gin.Context) (*int64, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	version, ok := parseETag(header)
+	if !ok {
+		return nil, models.ErrPreconditionFailed
+	}
+	return &version, nil
+}
+
+// NotModified responde 304 si alguna etiqueta de If-None-Match coincide con la versión actual.
+// Retorna true cuando ya se respondió.
+func NotModified(c *gin.Context, version int64) bool {
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		// If-None-Match usa comparación débil: W/"3" coincide con "3"
+		candidate, ok := parseETag(strings.TrimPrefix(tag, "W/"))
+		if tag == "*" || (ok && candidate == version) {
+			SetETag(c, version)
+			c.AbortWithStatus(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// parseETag extrae la versión de una etiqueta fuerte con el formato "<versión>"
+func parseETag(tag string) (int64, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	return version, err == nil
+}
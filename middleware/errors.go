@@ -0,0 +1,239 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"go-users-api/metrics"
+	"go-users-api/models"
+	"go-users-api/reqctx"
+)
+
+func init() {
+	// Reportar los errores de validación con el nombre JSON del campo en lugar del nombre en Go
+	if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				return field.Name
+			}
+			return name
+		})
+
+		// maxbytes limita la longitud en bytes, no en caracteres (ej. contraseñas: bcrypt solo usa 72 bytes)
+		engine.RegisterValidation("maxbytes", func(fl validator.FieldLevel) bool {
+			limit, err := strconv.Atoi(fl.Param())
+			return err == nil && len(fl.Field().String()) <= limit
+		})
+	}
+}
+
+// Media types de las respuestas de error
+const (
+	MIMEProblemJSON = "application/problem+json"
+
+	// problemTypeBase es la base de los type URI de RFC 7807 (referencias relativas a la API)
+	problemTypeBase = "/problems/"
+)
+
+// problemKind describe cómo se presenta al cliente una categoría de error
+type problemKind struct {
+	status int
+	title  string
+	slug   string // Último segmento del type URI de RFC 7807
+}
+
+var (
+	problemValidation   = problemKind{http.StatusBadRequest, "Validation Error", "validation-error"}
+	problemUnauthorized = problemKind{http.StatusUnauthorized, "Unauthorized", "unauthorized"}
+	problemForbidden    = problemKind{http.StatusForbidden, "Forbidden", "forbidden"}
+	problemNotFound     = problemKind{http.StatusNotFound, "Not Found", "not-found"}
+	problemConflict     = problemKind{http.StatusConflict, "Conflict", "conflict"}
+	problemPrecondition = problemKind{http.StatusPreconditionFailed, "Precondition Failed", "precondition-failed"}
+	problemKeyReused    = problemKind{http.StatusUnprocessableEntity, "Unprocessable Entity", "idempotency-key-reused"}
+	problemMediaType    = problemKind{http.StatusUnsupportedMediaType, "Unsupported Media Type", "unsupported-media-type"}
+	problemTooLarge     = problemKind{http.StatusRequestEntityTooLarge, "Payload Too Large", "payload-too-large"}
+	problemRateLimited  = problemKind{http.StatusTooManyRequests, "Too Many Requests", "rate-limited"}
+	problemUnavailable  = problemKind{http.StatusServiceUnavailable, "Service Unavailable", "service-unavailable"}
+	problemInternal     = problemKind{http.StatusInternalServerError, "Internal Server Error", "internal-error"}
+)
+
+// RespondWithError traduce un error de dominio a su respuesta HTTP y corta la petición.
+// Es el único lugar donde se decide qué código HTTP corresponde a cada error.
+func RespondWithError(c *gin.Context, err error) {
+	kind := errorKind(err)
+	metrics.ObserveConflict(err)
+
+	message := err.Error()
+	if kind.status == http.StatusInternalServerError {
+		// No exponer detalles internos (errores de MongoDB, etc.) al cliente
+		slog.ErrorContext(c.Request.Context(), "Unexpected error", "method", c.Request.Method, "path", c.Request.URL.Path, "error", err)
+		message = "An unexpected error occurred"
+	}
+
+	if kind.status == http.StatusUnauthorized && !errors.Is(err, models.ErrInvalidCredentials) {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+
+	var fields []models.FieldError
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		fields = validationErr.Fields
+	}
+
+	writeError(c, kind, message, fields)
+}
+
+// writeError escribe el error como application/problem+json (RFC 7807) si el cliente lo acepta,
+// o con el formato clásico de models.ErrorResponse en caso contrario
+func writeError(c *gin.Context, kind problemKind, detail string, fields []models.FieldError) {
+	requestID := reqctx.RequestID(c.Request.Context())
+	if !acceptsProblemJSON(c) {
+		c.AbortWithStatusJSON(kind.status, models.ErrorResponse{
+			Error:     kind.title,
+			Message:   detail,
+			Code:      kind.status,
+			RequestID: requestID,
+		})
+		return
+	}
+
+	c.Header("Content-Type", MIMEProblemJSON)
+	c.AbortWithStatusJSON(kind.status, models.ProblemDetails{
+		Type:      problemTypeBase + kind.slug,
+		Title:     kind.title,
+		Status:    kind.status,
+		Detail:    detail,
+		Instance:  c.Request.URL.Path,
+		Errors:    fields,
+		RequestID: requestID,
+	})
+}
+
+// acceptsProblemJSON indica si el header Accept pide explícitamente application/problem+json
+func acceptsProblemJSON(c *gin.Context) bool {
+	for _, mediaRange := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, params, _ := strings.Cut(mediaRange, ";")
+		if !strings.EqualFold(strings.TrimSpace(mediaType), MIMEProblemJSON) {
+			continue
+		}
+		// Un peso "q=0" significa que el cliente rechaza el tipo
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "q") {
+				if q, err := strconv.ParseFloat(value, 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// BindingError convierte un error de ShouldBind* en un ValidationError con el detalle por campo
+func BindingError(err error) error {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		fields := make([]models.FieldError, len(validationErrors))
+		for i, fieldErr := range validationErrors {
+			fields[i] = models.FieldError{
+				Field:   fieldPath(fieldErr),
+				Message: validationMessage(fieldErr),
+			}
+		}
+		return models.NewValidationError(fields...)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return models.NewValidationError(models.FieldError{
+			Field:   typeErr.Field,
+			Message: "must be of type " + typeErr.Type.String(),
+		})
+	}
+
+	return &models.ValidationError{Message: err.Error()}
+}
+
+// errorKind determina la categoría (código HTTP, título y tipo) correspondiente al error
+func errorKind(err error) problemKind {
+	switch {
+	case errors.Is(err, models.ErrValidation), errors.Is(err, models.ErrInvalidID):
+		return problemValidation
+	case errors.Is(err, models.ErrInvalidCredentials),
+		errors.Is(err, models.ErrMissingToken),
+		errors.Is(err, models.ErrInvalidToken),
+		errors.Is(err, models.ErrTokenExpired),
+		errors.Is(err, models.ErrTokenReused):
+		return problemUnauthorized
+	case errors.Is(err, models.ErrForbidden):
+		return problemForbidden
+	case errors.Is(err, models.ErrNotFound), errors.Is(err, models.ErrImportNotFound):
+		return problemNotFound
+	case errors.Is(err, models.ErrEmailTaken),
+		errors.Is(err, models.ErrVersionConflict),
+		errors.Is(err, models.ErrPatchTestFailed),
+		errors.Is(err, models.ErrIdempotencyInProgress):
+		return problemConflict
+	case errors.Is(err, models.ErrPreconditionFailed):
+		return problemPrecondition
+	case errors.Is(err, models.ErrIdempotencyKeyReused):
+		return problemKeyReused
+	case errors.Is(err, models.ErrUnsupportedMediaType):
+		return problemMediaType
+	case errors.Is(err, models.ErrFileTooLarge):
+		return problemTooLarge
+	case errors.Is(err, models.ErrRateLimited):
+		return problemRateLimited
+	case errors.Is(err, models.ErrImportQueueFull):
+		return problemUnavailable
+	default:
+		return problemInternal
+	}
+}
+
+// fieldPath retorna la ruta JSON del campo sin el nombre del struct raíz (ej. "roles[0]")
+func fieldPath(fieldErr validator.FieldError) string {
+	_, path, found := strings.Cut(fieldErr.Namespace(), ".")
+	if !found {
+		return fieldErr.Field()
+	}
+	return path
+}
+
+// validationMessage genera un mensaje legible para la regla de validación que falló
+func validationMessage(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email"
+	case "min":
+		if fieldErr.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters long", fieldErr.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fieldErr.Param())
+	case "max":
+		if fieldErr.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters long", fieldErr.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fieldErr.Param())
+	case "maxbytes":
+		return fmt.Sprintf("must be at most %s bytes long", fieldErr.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", fieldErr.Param())
+	default:
+		return fmt.Sprintf("failed the %q validation", fieldErr.Tag())
+	}
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+
+	"go-users-api/models"
+	"go-users-api/services"
+)
+
+// IdempotencyKeyHeader es la cabecera con la que el cliente identifica una operación que puede
+// reintentar sin riesgo de ejecutarla dos veces
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader marca las respuestas repetidas de una petición anterior
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// validIdempotencyKey limita las claves a caracteres ASCII visibles, como un UUID
+var validIdempotencyKey = regexp.MustCompile(`^[\x21-\x7E]{1,255}$`)
+
+// idempotencyReplayHeaders son las cabeceras de la respuesta original que se repiten
+var idempotencyReplayHeaders = []string{"Content-Type", "ETag", "Location", "Last-Modified"}
+
+// Idempotency hace que las peticiones POST y PATCH con la cabecera Idempotency-Key se ejecuten
+// una sola vez: los reintentos con la misma clave y el mismo cuerpo reciben la respuesta guardada,
+// con otro cuerpo reciben 422 y mientras la original está en curso reciben 409. Las respuestas
+// 5xx no se guardan, para que el cliente pueda reintentar. Debe ir después de Auth: las claves
+// son de cada usuario.
+func Idempotency(idempotencyService services.IdempotencyServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if idempotencyService == nil || key == "" ||
+			(c.Request.Method != http.MethodPost && c.Request.Method != http.MethodPatch) {
+			c.Next()
+			return
+		}
+		if !validIdempotencyKey.MatchString(key) {
+			RespondWithError(c, models.NewValidationError(models.FieldError{
+				Field:   IdempotencyKeyHeader,
+				Message: "must be 1 to 255 visible ASCII characters",
+			}))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			RespondWithError(c, &models.ValidationError{Message: "could not read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		id := c.GetString(ContextUserID) + ":" + key
+		fingerprint := requestFingerprint(c.Request, body)
+
+		stored, err := idempotencyService.Begin(ctx, id, fingerprint)
+		if err != nil {
+			if errors.Is(err, models.ErrIdempotencyInProgress) {
+				c.Header("Retry-After", "1")
+			}
+			RespondWithError(c, err)
+			return
+		}
+		if stored != nil {
+			for name, value := range stored.ResponseHeaders {
+				c.Header(name, value)
+			}
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(stored.ResponseStatus, stored.ResponseHeaders["Content-Type"], stored.ResponseBody)
+			c.Abort()
+			return
+		}
+
+		// Guardar la respuesta aunque el cliente se haya desconectado: su reintento la necesita
+		storeCtx := context.WithoutCancel(ctx)
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		completed := false
+		defer func() {
+			// Si el handler falló o entró en pánico, liberar la clave para permitir el reintento
+			if !completed {
+				if err := idempotencyService.Release(storeCtx, id, fingerprint); err != nil {
+					slog.ErrorContext(ctx, "Error releasing idempotency key", "error", err)
+				}
+			}
+		}()
+
+		c.Next()
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		headers := make(map[string]string, len(idempotencyReplayHeaders))
+		for _, name := range idempotencyReplayHeaders {
+			if value := writer.Header().Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		if err := idempotencyService.Complete(storeCtx, id, fingerprint, status, headers, writer.body.Bytes()); err != nil {
+			slog.ErrorContext(ctx, "Error storing idempotent response", "error", err)
+			return
+		}
+		completed = true
+	}
+}
+
+// requestFingerprint identifica el contenido de la petición: método, ruta, query, tipo y cuerpo
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	for _, part := range []string{r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("Content-Type")} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordingWriter copia el cuerpo de la respuesta mientras se envía al cliente
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
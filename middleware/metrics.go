@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-users-api/metrics"
+)
+
+// unmatchedRoute agrupa en una sola etiqueta las peticiones que no corresponden a ninguna ruta,
+// para que las URLs arbitrarias no creen una serie por cada path
+const unmatchedRoute = "unmatched"
+
+// Metrics registra el número y la latencia de las peticiones etiquetadas con la plantilla de la
+// ruta (ej. /api/v1/users/:id) en lugar del path, que tiene cardinalidad ilimitada
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
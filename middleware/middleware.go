@@ -1,12 +1,29 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"go-users-api/reqctx"
 )
 
+// RequestIDHeader es la cabecera con la que el cliente (o un proxy) identifica la petición
+const RequestIDHeader = "X-Request-ID"
+
+// TraceParentHeader es la cabecera W3C Trace Context que identifica la traza distribuida
+const TraceParentHeader = "traceparent"
+
 // CORS middleware para manejar Cross-Origin Resource Sharing
 func CORS() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
@@ -28,8 +45,9 @@ func CORS() gin.HandlerFunc {
 		}
 
 		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, If-Match, If-None-Match, X-Request-ID, traceparent, Idempotency-Key")
+		c.Header("Access-Control-Expose-Headers", "ETag, X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After, Idempotent-Replayed")
+		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -40,39 +58,106 @@ func CORS() gin.HandlerFunc {
 	})
 }
 
-// Logger middleware personalizado para logging de requests
+// RequestContext guarda en el contexto de la petición su identificador, la cabecera traceparent
+// y la IP del cliente, para que los servicios puedan registrarlos (por ejemplo, en la auditoría o
+// en los logs). El identificador se toma de X-Request-ID si es válido o se genera uno nuevo, y se
+// devuelve en la respuesta para que el cliente pueda citarlo.
+func RequestContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		ctx := reqctx.WithClientIP(c.Request.Context(), c.ClientIP())
+		ctx = reqctx.WithRequestID(ctx, requestID)
+		if reqctx.TraceParent(ctx) == "" {
+			// Sin un span de Tracing, la petición propaga un traceparent calculado
+			ctx = reqctx.WithTraceParent(ctx, childTraceParent(c.GetHeader(TraceParentHeader)))
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// validRequestID limita los identificadores aceptados del cliente para que no puedan inyectar
+// texto arbitrario en los logs ni en las cabeceras
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// traceParentPattern reconoce una cabecera traceparent W3C: versión, trace-id, parent-id y flags
+var traceParentPattern = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// childTraceParent retorna el traceparent que esta petición propaga a las llamadas que haga:
+// conserva el trace-id y los flags del recibido con un nuevo parent-id, o inicia una traza nueva
+// si no se recibió uno válido
+func childTraceParent(header string) string {
+	traceID, flags := "", "01"
+	if match := traceParentPattern.FindStringSubmatch(strings.TrimSpace(header)); match != nil &&
+		match[1] != "ff" && strings.Trim(match[2], "0") != "" && strings.Trim(match[3], "0") != "" {
+		traceID, flags = match[2], match[4]
+	}
+	if traceID == "" {
+		traceID = randomHex(16)
+	}
+	return "00-" + traceID + "-" + randomHex(8) + "-" + flags
+}
+
+// randomHex retorna n bytes aleatorios codificados en hexadecimal
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Logger registra cada petición con slog al terminar: método, ruta, estado, latencia y, a través
+// del contexto, el identificador de la petición y el usuario autenticado. Solo se registra la
+// ruta sin la query, que puede contener datos personales (por ejemplo, ?email=).
 func Logger() gin.HandlerFunc {
-	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
-			param.ClientIP,
-			param.TimeStamp.Format(time.RFC1123),
-			param.Method,
-			param.Path,
-			param.Request.Proto,
-			param.StatusCode,
-			param.Latency,
-			param.Request.UserAgent(),
-			param.ErrorMessage,
-		)
-	})
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "HTTP request", attrs...)
+	}
 }
 
-// Recovery middleware para manejar pánicos
+// Recovery middleware para manejar pánicos; el pánico se registra con su stack trace
 func Recovery() gin.HandlerFunc {
-	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered interface{}) {
+		slog.ErrorContext(c.Request.Context(), "Panic recovered",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"panic", fmt.Sprint(recovered),
+			"stack", string(debug.Stack()),
+		)
+
+		message := "An unexpected error occurred"
 		if err, ok := recovered.(string); ok {
-			c.JSON(500, gin.H{
-				"error":   "Internal Server Error",
-				"message": err,
-				"code":    500,
-			})
-		} else {
-			c.JSON(500, gin.H{
-				"error":   "Internal Server Error",
-				"message": "An unexpected error occurred",
-				"code":    500,
-			})
+			message = err
 		}
-		c.Abort()
+		writeError(c, problemInternal, message, nil)
 	})
 }
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-users-api/metrics"
+	"go-users-api/models"
+	"go-users-api/services"
+)
+
+// RateLimit limita las peticiones de cada cliente con la política del grupo de rutas (ej.
+// "users.read" y "users.write", o "users" para ambas). Debe ir después de Auth para limitar por
+// usuario; sin usuario autenticado se limita por IP. Si el almacén de límites falla, la petición
+// se deja pasar: no poder contar no debe dejar la API sin servicio.
+func RateLimit(rateLimitService services.RateLimitServiceInterface, group string) gin.HandlerFunc {
+	return rateLimit(rateLimitService, group, clientIdentity)
+}
+
+// RateLimitByIP limita las peticiones de cada IP con la política del grupo, esté o no autenticado
+// el cliente. Va antes de Auth para que las peticiones sin token o con un token inválido también
+// cuenten; un RateLimit posterior reemplaza las cabeceras RateLimit-* con las de su política.
+func RateLimitByIP(rateLimitService services.RateLimitServiceInterface, group string) gin.HandlerFunc {
+	return rateLimit(rateLimitService, group, clientIP)
+}
+
+// rateLimit limita las peticiones con la política del grupo, contando por separado cada
+// identidad que retorna identity
+func rateLimit(rateLimitService services.RateLimitServiceInterface, group string, identity func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rateLimitService == nil {
+			c.Next()
+			return
+		}
+
+		write := c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead
+		result, err := rateLimitService.Allow(c.Request.Context(), group, write, identity(c))
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "Rate limit check failed, allowing request", "group", group, "error", err)
+			c.Next()
+			return
+		}
+		if result == nil {
+			c.Next()
+			return
+		}
+
+		setRateLimitHeaders(c, result)
+		if !result.Allowed {
+			metrics.RateLimited.WithLabelValues(result.Policy.Name).Inc()
+			c.Header("Retry-After", strconv.FormatInt(ceilSeconds(result.RetryAfter), 10))
+			RespondWithError(c, models.ErrRateLimited)
+			return
+		}
+		c.Next()
+	}
+}
+
+// clientIdentity identifica al cliente por el subject del JWT o, sin autenticar, por su IP.
+// No hay identidad de API key porque la API no emite ni valida API keys (ver la limitación en el
+// README); una cabecera sin verificar permitiría a un cliente cambiar de bucket en cada petición.
+func clientIdentity(c *gin.Context) string {
+	if userID := c.GetString(ContextUserID); userID != "" {
+		return "user:" + userID
+	}
+	return clientIP(c)
+}
+
+// clientIP identifica al cliente por su IP. La IP solo se toma de X-Forwarded-For si la petición
+// llega desde un proxy de confianza (TRUSTED_PROXIES); si no, un cliente podría cambiar de
+// identidad en cada petición.
+func clientIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// setRateLimitHeaders añade las cabeceras RateLimit-* del draft de la IETF: la cuota y su
+// ventana, las peticiones restantes y los segundos hasta que el bucket vuelve a estar lleno
+func setRateLimitHeaders(c *gin.Context, result *models.RateLimitResult) {
+	policy := result.Policy
+	c.Header("RateLimit-Limit", strconv.FormatInt(policy.Limit, 10))
+	c.Header("RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+	c.Header("RateLimit-Reset", strconv.FormatInt(ceilSeconds(result.Reset), 10))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d;policy=%q", policy.Limit, ceilSeconds(policy.Period), policy.Burst, policy.Name))
+}
+
+// ceilSeconds redondea una duración hacia arriba a segundos enteros
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
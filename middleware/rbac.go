@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go-users-api/models"
+)
+
+// RequirePermission middleware que exige que el usuario autenticado tenga el permiso indicado.
+// Los roles con permisos solo sobre sí mismos (RoleSelf) pasan únicamente cuando el parámetro
+// :id (o :uuid) de la ruta corresponde a su propio usuario. Debe usarse después de Auth.
+func RequirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := GetClaims(c); !ok {
+			RespondWithError(c, models.ErrMissingToken)
+			return
+		}
+
+		if !HasPermission(c, permission) {
+			RespondWithError(c, fmt.Errorf("%w for %s", models.ErrForbidden, permission))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// HasPermission indica si el usuario autenticado tiene el permiso en la petición actual,
+// aplicando la regla de "self" cuando la ruta apunta a su propio registro
+func HasPermission(c *gin.Context, permission models.Permission) bool {
+	claims, ok := GetClaims(c)
+	if !ok {
+		return false
+	}
+
+	if models.HasPermission(claims.Roles, permission) {
+		return true
+	}
+
+	return IsSelf(c) && models.HasSelfPermission(claims.Roles, permission)
+}
+
+// IsSelf indica si el parámetro :id (ObjectID o UUID) o :uuid de la ruta corresponde al usuario autenticado
+func IsSelf(c *gin.Context) bool {
+	claims, ok := GetClaims(c)
+	if !ok {
+		return false
+	}
+
+	id := c.Param("id")
+	if id == "" {
+		id = c.Param("uuid")
+	}
+	if id == "" {
+		return false
+	}
+	return id == claims.Subject || (claims.UUID != "" && strings.EqualFold(id, claims.UUID))
+}
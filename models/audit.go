@@ -0,0 +1,124 @@
+package models
+
+import (
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditAction representa el tipo de cambio registrado sobre un usuario
+type AuditAction string
+
+// Acciones auditadas
+const (
+	AuditUserCreated  AuditAction = "user.created"
+	AuditUserUpdated  AuditAction = "user.updated"
+	AuditUserDeleted  AuditAction = "user.deleted"
+	AuditUserRestored AuditAction = "user.restored"
+)
+
+// AuditChange representa el valor anterior y nuevo de un campo modificado
+type AuditChange struct {
+	Field  string      `json:"field" bson:"field" example:"email"`
+	Before interface{} `json:"before,omitempty" bson:"before,omitempty" example:"j***@example.com"`
+	After  interface{} `json:"after,omitempty" bson:"after,omitempty" example:"j***@example.org"`
+}
+
+// AuditEvent representa un cambio sobre un usuario en la colección audit_events
+type AuditEvent struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty" example:"507f1f77bcf86cd799439011"`
+	UserID    string             `json:"user_id" bson:"user_id" example:"507f1f77bcf86cd799439011"`
+	UserUUID  string             `json:"user_uuid,omitempty" bson:"user_uuid,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Action    AuditAction        `json:"action" bson:"action" example:"user.updated"`
+	ActorID   string             `json:"actor_id,omitempty" bson:"actor_id,omitempty" example:"507f191e810c19729de860ea"`
+	RequestID string             `json:"request_id,omitempty" bson:"request_id,omitempty" example:"4bf92f3577b34da6a3ce929d0e0e4736"`
+	ClientIP  string             `json:"client_ip,omitempty" bson:"client_ip,omitempty" example:"203.0.113.7"`
+	Changes   []AuditChange      `json:"changes" bson:"changes"`
+	Timestamp time.Time          `json:"timestamp" bson:"timestamp" example:"2023-01-01T00:00:00Z"`
+}
+
+// AuditQuery representa los parámetros de consulta del registro de auditoría
+type AuditQuery struct {
+	Page    string     `form:"page"`
+	Limit   string     `form:"limit"`
+	ActorID string     `form:"actor_id"`
+	Action  string     `form:"action" binding:"omitempty,oneof=user.created user.updated user.deleted user.restored"`
+	From    *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To      *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// AuditFilter contiene los criterios de búsqueda validados del registro de auditoría
+type AuditFilter struct {
+	UserID  string // ObjectID o UUID del usuario
+	ActorID string
+	Action  AuditAction
+	From    *time.Time
+	To      *time.Time
+}
+
+// AuditEventsResponse representa la respuesta de una consulta de auditoría
+type AuditEventsResponse struct {
+	Events []AuditEvent `json:"events"`
+	Total  int64        `json:"total" example:"10"`
+}
+
+// auditedField describe un campo del usuario incluido en el diff de auditoría
+type auditedField struct {
+	name  string
+	value func(u *User) interface{}
+	mask  func(value string) string // nil si el campo no contiene datos personales
+}
+
+// auditedFields son los campos que se comparan; los datos personales se guardan enmascarados
+var auditedFields = []auditedField{
+	{name: "name", value: func(u *User) interface{} { return u.Name }},
+	{name: "email", value: func(u *User) interface{} { return u.Email }, mask: MaskEmail},
+	{name: "age", value: func(u *User) interface{} { return u.Age }},
+	{name: "phone", value: func(u *User) interface{} { return u.Phone }, mask: MaskPhone},
+	{name: "address", value: func(u *User) interface{} { return u.Address }, mask: MaskAddress},
+	{name: "roles", value: func(u *User) interface{} { return u.GetRoles() }},
+	{name: "deleted_at", value: func(u *User) interface{} { return u.DeletedAt }},
+	{name: "deleted_by", value: func(u *User) interface{} { return u.DeletedBy }},
+}
+
+// DiffUsers retorna los campos que cambiaron entre dos versiones del usuario.
+// before nil representa un usuario recién creado. Los valores se comparan sin enmascarar,
+// por lo que un cambio se registra aunque ambos valores enmascarados coincidan.
+func DiffUsers(before, after *User) []AuditChange {
+	changes := []AuditChange{}
+	for _, field := range auditedFields {
+		var oldValue, newValue interface{}
+		if before != nil {
+			oldValue = field.value(before)
+		}
+		if after != nil {
+			newValue = field.value(after)
+		}
+		if isEmptyValue(oldValue) && isEmptyValue(newValue) {
+			continue
+		}
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		changes = append(changes, AuditChange{
+			Field:  field.name,
+			Before: field.maskValue(oldValue),
+			After:  field.maskValue(newValue),
+		})
+	}
+	return changes
+}
+
+// maskValue enmascara el valor si el campo contiene datos personales
+func (f auditedField) maskValue(value interface{}) interface{} {
+	if text, ok := value.(string); ok && f.mask != nil {
+		return f.mask(text)
+	}
+	return value
+}
+
+// isEmptyValue indica si el valor es nil o el valor cero de su tipo
+func isEmptyValue(value interface{}) bool {
+	return value == nil || reflect.ValueOf(value).IsZero()
+}
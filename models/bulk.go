@@ -0,0 +1,67 @@
+package models
+
+import "encoding/json"
+
+// BulkItemStatus es el resultado de una operación individual dentro de una petición masiva
+type BulkItemStatus string
+
+// Resultados posibles de cada elemento
+const (
+	BulkCreated   BulkItemStatus = "created"
+	BulkUpdated   BulkItemStatus = "updated"
+	BulkDeleted   BulkItemStatus = "deleted"
+	BulkValid     BulkItemStatus = "valid"     // Modo dry_run: el elemento se habría aplicado
+	BulkConflict  BulkItemStatus = "conflict"  // Email en uso o versión desactualizada
+	BulkInvalid   BulkItemStatus = "invalid"   // Datos o ID no válidos
+	BulkNotFound  BulkItemStatus = "not_found" // El usuario no existe o está en la papelera
+	BulkForbidden BulkItemStatus = "forbidden" // El cambio requiere un permiso que el usuario no tiene
+	BulkFailed    BulkItemStatus = "failed"    // Error inesperado al escribir
+	BulkSkipped   BulkItemStatus = "skipped"   // Modo atómico: no se aplicó porque otro elemento falló
+)
+
+// BulkCreateRequest representa la petición de alta masiva de usuarios.
+// Cada elemento se valida por separado y su error se informa en el resultado correspondiente.
+type BulkCreateRequest struct {
+	Atomic bool                `json:"atomic" example:"false"`  // true: se crean todos o ninguno
+	DryRun bool                `json:"dry_run" example:"false"` // true: solo se valida, sin crear ningún usuario
+	Users  []CreateUserRequest `json:"users" binding:"required,min=1"`
+}
+
+// BulkUpdateItem representa la modificación de un usuario dentro de una petición masiva
+type BulkUpdateItem struct {
+	ID      string          `json:"id" example:"507f1f77bcf86cd799439011"`                // ObjectID o UUID
+	Version *int64          `json:"version,omitempty" example:"3"`                        // Si se indica, solo se modifica esa versión
+	Changes json.RawMessage `json:"changes" swaggertype:"object" example:"{\"age\": 31}"` // JSON Merge Patch (RFC 7396)
+}
+
+// BulkUpdateRequest representa la petición de modificación masiva de usuarios
+type BulkUpdateRequest struct {
+	Atomic bool             `json:"atomic" example:"false"` // true: se modifican todos o ninguno
+	Users  []BulkUpdateItem `json:"users" binding:"required,min=1"`
+}
+
+// BulkDeleteRequest representa la petición de eliminación masiva (a la papelera) de usuarios
+type BulkDeleteRequest struct {
+	Atomic bool     `json:"atomic" example:"false"` // true: se eliminan todos o ninguno
+	IDs    []string `json:"ids" binding:"required,min=1" example:"507f1f77bcf86cd799439011"`
+}
+
+// BulkItemResult representa el resultado de un elemento, en la misma posición que en la petición
+type BulkItemResult struct {
+	Index   int            `json:"index" example:"0"`
+	ID      string         `json:"id,omitempty" example:"507f1f77bcf86cd799439011"`
+	UUID    string         `json:"uuid,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Version int64          `json:"version,omitempty" example:"1"`
+	Status  BulkItemStatus `json:"status" example:"created"`
+	Error   string         `json:"error,omitempty" example:"email already exists"`
+	Errors  []FieldError   `json:"errors,omitempty"`
+}
+
+// BulkResponse representa la respuesta de una operación masiva
+type BulkResponse struct {
+	Atomic    bool             `json:"atomic" example:"false"`
+	Committed bool             `json:"committed" example:"true"` // false si no se aplicó ningún cambio (modo atómico o dry_run)
+	Succeeded int              `json:"succeeded" example:"2"`
+	Failed    int              `json:"failed" example:"1"`
+	Results   []BulkItemResult `json:"results"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import "strings"
+
+// emailProvider describe las reglas de un proveedor que entrega en el mismo buzón
+// direcciones que difieren en puntos o en un sufijo "+etiqueta"
+type emailProvider struct {
+	domain     string // Dominio canónico del proveedor
+	ignoreDots bool
+	plusTags   bool
+}
+
+// emailProviders asocia cada dominio con las reglas de su proveedor
+var emailProviders = map[string]emailProvider{
+	"gmail.com":      {domain: "gmail.com", ignoreDots: true, plusTags: true},
+	"googlemail.com": {domain: "gmail.com", ignoreDots: true, plusTags: true},
+}
+
+// NormalizeEmail retorna la forma que se muestra y se guarda del email:
+// sin espacios alrededor y con el dominio en minúsculas
+func NormalizeEmail(email string) string {
+	email = strings.TrimSpace(email)
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	return email[:at+1] + strings.ToLower(email[at+1:])
+}
+
+// CanonicalEmail retorna la forma usada para buscar usuarios y garantizar que el email es único.
+// Todo el email se pasa a minúsculas; con providerRules además se aplican las reglas del
+// proveedor (por ejemplo, en Gmail "John.Doe+news@gmail.com" es "johndoe@gmail.com").
+func CanonicalEmail(email string, providerRules bool) string {
+	email = strings.ToLower(NormalizeEmail(email))
+	at := strings.LastIndex(email, "@")
+	if at < 0 || !providerRules {
+		return email
+	}
+
+	local, domain := email[:at], email[at+1:]
+	provider, ok := emailProviders[domain]
+	if !ok {
+		return email
+	}
+	if provider.plusTags {
+		local, _, _ = strings.Cut(local, "+")
+	}
+	if provider.ignoreDots {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + provider.domain
+}
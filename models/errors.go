@@ -0,0 +1,92 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// Errores de dominio compartidos por repository, services y controllers.
+// Los handlers deciden el código HTTP con errors.Is, nunca comparando mensajes.
+var (
+	ErrNotFound   = errors.New("user not found")
+	ErrInvalidID  = errors.New("invalid user ID")
+	ErrEmailTaken = errors.New("email already exists")
+	ErrValidation = errors.New("validation error")
+
+	// ErrVersionConflict indica que el usuario cambió entre la lectura y la escritura
+	ErrVersionConflict = errors.New("user was modified concurrently, retry the request")
+	// ErrPreconditionFailed indica que la versión enviada en If-Match no es la actual
+	ErrPreconditionFailed = errors.New("user has been modified since it was retrieved")
+
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrPatchTestFailed      = errors.New("patch test operation failed")
+
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrMissingToken       = errors.New("missing bearer token")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrTokenExpired       = errors.New("token has expired")
+	ErrTokenReused        = errors.New("refresh token reuse detected")
+	ErrForbidden          = errors.New("insufficient permissions")
+
+	ErrImportNotFound  = errors.New("import not found")
+	ErrFileTooLarge    = errors.New("file too large")
+	ErrImportQueueFull = errors.New("too many imports in progress, retry later")
+
+	ErrRateLimited = errors.New("rate limit exceeded, retry later")
+
+	// ErrIdempotencyKeyReused indica que se reutilizó una Idempotency-Key con otra petición
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+	// ErrIdempotencyInProgress indica que la petición original con la misma clave aún no terminó
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is still in progress, retry later")
+)
+
+// IsExpected indica si err describe un resultado esperado de una operación (un usuario
+// inexistente, un conflicto, datos inválidos) y no un fallo del servidor o de la base de datos.
+// Las métricas y las trazas solo cuentan como fallo los errores no esperados.
+func IsExpected(err error) bool {
+	for _, expected := range []error{
+		ErrNotFound, ErrInvalidID, ErrEmailTaken, ErrValidation, ErrVersionConflict,
+		ErrPreconditionFailed, ErrPatchTestFailed, ErrInvalidCredentials, ErrForbidden,
+	} {
+		if errors.Is(err, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldError describe un error de validación de un campo concreto
+type FieldError struct {
+	Field   string `json:"field" example:"email"`
+	Message string `json:"message" example:"must be a valid email"`
+}
+
+// ValidationError agrupa los errores de validación de una petición.
+// errors.Is(err, ErrValidation) es verdadero para cualquier ValidationError.
+type ValidationError struct {
+	Message string
+	Fields  []FieldError
+}
+
+// NewValidationError crea un error de validación con los campos indicados
+func NewValidationError(fields ...FieldError) *ValidationError {
+	return &ValidationError{Fields: fields}
+}
+
+// Error implementa la interfaz error
+func (e *ValidationError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+
+	parts := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		parts[i] = field.Field + " " + field.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Is permite comparar cualquier ValidationError con ErrValidation
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
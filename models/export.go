@@ -0,0 +1,117 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ExportFormat es el formato de una exportación de usuarios
+type ExportFormat string
+
+// Formatos de exportación soportados
+const (
+	ExportCSV    ExportFormat = "csv"
+	ExportNDJSON ExportFormat = "ndjson"
+	ExportXLSX   ExportFormat = "xlsx"
+)
+
+// ContentType retorna el media type del formato
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case ExportNDJSON:
+		return "application/x-ndjson"
+	case ExportXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// ExportColumn describe una columna exportable y cómo obtener su valor de la respuesta del usuario
+type ExportColumn struct {
+	Name  string
+	Value func(u *UserResponse) interface{} // string, int, int64, []Role o time.Time
+}
+
+// ExportColumns son las columnas exportables en su orden por defecto. Los nombres coinciden con
+// los de la importación, por lo que un CSV exportado puede volver a importarse.
+var ExportColumns = []ExportColumn{
+	{Name: "id", Value: func(u *UserResponse) interface{} { return u.ID }},
+	{Name: "uuid", Value: func(u *UserResponse) interface{} { return u.UUID }},
+	{Name: "name", Value: func(u *UserResponse) interface{} { return u.Name }},
+	{Name: "email", Value: func(u *UserResponse) interface{} { return u.Email }},
+	{Name: "age", Value: func(u *UserResponse) interface{} { return u.Age }},
+	{Name: "phone", Value: func(u *UserResponse) interface{} { return u.Phone }},
+	{Name: "address", Value: func(u *UserResponse) interface{} { return u.Address }},
+	{Name: "roles", Value: func(u *UserResponse) interface{} { return u.Roles }},
+	{Name: "version", Value: func(u *UserResponse) interface{} { return u.Version }},
+	{Name: "created_at", Value: func(u *UserResponse) interface{} { return u.CreatedAt }},
+	{Name: "updated_at", Value: func(u *UserResponse) interface{} { return u.UpdatedAt }},
+}
+
+// UserExportQuery representa los parámetros de consulta aceptados por GET /users/export.
+// Los filtros y el orden son los mismos que los del listado.
+type UserExportQuery struct {
+	Format      string     `form:"format" binding:"omitempty,oneof=csv ndjson xlsx"`
+	Columns     string     `form:"columns"` // Lista separada por comas; vacía exporta todas
+	Name        string     `form:"name" binding:"max=100"`
+	Email       string     `form:"email" binding:"max=100"`
+	MinAge      *int       `form:"min_age" binding:"omitempty,min=0,max=150"`
+	MaxAge      *int       `form:"max_age" binding:"omitempty,min=0,max=150"`
+	CreatedFrom *time.Time `form:"created_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo   *time.Time `form:"created_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Search      string     `form:"q" binding:"max=100"`
+	Sort        string     `form:"sort"`
+}
+
+// ListQuery retorna los filtros de la exportación como parámetros del listado
+func (q UserExportQuery) ListQuery() UserListQuery {
+	return UserListQuery{
+		Name:        q.Name,
+		Email:       q.Email,
+		MinAge:      q.MinAge,
+		MaxAge:      q.MaxAge,
+		CreatedFrom: q.CreatedFrom,
+		CreatedTo:   q.CreatedTo,
+		Search:      q.Search,
+		Sort:        q.Sort,
+	}
+}
+
+// UserExport contiene los parámetros validados de una exportación
+type UserExport struct {
+	Format  ExportFormat
+	Columns []ExportColumn
+	Filter  UserFilter
+	MaskPII bool // true si quien exporta no tiene el permiso users:read:pii
+}
+
+// ParseExportColumns convierte un parámetro como "name,email" en columnas de exportación.
+// Vacío retorna todas las columnas.
+func ParseExportColumns(columns string) ([]ExportColumn, error) {
+	if strings.TrimSpace(columns) == "" {
+		return ExportColumns, nil
+	}
+
+	var selected []ExportColumn
+	for _, name := range strings.Split(columns, ",") {
+		name = strings.TrimSpace(name)
+		index := slices.IndexFunc(ExportColumns, func(column ExportColumn) bool { return column.Name == name })
+		if index < 0 {
+			names := make([]string, len(ExportColumns))
+			for i, column := range ExportColumns {
+				names[i] = column.Name
+			}
+			return nil, NewValidationError(FieldError{
+				Field:   "columns",
+				Message: fmt.Sprintf("unknown column %q; allowed columns: %s", name, strings.Join(names, ", ")),
+			})
+		}
+		if !slices.ContainsFunc(selected, func(column ExportColumn) bool { return column.Name == name }) {
+			selected = append(selected, ExportColumns[index])
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// HealthStatus representa el estado de la aplicación o de una de sus dependencias
+type HealthStatus string
+
+// Estados de las sondas de salud
+const (
+	HealthUp           HealthStatus = "up"
+	HealthDown         HealthStatus = "down"
+	HealthStarting     HealthStatus = "starting"      // Aún se están creando los índices o ejecutando migraciones
+	HealthShuttingDown HealthStatus = "shutting_down" // El apagado graceful ya comenzó
+)
+
+// DependencyHealth representa el resultado de comprobar una dependencia
+type DependencyHealth struct {
+	Status    HealthStatus `json:"status" example:"up"`
+	LatencyMs float64      `json:"latency_ms" example:"1.25"`
+	// Error resume el fallo ("timeout" o "unavailable"); el detalle solo se escribe en los logs
+	Error string `json:"error,omitempty" example:"timeout"`
+}
+
+// HealthReport representa la respuesta de las sondas de salud
+type HealthReport struct {
+	Status HealthStatus                `json:"status" example:"up"`
+	Checks map[string]DependencyHealth `json:"checks,omitempty"`
+	Time   time.Time                   `json:"time" example:"2023-01-01T00:00:00Z"`
+}
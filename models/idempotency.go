@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// IdempotencyStatus representa el estado de una petición con Idempotency-Key
+type IdempotencyStatus string
+
+// Estados de una clave de idempotencia
+const (
+	IdempotencyInProgress IdempotencyStatus = "in_progress" // La petición original aún se está atendiendo
+	IdempotencyCompleted  IdempotencyStatus = "completed"   // La respuesta está guardada y se repite en los reintentos
+)
+
+// IdempotencyRecord guarda una petición con Idempotency-Key y su respuesta en la colección idempotency_keys
+type IdempotencyRecord struct {
+	// ID combina el usuario autenticado y la clave, para que dos clientes no compartan claves
+	ID string `bson:"_id"`
+	// Fingerprint es el hash del método, la ruta y el cuerpo de la petición original
+	Fingerprint     string            `bson:"fingerprint"`
+	Status          IdempotencyStatus `bson:"status"`
+	ResponseStatus  int               `bson:"response_status,omitempty"`
+	ResponseHeaders map[string]string `bson:"response_headers,omitempty"`
+	// ResponseBody es el cuerpo de la respuesta. Puede contener datos personales, así que
+	// IdempotencyService lo guarda cifrado con AES-GCM y lo descifra al repetirlo.
+	ResponseBody []byte    `bson:"response_body,omitempty"`
+	CreatedAt    time.Time `bson:"created_at"`
+	// LockedUntil limita cuánto se espera a una petición en curso; si el servidor que la atendía
+	// se detuvo, pasado ese momento otro reintento puede reclamar la clave
+	LockedUntil time.Time `bson:"locked_until"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ImportFormat es el formato de un archivo de importación de usuarios
+type ImportFormat string
+
+// Formatos de importación soportados
+const (
+	ImportCSV    ImportFormat = "csv"
+	ImportNDJSON ImportFormat = "ndjson"
+)
+
+// ImportStatus es el estado de un job de importación
+type ImportStatus string
+
+// Estados de un job de importación
+const (
+	ImportPending   ImportStatus = "pending"
+	ImportRunning   ImportStatus = "running"
+	ImportCompleted ImportStatus = "completed"
+	ImportFailed    ImportStatus = "failed" // El archivo no se pudo procesar hasta el final
+)
+
+// ImportColumns son los campos de CreateUserRequest a los que se puede asignar una columna CSV
+var ImportColumns = []string{"name", "email", "age", "phone", "address", "password", "roles"}
+
+// ImportQuery representa los parámetros de una importación, enviados en el formulario o en la query
+type ImportQuery struct {
+	Format    string `form:"format" binding:"omitempty,oneof=csv ndjson"`
+	DryRun    bool   `form:"dry_run"`
+	Async     bool   `form:"async"`
+	Mapping   string `form:"mapping"`   // Objeto JSON columna CSV -> campo, ej. {"Correo": "email"}
+	Delimiter string `form:"delimiter"` // Separador de columnas CSV (default: ",")
+}
+
+// ImportOptions contiene las opciones validadas de una importación
+type ImportOptions struct {
+	Format     ImportFormat
+	DryRun     bool
+	Mapping    map[string]string // Nombre de columna CSV -> campo del usuario
+	Delimiter  rune
+	AllowRoles bool   // false: se rechazan las filas que asignan roles
+	FileName   string // Nombre original del archivo, solo informativo
+}
+
+// ImportRejection representa una fila rechazada con sus errores y su contenido original
+type ImportRejection struct {
+	ID     primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	JobID  primitive.ObjectID `json:"-" bson:"job_id,omitempty"`
+	Line   int                `json:"line" bson:"line" example:"3"` // Línea del archivo (la cabecera CSV es la 1)
+	Error  string             `json:"error" bson:"error" example:"email must be a valid email"`
+	Errors []FieldError       `json:"errors,omitempty" bson:"errors,omitempty"`
+	Record []string           `json:"record,omitempty" bson:"record,omitempty"` // Columnas de la fila CSV
+	Raw    string             `json:"raw,omitempty" bson:"raw,omitempty"`       // Línea NDJSON
+	// ExpiresAt coincide con la del job: MongoDB elimina ambos al mismo tiempo
+	ExpiresAt time.Time `json:"-" bson:"expires_at,omitempty"`
+}
+
+// ImportStats cuenta las filas procesadas de una importación
+type ImportStats struct {
+	Processed int64 `json:"processed" bson:"processed" example:"120"`
+	Created   int64 `json:"created" bson:"created" example:"117"` // En dry_run, filas que se habrían creado
+	Rejected  int64 `json:"rejected" bson:"rejected" example:"3"`
+}
+
+// ImportResult representa la respuesta de una importación síncrona
+type ImportResult struct {
+	DryRun bool `json:"dry_run" example:"false"`
+	ImportStats
+	Rejections []ImportRejection `json:"rejections"`
+}
+
+// ImportJob representa una importación asíncrona en la colección import_jobs
+type ImportJob struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty" example:"507f1f77bcf86cd799439011"`
+	Status      ImportStatus       `json:"status" bson:"status" example:"running"`
+	Format      ImportFormat       `json:"format" bson:"format" example:"csv"`
+	DryRun      bool               `json:"dry_run" bson:"dry_run" example:"false"`
+	FileName    string             `json:"file_name,omitempty" bson:"file_name,omitempty" example:"users.csv"`
+	Header      []string           `json:"-" bson:"header,omitempty"` // Cabecera CSV, para el reporte de filas rechazadas
+	CreatedBy   string             `json:"created_by,omitempty" bson:"created_by,omitempty" example:"507f191e810c19729de860ea"`
+	ImportStats `bson:",inline"`
+	Error       string     `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at" bson:"created_at" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt   time.Time  `json:"updated_at" bson:"updated_at" example:"2023-01-01T00:00:05Z"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty" bson:"finished_at,omitempty" example:"2023-01-01T00:01:00Z"`
+	ExpiresAt   time.Time  `json:"expires_at" bson:"expires_at" example:"2023-01-08T00:00:00Z"` // El job y su reporte se eliminan en esta fecha
+}
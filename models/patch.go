@@ -0,0 +1,68 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+// Media types aceptados por PATCH /users/:id
+const (
+	MIMEMergePatch = "application/merge-patch+json" // RFC 7396
+	MIMEJSONPatch  = "application/json-patch+json"  // RFC 6902
+)
+
+// UserPatch es un documento de modificación parcial de un usuario
+type UserPatch struct {
+	ContentType string
+	Body        []byte
+}
+
+// NewUserPatch crea el patch validando que el media type sea uno de los soportados
+func NewUserPatch(contentType string, body []byte) (UserPatch, error) {
+	switch contentType {
+	case MIMEMergePatch, MIMEJSONPatch:
+		return UserPatch{ContentType: contentType, Body: body}, nil
+	default:
+		return UserPatch{}, fmt.Errorf("%w: use %s or %s", ErrUnsupportedMediaType, MIMEMergePatch, MIMEJSONPatch)
+	}
+}
+
+// Apply aplica el patch sobre los campos editables actuales y retorna el resultado.
+// El resultado debe validarse con las mismas reglas que una petición de actualización.
+func (p UserPatch) Apply(current ReplaceUserRequest) (ReplaceUserRequest, error) {
+	document, err := json.Marshal(current)
+	if err != nil {
+		return ReplaceUserRequest{}, err
+	}
+
+	var patched []byte
+	if p.ContentType == MIMEJSONPatch {
+		operations, decodeErr := jsonpatch.DecodePatch(p.Body)
+		if decodeErr != nil {
+			return ReplaceUserRequest{}, invalidPatch(decodeErr)
+		}
+		patched, err = operations.Apply(document)
+	} else {
+		patched, err = jsonpatch.MergePatch(document, p.Body)
+	}
+	if err != nil {
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return ReplaceUserRequest{}, fmt.Errorf("%w: %v", ErrPatchTestFailed, err)
+		}
+		return ReplaceUserRequest{}, invalidPatch(err)
+	}
+
+	var result ReplaceUserRequest
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return ReplaceUserRequest{}, invalidPatch(err)
+	}
+	return result, nil
+}
+
+// invalidPatch convierte un error de aplicación del patch en un error de validación
+func invalidPatch(err error) error {
+	return &ValidationError{Message: "invalid patch: " + err.Error()}
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitPolicy define un token bucket: se reponen Limit peticiones cada Period y se
+// acumulan como máximo Burst, que permite ráfagas cortas por encima del ritmo medio
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int64
+	Period time.Duration
+	Burst  int64
+}
+
+// Rate retorna los tokens que se reponen por segundo
+func (p RateLimitPolicy) Rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// timeUntil retorna cuánto tarda el bucket en pasar de tokens a target tokens
+func (p RateLimitPolicy) timeUntil(tokens, target float64) time.Duration {
+	if tokens >= target {
+		return 0
+	}
+	return time.Duration((target - tokens) / p.Rate() * float64(time.Second))
+}
+
+// FillTime retorna cuánto tarda el bucket en llenarse si le quedan tokens; pasado ese tiempo
+// el estado del bucket puede descartarse
+func (p RateLimitPolicy) FillTime(tokens float64) time.Duration {
+	return p.timeUntil(tokens, float64(p.Burst))
+}
+
+// RateLimitResult es el resultado de consumir un token de un bucket
+type RateLimitResult struct {
+	Policy     RateLimitPolicy
+	Allowed    bool
+	Remaining  int64         // Peticiones que aún pueden hacerse sin esperar
+	Reset      time.Duration // Tiempo hasta que el bucket vuelve a estar lleno
+	RetryAfter time.Duration // Tiempo hasta que haya un token disponible; 0 si Allowed
+}
+
+// NewRateLimitResult calcula el resultado a partir de los tokens que quedan en el bucket
+// tras atender (o rechazar) la petición
+func NewRateLimitResult(policy RateLimitPolicy, allowed bool, tokens float64) *RateLimitResult {
+	result := &RateLimitResult{
+		Policy:    policy,
+		Allowed:   allowed,
+		Remaining: int64(math.Floor(tokens)),
+		Reset:     policy.FillTime(tokens),
+	}
+	if !allowed {
+		result.RetryAfter = policy.timeUntil(tokens, 1)
+	}
+	return result
+}
+
+// ParseRateLimitPolicies convierte una lista como "auth=10/1m,users.write=60/1m:20" en
+// políticas por nombre. Cada política es <nombre>=<peticiones>/<periodo>[:<ráfaga>]; sin
+// ráfaga se permiten hasta <peticiones> seguidas. Vacío o "none" no define ninguna política.
+func ParseRateLimitPolicies(spec string) (map[string]RateLimitPolicy, error) {
+	policies := map[string]RateLimitPolicy{}
+	if spec = strings.TrimSpace(spec); spec == "" || spec == "none" {
+		return policies, nil
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		policy, err := parseRateLimitPolicy(strings.TrimSpace(item))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit policy %q: %w", item, err)
+		}
+		policies[policy.Name] = policy
+	}
+	return policies, nil
+}
+
+// parseRateLimitPolicy convierte una política con el formato <nombre>=<peticiones>/<periodo>[:<ráfaga>]
+func parseRateLimitPolicy(item string) (RateLimitPolicy, error) {
+	name, quota, found := strings.Cut(item, "=")
+	if !found || name == "" {
+		return RateLimitPolicy{}, fmt.Errorf("expected <name>=<requests>/<period>[:<burst>]")
+	}
+	quota, burst, hasBurst := strings.Cut(quota, ":")
+	limitText, periodText, found := strings.Cut(quota, "/")
+	if !found {
+		return RateLimitPolicy{}, fmt.Errorf("expected <requests>/<period>")
+	}
+
+	policy := RateLimitPolicy{Name: name}
+	var err error
+	if policy.Limit, err = strconv.ParseInt(limitText, 10, 64); err != nil || policy.Limit <= 0 {
+		return RateLimitPolicy{}, fmt.Errorf("requests must be a positive integer")
+	}
+	if policy.Period, err = time.ParseDuration(periodText); err != nil || policy.Period <= 0 {
+		return RateLimitPolicy{}, fmt.Errorf("period must be a positive duration such as 1m")
+	}
+	policy.Burst = policy.Limit
+	if hasBurst {
+		if policy.Burst, err = strconv.ParseInt(burst, 10, 64); err != nil || policy.Burst <= 0 {
+			return RateLimitPolicy{}, fmt.Errorf("burst must be a positive integer")
+		}
+	}
+	return policy, nil
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshToken representa un token de refresco emitido y su estado dentro de una familia de rotación
+type RefreshToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	TokenID   string             `bson:"token_id"`  // Claim jti del JWT
+	FamilyID  string             `bson:"family_id"` // Identifica la sesión: todos los tokens rotados a partir del mismo login
+	UserID    string             `bson:"user_id"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	CreatedAt time.Time          `bson:"created_at"`
+	RotatedAt *time.Time         `bson:"rotated_at,omitempty"`
+	RevokedAt *time.Time         `bson:"revoked_at,omitempty"`
+}
+
+// RefreshTokenRequest representa el cuerpo de las peticiones que reciben un token de refresco
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+}
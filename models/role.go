@@ -0,0 +1,93 @@
+package models
+
+// Role representa un rol de usuario
+type Role string
+
+// Roles disponibles
+const (
+	RoleAdmin   Role = "admin"   // Acceso total a todos los usuarios
+	RoleSupport Role = "support" // Soporte: puede consultar y editar cualquier usuario (sin ver sus datos personales), pero no eliminarlos
+	RoleSelf    Role = "self"    // Usuario normal: solo puede consultar y editar su propio registro
+)
+
+// Permission representa una acción que se puede realizar sobre los usuarios
+type Permission string
+
+// Permisos disponibles
+const (
+	PermUsersRead        Permission = "users:read"
+	PermUsersWrite       Permission = "users:write"
+	PermUsersDelete      Permission = "users:delete"
+	PermUsersReadPII     Permission = "users:read:pii"
+	PermUsersManageRoles Permission = "users:write:roles"
+	PermAuditRead        Permission = "audit:read"
+)
+
+// rolePermissions define los permisos que cada rol tiene sobre cualquier usuario
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin:   {PermUsersRead, PermUsersWrite, PermUsersDelete, PermUsersReadPII, PermUsersManageRoles, PermAuditRead},
+	RoleSupport: {PermUsersRead, PermUsersWrite},
+}
+
+// selfPermissions define los permisos que cada rol tiene únicamente sobre su propio registro
+var selfPermissions = map[Role][]Permission{
+	RoleSelf: {PermUsersRead, PermUsersWrite, PermUsersReadPII},
+}
+
+// IsValid indica si el rol es uno de los roles conocidos
+func (r Role) IsValid() bool {
+	switch r {
+	case RoleAdmin, RoleSupport, RoleSelf:
+		return true
+	}
+	return false
+}
+
+// HasPermission indica si alguno de los roles concede el permiso sobre cualquier usuario
+func HasPermission(roles []Role, permission Permission) bool {
+	return grants(rolePermissions, roles, permission)
+}
+
+// HasSelfPermission indica si alguno de los roles concede el permiso sobre el propio registro
+func HasSelfPermission(roles []Role, permission Permission) bool {
+	return HasPermission(roles, permission) || grants(selfPermissions, roles, permission)
+}
+
+// SameRoles indica si ambas listas asignan los mismos roles, sin importar el orden ni los
+// repetidos. Una lista vacía equivale a RoleSelf, como en User.GetRoles.
+func SameRoles(a, b []Role) bool {
+	setA, setB := roleSet(a), roleSet(b)
+	if len(setA) != len(setB) {
+		return false
+	}
+	for role := range setA {
+		if !setB[role] {
+			return false
+		}
+	}
+	return true
+}
+
+// roleSet convierte una lista de roles en un conjunto
+func roleSet(roles []Role) map[Role]bool {
+	if len(roles) == 0 {
+		roles = []Role{RoleSelf}
+	}
+	set := make(map[Role]bool, len(roles))
+	for _, role := range roles {
+		set[role] = true
+	}
+	return set
+}
+
+// grants busca el permiso en la tabla de permisos de los roles dados
+func grants(table map[Role][]Permission, roles []Role, permission Permission) bool {
+	for _, role := range roles {
+		for _, granted := range table[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
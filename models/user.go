@@ -1,32 +1,54 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // User representa el modelo de usuario en la base de datos
 type User struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty" example:"507f1f77bcf86cd799439011"`
-	UUID      string            `json:"uuid" bson:"uuid" example:"550e8400-e29b-41d4-a716-446655440000"`
-	Name      string            `json:"name" bson:"name" binding:"required" example:"John Doe"`
-	Email     string            `json:"email" bson:"email" binding:"required,email" example:"john.doe@example.com"`
-	Age       int               `json:"age" bson:"age" binding:"required,min=1,max=120" example:"30"`
-	Phone     string            `json:"phone" bson:"phone" example:"+1234567890"`
-	Address   string            `json:"address" bson:"address" example:"123 Main St, City, Country"`
-	CreatedAt time.Time         `json:"created_at" bson:"created_at" example:"2023-01-01T00:00:00Z"`
-	UpdatedAt time.Time         `json:"updated_at" bson:"updated_at" example:"2023-01-01T00:00:00Z"`
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty" example:"507f1f77bcf86cd799439011"`
+	UUID           string             `json:"uuid" bson:"uuid" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Name           string             `json:"name" bson:"name" binding:"required" example:"John Doe"`
+	Email          string             `json:"email" bson:"email" binding:"required,email" example:"john.doe@example.com"`
+	EmailCanonical string             `json:"-" bson:"email_canonical,omitempty"` // Forma canónica del email, usada en búsquedas y en el índice único
+	NameLower      string             `json:"-" bson:"name_lower,omitempty"`      // Nombre en minúsculas, usado por el filtro name con su índice
+	Age            int                `json:"age" bson:"age" binding:"required,min=1,max=120" example:"30"`
+	Phone          string             `json:"phone" bson:"phone" example:"+1234567890"`
+	Address        string             `json:"address" bson:"address" example:"123 Main St, City, Country"`
+	Roles          []Role             `json:"roles" bson:"roles,omitempty" example:"self"`
+	PasswordHash   string             `json:"-" bson:"password_hash,omitempty"`   // Solo el hash bcrypt, nunca se expone en JSON
+	Version        int64              `json:"version" bson:"version" example:"1"` // Se incrementa en cada actualización (control de concurrencia optimista)
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at" example:"2023-01-01T00:00:00Z"`
+	DeletedAt      *time.Time         `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"` // Borrado lógico: el usuario está en la papelera
+	DeletedBy      string             `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"` // ID del usuario que lo eliminó
 }
 
 // CreateUserRequest representa la estructura para crear un usuario
 type CreateUserRequest struct {
+	Name     string `json:"name" binding:"required" example:"John Doe"`
+	Email    string `json:"email" binding:"required,email" example:"john.doe@example.com"`
+	Age      int    `json:"age" binding:"required,min=1,max=120" example:"30"`
+	Phone    string `json:"phone" example:"+1234567890"`
+	Address  string `json:"address" example:"123 Main St, City, Country"`
+	Password string `json:"password,omitempty" binding:"omitempty,min=8,maxbytes=72" example:"S3cure-passw0rd"`
+	Roles    []Role `json:"roles,omitempty" binding:"omitempty,dive,oneof=admin support self" example:"self"`
+}
+
+// ReplaceUserRequest representa la estructura para reemplazar un usuario completo (PUT).
+// Los campos opcionales omitidos se vacían; si no se envían roles se conservan los actuales.
+type ReplaceUserRequest struct {
 	Name    string `json:"name" binding:"required" example:"John Doe"`
 	Email   string `json:"email" binding:"required,email" example:"john.doe@example.com"`
 	Age     int    `json:"age" binding:"required,min=1,max=120" example:"30"`
 	Phone   string `json:"phone" example:"+1234567890"`
 	Address string `json:"address" example:"123 Main St, City, Country"`
+	Roles   []Role `json:"roles,omitempty" binding:"omitempty,dive,oneof=admin support self" example:"self"`
 }
 
 // UpdateUserRequest representa la estructura para actualizar un usuario
@@ -36,32 +58,53 @@ type UpdateUserRequest struct {
 	Age     int    `json:"age" binding:"omitempty,min=1,max=120" example:"30"`
 	Phone   string `json:"phone" example:"+1234567890"`
 	Address string `json:"address" example:"123 Main St, City, Country"`
+	Roles   []Role `json:"roles,omitempty" binding:"omitempty,dive,oneof=admin support self" example:"self"`
 }
 
 // UserResponse representa la respuesta de usuario
 type UserResponse struct {
-	ID        string    `json:"id" example:"507f1f77bcf86cd799439011"`
-	UUID      string    `json:"uuid" example:"550e8400-e29b-41d4-a716-446655440000"`
-	Name      string    `json:"name" example:"John Doe"`
-	Email     string    `json:"email" example:"john.doe@example.com"`
-	Age       int       `json:"age" example:"30"`
-	Phone     string    `json:"phone" example:"+1234567890"`
-	Address   string    `json:"address" example:"123 Main St, City, Country"`
-	CreatedAt time.Time `json:"created_at" example:"2023-01-01T00:00:00Z"`
-	UpdatedAt time.Time `json:"updated_at" example:"2023-01-01T00:00:00Z"`
+	ID        string     `json:"id" example:"507f1f77bcf86cd799439011"`
+	UUID      string     `json:"uuid" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Name      string     `json:"name" example:"John Doe"`
+	Email     string     `json:"email" example:"john.doe@example.com"`
+	Age       int        `json:"age" example:"30"`
+	Phone     string     `json:"phone" example:"+1234567890"`
+	Address   string     `json:"address" example:"123 Main St, City, Country"`
+	Roles     []Role     `json:"roles" example:"self"`
+	Version   int64      `json:"version" example:"1"`
+	CreatedAt time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt time.Time  `json:"updated_at" example:"2023-01-01T00:00:00Z"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
 }
 
 // UsersResponse representa la respuesta de lista de usuarios
 type UsersResponse struct {
-	Users []UserResponse `json:"users"`
-	Total int64          `json:"total" example:"10"`
+	Users      []UserResponse `json:"users"`
+	Total      *int64         `json:"total,omitempty" example:"10"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	PrevCursor string         `json:"prev_cursor,omitempty"`
 }
 
 // ErrorResponse representa la estructura de respuesta de error
 type ErrorResponse struct {
-	Error   string `json:"error" example:"Error message"`
-	Message string `json:"message" example:"Detailed error message"`
-	Code    int    `json:"code" example:"400"`
+	Error     string `json:"error" example:"Error message"`
+	Message   string `json:"message" example:"Detailed error message"`
+	Code      int    `json:"code" example:"400"`
+	RequestID string `json:"request_id,omitempty" example:"0b7e4d1c-6f1a-4a55-9d0e-5f0c3e1b2a9d"`
+}
+
+// ProblemDetails representa un error con el formato application/problem+json (RFC 7807).
+// Se usa cuando el cliente lo solicita en el header Accept; en otro caso se responde con ErrorResponse.
+type ProblemDetails struct {
+	Type     string       `json:"type" example:"/problems/validation-error"`
+	Title    string       `json:"title" example:"Validation Error"`
+	Status   int          `json:"status" example:"400"`
+	Detail   string       `json:"detail,omitempty" example:"email must be a valid email"`
+	Instance string       `json:"instance,omitempty" example:"/api/v1/users"`
+	Errors   []FieldError `json:"errors,omitempty"`
+	// RequestID es una extensión del RFC 7807 con el identificador de la petición
+	RequestID string `json:"request_id,omitempty" example:"0b7e4d1c-6f1a-4a55-9d0e-5f0c3e1b2a9d"`
 }
 
 // SuccessResponse representa la estructura de respuesta exitosa
@@ -73,13 +116,20 @@ type SuccessResponse struct {
 // NewUser crea una nueva instancia de usuario
 func NewUser(req CreateUserRequest) *User {
 	now := time.Now()
+	roles := req.Roles
+	if len(roles) == 0 {
+		roles = []Role{RoleSelf}
+	}
 	return &User{
 		UUID:      uuid.New().String(),
 		Name:      req.Name,
+		NameLower: LowerName(req.Name),
 		Email:     req.Email,
 		Age:       req.Age,
 		Phone:     req.Phone,
 		Address:   req.Address,
+		Roles:     roles,
+		Version:   1,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
@@ -95,15 +145,82 @@ func (u *User) ToResponse() UserResponse {
 		Age:       u.Age,
 		Phone:     u.Phone,
 		Address:   u.Address,
+		Roles:     u.GetRoles(),
+		Version:   u.Version,
 		CreatedAt: u.CreatedAt,
 		UpdatedAt: u.UpdatedAt,
+		DeletedAt: u.DeletedAt,
+		DeletedBy: u.DeletedBy,
+	}
+}
+
+// LowerName retorna la forma del nombre que se guarda en name_lower: sin espacios alrededor y en
+// minúsculas, para que el filtro por prefijo no distinga mayúsculas y pueda usar un índice
+func LowerName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// IsValidUserID indica si id tiene el formato de un ObjectID o de un UUID
+func IsValidUserID(id string) bool {
+	if primitive.IsValidObjectID(id) {
+		return true
+	}
+	_, err := uuid.Parse(id)
+	return err == nil
+}
+
+// GetRoles retorna los roles del usuario; los usuarios sin roles asignados son RoleSelf
+func (u *User) GetRoles() []Role {
+	if len(u.Roles) == 0 {
+		return []Role{RoleSelf}
+	}
+	return u.Roles
+}
+
+// MaskPII oculta los datos personales (email, teléfono y dirección) de la respuesta
+func (r UserResponse) MaskPII() UserResponse {
+	r.Email = MaskEmail(r.Email)
+	r.Phone = MaskPhone(r.Phone)
+	r.Address = MaskAddress(r.Address)
+	return r
+}
+
+// MaskEmail oculta la parte local de un email conservando la primera letra y el dominio
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		if email == "" {
+			return ""
+		}
+		return "***"
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+// MaskPhone oculta un teléfono conservando solo los últimos 4 dígitos
+func MaskPhone(phone string) string {
+	if len(phone) <= 4 {
+		if phone == "" {
+			return ""
+		}
+		return "***"
+	}
+	return "***" + phone[len(phone)-4:]
+}
+
+// MaskAddress oculta la dirección completa
+func MaskAddress(address string) string {
+	if address == "" {
+		return ""
 	}
+	return "***"
 }
 
 // Update actualiza los campos del usuario
 func (u *User) Update(req UpdateUserRequest) {
 	if req.Name != "" {
 		u.Name = req.Name
+		u.NameLower = LowerName(req.Name)
 	}
 	if req.Email != "" {
 		u.Email = req.Email
@@ -117,6 +234,52 @@ func (u *User) Update(req UpdateUserRequest) {
 	if req.Address != "" {
 		u.Address = req.Address
 	}
+	if len(req.Roles) > 0 {
+		u.Roles = req.Roles
+	}
 	u.UpdatedAt = time.Now()
-} 
+}
 
+// Replace reemplaza todos los campos editables del usuario con los de la petición
+func (u *User) Replace(req ReplaceUserRequest) {
+	u.Name = req.Name
+	u.NameLower = LowerName(req.Name)
+	u.Email = req.Email
+	u.Age = req.Age
+	u.Phone = req.Phone
+	u.Address = req.Address
+	if req.Roles != nil {
+		u.Roles = req.Roles
+	}
+	u.UpdatedAt = time.Now()
+}
+
+// ToReplaceRequest retorna los campos editables del usuario, usados como documento base de un PATCH
+func (u *User) ToReplaceRequest() ReplaceUserRequest {
+	return ReplaceUserRequest{
+		Name:    u.Name,
+		Email:   u.Email,
+		Age:     u.Age,
+		Phone:   u.Phone,
+		Address: u.Address,
+		Roles:   u.GetRoles(),
+	}
+}
+
+// SetPassword calcula y guarda el hash bcrypt de la contraseña
+func (u *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword verifica si la contraseña coincide con el hash guardado
+func (u *User) CheckPassword(password string) bool {
+	if u.PasswordHash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
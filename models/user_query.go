@@ -0,0 +1,125 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UserListQuery representa los parámetros de consulta aceptados por GET /users
+type UserListQuery struct {
+	Page        string     `form:"page"`
+	Limit       string     `form:"limit"`
+	Name        string     `form:"name" binding:"max=100"`
+	Email       string     `form:"email" binding:"max=100"`
+	MinAge      *int       `form:"min_age" binding:"omitempty,min=0,max=150"`
+	MaxAge      *int       `form:"max_age" binding:"omitempty,min=0,max=150"`
+	CreatedFrom *time.Time `form:"created_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo   *time.Time `form:"created_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Search      string     `form:"q" binding:"max=100"`
+	Sort        string     `form:"sort"`
+
+	// Cursor activa la paginación por cursor; vacío ("?cursor=") pide la primera página
+	Cursor       *string `form:"cursor"`
+	IncludeTotal *bool   `form:"include_total"`
+}
+
+// PIIParams retorna los parámetros de la consulta que filtran u ordenan por datos personales:
+// email, la búsqueda de texto (que incluye email y dirección) y el orden por email.
+// Usarlos requiere el permiso users:read:pii, porque los resultados revelarían esos datos.
+func (q UserListQuery) PIIParams() []string {
+	var params []string
+	if q.Email != "" {
+		params = append(params, "email")
+	}
+	if q.Search != "" {
+		params = append(params, "q")
+	}
+	for _, part := range strings.Split(q.Sort, ",") {
+		if userPIISortFields[strings.TrimPrefix(strings.TrimSpace(part), "-")] {
+			params = append(params, "sort")
+			break
+		}
+	}
+	return params
+}
+
+// UserEmailQuery representa los parámetros de consulta aceptados por GET /users/by-email
+type UserEmailQuery struct {
+	Email string `form:"email" binding:"required,email"`
+}
+
+// UserCursor es la posición (created_at, _id) de un usuario dentro del listado
+type UserCursor struct {
+	CreatedAt time.Time
+	ID        primitive.ObjectID
+	Backward  bool // true si el cursor pide la página anterior a la posición
+}
+
+// SortField representa un campo de ordenamiento ya validado
+type SortField struct {
+	Field string // Nombre del campo en MongoDB
+	Desc  bool
+}
+
+// UserFilter contiene los criterios de búsqueda validados del listado de usuarios.
+// Los valores vacíos (o nil) no filtran.
+type UserFilter struct {
+	Name        string // Coincidencia parcial sin distinguir mayúsculas
+	Email       string // Coincidencia parcial sin distinguir mayúsculas
+	MinAge      *int
+	MaxAge      *int
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Search      string // Búsqueda de texto libre sobre nombre, email y dirección
+	Sort        []SortField
+	Deleted     bool // true para listar la papelera (usuarios eliminados) en lugar de los activos
+}
+
+// userSortFields es la lista blanca de campos por los que se permite ordenar (nombre JSON -> campo en MongoDB)
+var userSortFields = map[string]string{
+	"name":       "name",
+	"email":      "email",
+	"age":        "age",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// userPIISortFields son los campos de ordenamiento que contienen datos personales
+var userPIISortFields = map[string]bool{"email": true}
+
+// DefaultUserSort es el orden usado cuando no se indica sort: los más recientes primero
+var DefaultUserSort = []SortField{{Field: "created_at", Desc: true}}
+
+// ParseUserSort convierte un parámetro como "name,-age" en campos de ordenamiento.
+// Un "-" al inicio indica orden descendente; solo se aceptan campos de la lista blanca.
+func ParseUserSort(sort string) ([]SortField, error) {
+	if strings.TrimSpace(sort) == "" {
+		return DefaultUserSort, nil
+	}
+
+	var fields []SortField
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(sort, ",") {
+		part = strings.TrimSpace(part)
+		desc := strings.HasPrefix(part, "-")
+		name := strings.TrimPrefix(part, "-")
+
+		field, ok := userSortFields[name]
+		if !ok {
+			return nil, NewValidationError(FieldError{
+				Field:   "sort",
+				Message: fmt.Sprintf("cannot sort by %q; allowed fields: name, email, age, created_at, updated_at", name),
+			})
+		}
+		if seen[field] {
+			continue
+		}
+		seen[field] = true
+		fields = append(fields, SortField{Field: field, Desc: desc})
+	}
+
+	return fields, nil
+}
@@ -6,8 +6,7 @@ db = db.getSiblingDB('users_brm_dev');
 // Drop existing collections to start fresh
 db.users.drop();
 
-// Create index on email field for uniqueness
-db.users.createIndex({ "email": 1 }, { unique: true });
+// Los índices (email único sin distinguir mayúsculas, uuid único, etc.) los crea la API al iniciar
 
 // Insert 10 test users
 db.users.insertMany([
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-users-api/models"
+)
+
+// AuditRepository maneja las operaciones de base de datos para los eventos de auditoría
+type AuditRepository struct {
+	collection *mongo.Collection
+}
+
+// NewAuditRepository crea una nueva instancia del repositorio de auditoría
+func NewAuditRepository(db *mongo.Database) *AuditRepository {
+	return &AuditRepository{
+		collection: db.Collection("audit_events"),
+	}
+}
+
+// EnsureIndexes crea los índices de la colección si no existen
+func (r *AuditRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// Historial de un usuario
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "user_uuid", Value: 1}, {Key: "timestamp", Value: -1}}},
+		// Consultas globales por actor, acción o rango de fechas
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "timestamp", Value: -1}}},
+	})
+	return err
+}
+
+// Create registra un nuevo evento de auditoría
+func (r *AuditRepository) Create(ctx context.Context, event *models.AuditEvent) error {
+	result, err := r.collection.InsertOne(ctx, event)
+	if err != nil {
+		return err
+	}
+	event.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// Find obtiene los eventos que cumplen el filtro, del más reciente al más antiguo
+func (r *AuditRepository) Find(ctx context.Context, filter models.AuditFilter, page, limit int64) ([]models.AuditEvent, error) {
+	findOptions := options.Find().
+		SetSkip((page - 1) * limit).
+		SetLimit(limit).
+		SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, buildAuditQuery(filter), findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []models.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Count retorna el número de eventos que cumplen el filtro
+func (r *AuditRepository) Count(ctx context.Context, filter models.AuditFilter) (int64, error) {
+	return r.collection.CountDocuments(ctx, buildAuditQuery(filter))
+}
+
+// buildAuditQuery traduce el filtro de auditoría a una consulta de MongoDB
+func buildAuditQuery(filter models.AuditFilter) bson.M {
+	query := bson.M{}
+	if primitive.IsValidObjectID(filter.UserID) {
+		query["user_id"] = filter.UserID
+	} else if filter.UserID != "" {
+		query["user_uuid"] = filter.UserID
+	}
+	if filter.ActorID != "" {
+		query["actor_id"] = filter.ActorID
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+
+	timestamp := bson.M{}
+	if filter.From != nil {
+		timestamp["$gte"] = *filter.From
+	}
+	if filter.To != nil {
+		timestamp["$lte"] = *filter.To
+	}
+	if len(timestamp) > 0 {
+		query["timestamp"] = timestamp
+	}
+
+	return query
+}
+
+// AuditRepositoryInterface define los métodos del repositorio de auditoría para facilitar el testing
+type AuditRepositoryInterface interface {
+	Create(ctx context.Context, event *models.AuditEvent) error
+	Find(ctx context.Context, filter models.AuditFilter, page, limit int64) ([]models.AuditEvent, error)
+	Count(ctx context.Context, filter models.AuditFilter) (int64, error)
+}
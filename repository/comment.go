@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+
+	"go-users-api/reqctx"
+)
+
+// queryComment retorna el comentario con el que se etiquetan las operaciones de una petición, o
+// "" si el contexto no tiene identificador. MongoDB lo muestra en el profiler, en currentOp y en
+// el log de consultas lentas, lo que permite relacionar una consulta con la petición que la originó.
+func queryComment(ctx context.Context) string {
+	requestID := reqctx.RequestID(ctx)
+	if requestID == "" {
+		return ""
+	}
+	return "request_id:" + requestID
+}
+
+// withComment añade el comentario de la petición a las opciones de lectura (Find, FindOne, Count)
+func withComment[O interface{ SetComment(string) O }](ctx context.Context, opts O) O {
+	if comment := queryComment(ctx); comment != "" {
+		return opts.SetComment(comment)
+	}
+	return opts
+}
+
+// withCommentValue añade el comentario de la petición a las opciones de las operaciones que
+// aceptan cualquier valor como comentario (escrituras, Distinct, FindOneAndUpdate)
+func withCommentValue[O interface{ SetComment(interface{}) O }](ctx context.Context, opts O) O {
+	if comment := queryComment(ctx); comment != "" {
+		return opts.SetComment(comment)
+	}
+	return opts
+}
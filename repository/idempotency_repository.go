@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-users-api/models"
+)
+
+// IdempotencyRepository maneja las operaciones de base de datos de las claves de idempotencia
+type IdempotencyRepository struct {
+	collection *mongo.Collection
+}
+
+// NewIdempotencyRepository crea una nueva instancia del repositorio de claves de idempotencia
+func NewIdempotencyRepository(db *mongo.Database) *IdempotencyRepository {
+	return &IdempotencyRepository{
+		collection: db.Collection("idempotency_keys"),
+	}
+}
+
+// EnsureIndexes crea los índices de la colección si no existen
+func (r *IdempotencyRepository) EnsureIndexes(ctx context.Context) error {
+	// MongoDB elimina automáticamente las claves expiradas
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// Acquire guarda record si su clave está libre: no existe, expiró (el índice TTL tarda hasta un
+// minuto en borrarla) o pertenece a una petición en curso abandonada. Si la clave está ocupada
+// retorna el registro existente. Es atómico gracias a la unicidad de _id: de varias peticiones
+// simultáneas con la misma clave, solo una la obtiene.
+func (r *IdempotencyRepository) Acquire(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	reclaimable := bson.M{
+		"_id": record.ID,
+		"$or": bson.A{
+			bson.M{"expires_at": bson.M{"$lte": record.CreatedAt}},
+			bson.M{"status": models.IdempotencyInProgress, "locked_until": bson.M{"$lte": record.CreatedAt}},
+		},
+	}
+
+	// Si la clave existe y no puede reclamarse, el upsert intenta insertar otro documento con el mismo _id y falla
+	_, err := r.collection.ReplaceOne(ctx, reclaimable, record, withCommentValue(ctx, options.Replace().SetUpsert(true)))
+	if err == nil {
+		return nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	var existing models.IdempotencyRecord
+	err = r.collection.FindOne(ctx, bson.M{"_id": record.ID}, withComment(ctx, options.FindOne())).Decode(&existing)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// La petición original falló y liberó la clave entre ambas operaciones
+		return r.Acquire(ctx, record)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// Complete guarda la respuesta de la petición que obtuvo la clave
+func (r *IdempotencyRepository) Complete(ctx context.Context, record *models.IdempotencyRecord) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": record.ID, "fingerprint": record.Fingerprint, "status": models.IdempotencyInProgress},
+		bson.M{"$set": bson.M{
+			"status":           models.IdempotencyCompleted,
+			"response_status":  record.ResponseStatus,
+			"response_headers": record.ResponseHeaders,
+			"response_body":    record.ResponseBody,
+			"expires_at":       record.ExpiresAt,
+		}},
+		withCommentValue(ctx, options.Update()),
+	)
+	return err
+}
+
+// Release libera la clave de una petición en curso para que pueda reintentarse
+func (r *IdempotencyRepository) Release(ctx context.Context, id string, fingerprint string) error {
+	_, err := r.collection.DeleteOne(ctx,
+		bson.M{"_id": id, "fingerprint": fingerprint, "status": models.IdempotencyInProgress},
+		withCommentValue(ctx, options.Delete()),
+	)
+	return err
+}
+
+// DeleteCompleted elimina la respuesta guardada de la clave para que la siguiente petición la
+// ejecute de nuevo. No afecta a una petición en curso que ya haya reclamado la clave.
+func (r *IdempotencyRepository) DeleteCompleted(ctx context.Context, id string) error {
+	_, err := r.collection.DeleteOne(ctx,
+		bson.M{"_id": id, "status": models.IdempotencyCompleted},
+		withCommentValue(ctx, options.Delete()),
+	)
+	return err
+}
+
+// IdempotencyRepositoryInterface define la interfaz del repositorio de claves de idempotencia
+type IdempotencyRepositoryInterface interface {
+	Acquire(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	Complete(ctx context.Context, record *models.IdempotencyRecord) error
+	Release(ctx context.Context, id string, fingerprint string) error
+	DeleteCompleted(ctx context.Context, id string) error
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-users-api/models"
+)
+
+// ImportRepository maneja las operaciones de base de datos de los jobs de importación y sus filas rechazadas
+type ImportRepository struct {
+	jobs       *mongo.Collection
+	rejections *mongo.Collection
+}
+
+// NewImportRepository crea una nueva instancia del repositorio de importaciones
+func NewImportRepository(db *mongo.Database) *ImportRepository {
+	return &ImportRepository{
+		jobs:       db.Collection("import_jobs"),
+		rejections: db.Collection("import_rejections"),
+	}
+}
+
+// EnsureIndexes crea los índices de las colecciones si no existen
+func (r *ImportRepository) EnsureIndexes(ctx context.Context) error {
+	// MongoDB elimina automáticamente los jobs y las filas rechazadas expirados
+	expiration := mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)}
+
+	if _, err := r.jobs.Indexes().CreateOne(ctx, expiration); err != nil {
+		return err
+	}
+	_, err := r.rejections.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "job_id", Value: 1}, {Key: "line", Value: 1}}},
+		expiration,
+	})
+	return err
+}
+
+// CreateJob registra un nuevo job de importación
+func (r *ImportRepository) CreateJob(ctx context.Context, job *models.ImportJob) error {
+	now := time.Now()
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	result, err := r.jobs.InsertOne(ctx, job)
+	if err != nil {
+		return err
+	}
+	job.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// UpdateJob guarda el estado y el progreso del job
+func (r *ImportRepository) UpdateJob(ctx context.Context, job *models.ImportJob) error {
+	job.UpdatedAt = time.Now()
+
+	result, err := r.jobs.ReplaceOne(ctx, bson.M{"_id": job.ID}, job)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return models.ErrImportNotFound
+	}
+	return nil
+}
+
+// GetJob obtiene un job de importación por su ID
+func (r *ImportRepository) GetJob(ctx context.Context, id string) (*models.ImportJob, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, models.ErrImportNotFound
+	}
+
+	var job models.ImportJob
+	if err := r.jobs.FindOne(ctx, bson.M{"_id": objectID}).Decode(&job); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, models.ErrImportNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// AddRejections guarda las filas rechazadas de un job
+func (r *ImportRepository) AddRejections(ctx context.Context, job *models.ImportJob, rejections []models.ImportRejection) error {
+	if len(rejections) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, len(rejections))
+	for i := range rejections {
+		rejection := rejections[i]
+		rejection.JobID = job.ID
+		rejection.ExpiresAt = job.ExpiresAt
+		documents[i] = rejection
+	}
+	_, err := r.rejections.InsertMany(ctx, documents)
+	return err
+}
+
+// EachRejection recorre las filas rechazadas de un job en el orden del archivo sin cargarlas
+// todas en memoria. Se detiene en el primer error de fn.
+func (r *ImportRepository) EachRejection(ctx context.Context, jobID primitive.ObjectID, fn func(rejection models.ImportRejection) error) error {
+	findOptions := options.Find().SetSort(bson.D{{Key: "line", Value: 1}})
+	cursor, err := r.rejections.Find(ctx, bson.M{"job_id": jobID}, findOptions)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var rejection models.ImportRejection
+		if err := cursor.Decode(&rejection); err != nil {
+			return err
+		}
+		if err := fn(rejection); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// ImportRepositoryInterface define los métodos del repositorio de importaciones para facilitar el testing
+type ImportRepositoryInterface interface {
+	CreateJob(ctx context.Context, job *models.ImportJob) error
+	UpdateJob(ctx context.Context, job *models.ImportJob) error
+	GetJob(ctx context.Context, id string) (*models.ImportJob, error)
+	AddRejections(ctx context.Context, job *models.ImportJob, rejections []models.ImportRejection) error
+	EachRejection(ctx context.Context, jobID primitive.ObjectID, fn func(rejection models.ImportRejection) error) error
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go-users-api/metrics"
+	"go-users-api/models"
+	"go-users-api/tracing"
+)
+
+// observedUserRepository envuelve un UserRepositoryInterface para medir cada operación: registra
+// su latencia y sus errores en las métricas de MongoDB y crea un span con el nombre del método,
+// del que cuelgan los spans de los comandos de MongoDB que ejecuta
+type observedUserRepository struct {
+	repo UserRepositoryInterface
+}
+
+// NewObservedUserRepository envuelve el repositorio para medir y trazar cada una de sus operaciones
+func NewObservedUserRepository(repo UserRepositoryInterface) UserRepositoryInterface {
+	return &observedUserRepository{repo: repo}
+}
+
+// start inicia la medición de una operación. La función retornada la termina con el error
+// nombrado del método; los resultados esperados, como un usuario inexistente, no cuentan como error.
+func (r *observedUserRepository) start(ctx context.Context, operation string) (context.Context, func(err *error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "UserRepository."+operation)
+	return ctx, func(err *error) {
+		metrics.MongoOperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+		if *err != nil && !models.IsExpected(*err) {
+			metrics.MongoOperationErrors.WithLabelValues(operation).Inc()
+		}
+		tracing.End(span, err)
+	}
+}
+
+func (r *observedUserRepository) Create(ctx context.Context, user *models.User) (err error) {
+	ctx, done := r.start(ctx, "Create")
+	defer done(&err)
+	return r.repo.Create(ctx, user)
+}
+
+func (r *observedUserRepository) GetByID(ctx context.Context, id string) (_ *models.User, err error) {
+	ctx, done := r.start(ctx, "GetByID")
+	defer done(&err)
+	return r.repo.GetByID(ctx, id)
+}
+
+func (r *observedUserRepository) GetByUUID(ctx context.Context, uuid string) (_ *models.User, err error) {
+	ctx, done := r.start(ctx, "GetByUUID")
+	defer done(&err)
+	return r.repo.GetByUUID(ctx, uuid)
+}
+
+func (r *observedUserRepository) GetAll(ctx context.Context, filter models.UserFilter, page, limit int64) (_ []models.User, err error) {
+	ctx, done := r.start(ctx, "GetAll")
+	defer done(&err)
+	return r.repo.GetAll(ctx, filter, page, limit)
+}
+
+func (r *observedUserRepository) GetPage(ctx context.Context, filter models.UserFilter, cursor *models.UserCursor, limit int64) (_ []models.User, err error) {
+	ctx, done := r.start(ctx, "GetPage")
+	defer done(&err)
+	return r.repo.GetPage(ctx, filter, cursor, limit)
+}
+
+func (r *observedUserRepository) Count(ctx context.Context, filter models.UserFilter) (_ int64, err error) {
+	ctx, done := r.start(ctx, "Count")
+	defer done(&err)
+	return r.repo.Count(ctx, filter)
+}
+
+// Each no cuenta como error de MongoDB el error que retorne fn
+func (r *observedUserRepository) Each(ctx context.Context, filter models.UserFilter, fn func(user *models.User) error) error {
+	ctx, done := r.start(ctx, "Each")
+	var fnErr error
+	err := r.repo.Each(ctx, filter, func(user *models.User) error {
+		fnErr = fn(user)
+		return fnErr
+	})
+
+	mongoErr := err
+	if fnErr != nil {
+		mongoErr = nil
+	}
+	done(&mongoErr)
+	return err
+}
+
+func (r *observedUserRepository) Update(ctx context.Context, id string, user *models.User) (err error) {
+	ctx, done := r.start(ctx, "Update")
+	defer done(&err)
+	return r.repo.Update(ctx, id, user)
+}
+
+func (r *observedUserRepository) Delete(ctx context.Context, id string, deletedBy string) (err error) {
+	ctx, done := r.start(ctx, "Delete")
+	defer done(&err)
+	return r.repo.Delete(ctx, id, deletedBy)
+}
+
+func (r *observedUserRepository) GetDeletedByID(ctx context.Context, id string) (_ *models.User, err error) {
+	ctx, done := r.start(ctx, "GetDeletedByID")
+	defer done(&err)
+	return r.repo.GetDeletedByID(ctx, id)
+}
+
+func (r *observedUserRepository) Restore(ctx context.Context, id string) (_ *models.User, err error) {
+	ctx, done := r.start(ctx, "Restore")
+	defer done(&err)
+	return r.repo.Restore(ctx, id)
+}
+
+func (r *observedUserRepository) Purge(ctx context.Context, deletedBefore time.Time) (_ int64, err error) {
+	ctx, done := r.start(ctx, "Purge")
+	defer done(&err)
+	return r.repo.Purge(ctx, deletedBefore)
+}
+
+func (r *observedUserRepository) GetByEmail(ctx context.Context, canonicalEmail string) (_ *models.User, err error) {
+	ctx, done := r.start(ctx, "GetByEmail")
+	defer done(&err)
+	return r.repo.GetByEmail(ctx, canonicalEmail)
+}
+
+func (r *observedUserRepository) ExistsByEmail(ctx context.Context, canonicalEmail string) (_ bool, err error) {
+	ctx, done := r.start(ctx, "ExistsByEmail")
+	defer done(&err)
+	return r.repo.ExistsByEmail(ctx, canonicalEmail)
+}
+
+func (r *observedUserRepository) FindTakenEmails(ctx context.Context, canonicalEmails []string) (_ []string, err error) {
+	ctx, done := r.start(ctx, "FindTakenEmails")
+	defer done(&err)
+	return r.repo.FindTakenEmails(ctx, canonicalEmails)
+}
+
+func (r *observedUserRepository) GetByIDs(ctx context.Context, ids []string) (_ []models.User, err error) {
+	ctx, done := r.start(ctx, "GetByIDs")
+	defer done(&err)
+	return r.repo.GetByIDs(ctx, ids)
+}
+
+func (r *observedUserRepository) BulkCreate(ctx context.Context, users []*models.User, atomic bool) (_ []error, err error) {
+	ctx, done := r.start(ctx, "BulkCreate")
+	defer done(&err)
+	return r.repo.BulkCreate(ctx, users, atomic)
+}
+
+func (r *observedUserRepository) BulkUpdate(ctx context.Context, users []*models.User, atomic bool) (_ []error, err error) {
+	ctx, done := r.start(ctx, "BulkUpdate")
+	defer done(&err)
+	return r.repo.BulkUpdate(ctx, users, atomic)
+}
+
+func (r *observedUserRepository) BulkDelete(ctx context.Context, users []*models.User, deletedBy string, atomic bool) (_ []error, err error) {
+	ctx, done := r.start(ctx, "BulkDelete")
+	defer done(&err)
+	return r.repo.BulkDelete(ctx, users, deletedBy, atomic)
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-users-api/models"
+)
+
+// RateLimitRepository guarda los token buckets en MongoDB para que todas las réplicas de la API
+// compartan los límites de cada cliente
+type RateLimitRepository struct {
+	collection *mongo.Collection
+}
+
+// NewRateLimitRepository crea una nueva instancia del repositorio de límites en MongoDB
+func NewRateLimitRepository(db *mongo.Database) *RateLimitRepository {
+	return &RateLimitRepository{
+		collection: db.Collection("rate_limits"),
+	}
+}
+
+// EnsureIndexes crea los índices de la colección si no existen
+func (r *RateLimitRepository) EnsureIndexes(ctx context.Context) error {
+	// MongoDB elimina los buckets que ya estarían llenos, equivalentes a uno nuevo
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// Take consume un token del bucket key en una sola operación atómica. Los tokens se reponen con
+// el reloj del servidor de MongoDB ($$NOW) para que las réplicas no dependan de sus propios relojes.
+func (r *RateLimitRepository) Take(ctx context.Context, key string, policy models.RateLimitPolicy) (*models.RateLimitResult, error) {
+	burst := float64(policy.Burst)
+	elapsed := bson.D{{Key: "$divide", Value: bson.A{
+		bson.D{{Key: "$subtract", Value: bson.A{"$$NOW", bson.D{{Key: "$ifNull", Value: bson.A{"$updated_at", "$$NOW"}}}}}},
+		1000,
+	}}}
+	refilled := bson.D{{Key: "$min", Value: bson.A{burst, bson.D{{Key: "$add", Value: bson.A{
+		bson.D{{Key: "$ifNull", Value: bson.A{"$tokens", burst}}},
+		bson.D{{Key: "$multiply", Value: bson.A{elapsed, policy.Rate()}}},
+	}}}}}}
+
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{{Key: "tokens", Value: refilled}}}},
+		{{Key: "$set", Value: bson.D{{Key: "allowed", Value: bson.D{{Key: "$gte", Value: bson.A{"$tokens", 1}}}}}}},
+		{{Key: "$set", Value: bson.D{
+			{Key: "tokens", Value: bson.D{{Key: "$cond", Value: bson.A{
+				"$allowed", bson.D{{Key: "$subtract", Value: bson.A{"$tokens", 1}}}, "$tokens",
+			}}}},
+			{Key: "updated_at", Value: "$$NOW"},
+			{Key: "expires_at", Value: bson.D{{Key: "$add", Value: bson.A{"$$NOW", policy.FillTime(0).Milliseconds()}}}},
+		}}},
+	}
+	opts := withCommentValue(ctx, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After))
+
+	var bucket struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&bucket)
+	if mongo.IsDuplicateKeyError(err) {
+		// Dos réplicas crearon el bucket a la vez; el reintento actualiza el que ganó
+		err = r.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&bucket)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return models.NewRateLimitResult(policy, bucket.Allowed, bucket.Tokens), nil
+}
+
+// memoryRateLimitSweepInterval es cada cuánto se descartan los buckets en memoria ya llenos
+const memoryRateLimitSweepInterval = time.Minute
+
+// rateLimitBucket es el estado de un token bucket en memoria
+type rateLimitBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	expiresAt time.Time // A partir de entonces el bucket estaría lleno y puede descartarse
+}
+
+// MemoryRateLimitRepository guarda los token buckets en memoria. Cada réplica de la API aplica
+// los límites por separado, por lo que solo es adecuado con una única instancia.
+type MemoryRateLimitRepository struct {
+	mu        sync.Mutex
+	buckets   map[string]*rateLimitBucket
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimitRepository crea un repositorio de límites en memoria
+func NewMemoryRateLimitRepository() *MemoryRateLimitRepository {
+	return &MemoryRateLimitRepository{
+		buckets:   make(map[string]*rateLimitBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Take consume un token del bucket key
+func (r *MemoryRateLimitRepository) Take(ctx context.Context, key string, policy models.RateLimitPolicy) (*models.RateLimitResult, error) {
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.lastSweep) >= memoryRateLimitSweepInterval {
+		for bucketKey, bucket := range r.buckets {
+			if !now.Before(bucket.expiresAt) {
+				delete(r.buckets, bucketKey)
+			}
+		}
+		r.lastSweep = now
+	}
+
+	bucket, found := r.buckets[key]
+	if !found {
+		bucket = &rateLimitBucket{tokens: float64(policy.Burst), updatedAt: now}
+		r.buckets[key] = bucket
+	}
+	bucket.tokens = min(float64(policy.Burst), bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*policy.Rate())
+	bucket.updatedAt = now
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+	bucket.expiresAt = now.Add(policy.FillTime(bucket.tokens))
+
+	return models.NewRateLimitResult(policy, allowed, bucket.tokens), nil
+}
+
+// RateLimitRepositoryInterface define la interfaz de los almacenes de token buckets
+type RateLimitRepositoryInterface interface {
+	Take(ctx context.Context, key string, policy models.RateLimitPolicy) (*models.RateLimitResult, error)
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-users-api/models"
+)
+
+// ErrRefreshTokenNotFound se retorna cuando el token de refresco no está registrado
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+// RefreshTokenRepository maneja las operaciones de base de datos para tokens de refresco
+type RefreshTokenRepository struct {
+	collection *mongo.Collection
+}
+
+// NewRefreshTokenRepository crea una nueva instancia del repositorio de tokens de refresco
+func NewRefreshTokenRepository(db *mongo.Database) *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		collection: db.Collection("refresh_tokens"),
+	}
+}
+
+// EnsureIndexes crea los índices de la colección si no existen
+func (r *RefreshTokenRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "family_id", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		// MongoDB elimina automáticamente los tokens expirados
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// Create registra un nuevo token de refresco
+func (r *RefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	_, err := r.collection.InsertOne(ctx, token)
+	return err
+}
+
+// GetByTokenID obtiene un token de refresco por su jti
+func (r *RefreshTokenRepository) GetByTokenID(ctx context.Context, tokenID string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.collection.FindOne(ctx, bson.M{"token_id": tokenID}).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkRotated marca el token como usado de forma atómica. Retorna false si ya había sido
+// rotado o revocado, lo que indica que el token se está reutilizando.
+func (r *RefreshTokenRepository) MarkRotated(ctx context.Context, tokenID string) (bool, error) {
+	filter := bson.M{
+		"token_id":   tokenID,
+		"rotated_at": bson.M{"$exists": false},
+		"revoked_at": bson.M{"$exists": false},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"rotated_at": time.Now()}})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// RevokeFamily revoca todos los tokens de una sesión
+func (r *RefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	return r.revoke(ctx, bson.M{"family_id": familyID})
+}
+
+// RevokeAllForUser revoca todas las sesiones de un usuario
+func (r *RefreshTokenRepository) RevokeAllForUser(ctx context.Context, userID string) error {
+	return r.revoke(ctx, bson.M{"user_id": userID})
+}
+
+// revoke marca como revocados los tokens que coinciden con el filtro
+func (r *RefreshTokenRepository) revoke(ctx context.Context, filter bson.M) error {
+	filter["revoked_at"] = bson.M{"$exists": false}
+	_, err := r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	return err
+}
+
+// RefreshTokenRepositoryInterface define los métodos del repositorio de tokens de refresco para facilitar el testing y la inyección de dependencias
+type RefreshTokenRepositoryInterface interface {
+	Create(ctx context.Context, token *models.RefreshToken) error
+	GetByTokenID(ctx context.Context, tokenID string) (*models.RefreshToken, error)
+	MarkRotated(ctx context.Context, tokenID string) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeAllForUser(ctx context.Context, userID string) error
+}
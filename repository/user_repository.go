@@ -3,8 +3,12 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -13,6 +17,29 @@ import (
 	"go-users-api/models"
 )
 
+// emailIndexName es el nombre del índice único de email canónico
+const emailIndexName = "users_email_canonical_unique"
+
+// emailIndexKey es el campo del índice único de email; sus errores de clave duplicada se reconocen
+// por el keyPattern que informa el servidor
+const emailIndexKey = "email_canonical"
+
+// legacyEmailIndexName es el índice único anterior sobre (email, deleted_at) con collation.
+// EnsureIndexes lo elimina: ya no protege la unicidad y rechazaría escrituras válidas.
+const legacyEmailIndexName = "users_email_unique"
+
+// Códigos de error de MongoDB al eliminar un índice que no existe o de una colección que no existe
+const (
+	codeNamespaceNotFound = 26
+	codeIndexNotFound     = 27
+)
+
+// migrationBatchSize es el número de usuarios que MigrateEmails y MigrateNames actualizan en cada escritura
+const migrationBatchSize = 500
+
+// exportBatchSize es el número de usuarios que Each pide a MongoDB en cada lote del cursor
+const exportBatchSize = 1000
+
 // UserRepository maneja las operaciones de base de datos para usuarios
 type UserRepository struct {
 	collection *mongo.Collection
@@ -27,26 +54,27 @@ func NewUserRepository(db *mongo.Database) *UserRepository {
 
 // Create inserta un nuevo usuario en la base de datos
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
-	result, err := r.collection.InsertOne(ctx, user)
+	result, err := r.collection.InsertOne(ctx, user, withCommentValue(ctx, options.InsertOne()))
 	if err != nil {
-		return err
+		return mapWriteError(err)
 	}
 	user.ID = result.InsertedID.(primitive.ObjectID)
 	return nil
 }
 
-// GetByID obtiene un usuario por su ID
+// GetByID obtiene un usuario por su ID (ObjectID o UUID)
 func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
-	objectID, err := primitive.ObjectIDFromHex(id)
+	filter, err := userIDFilter(id)
 	if err != nil {
-		return nil, errors.New("invalid user ID")
+		return nil, err
 	}
+	filter["deleted_at"] = nil
 
 	var user models.User
-	err = r.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+	err = r.collection.FindOne(ctx, filter, withComment(ctx, options.FindOne())).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("user not found")
+			return nil, models.ErrNotFound
 		}
 		return nil, err
 	}
@@ -55,12 +83,17 @@ func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User,
 }
 
 // GetByUUID obtiene un usuario por su UUID
-func (r *UserRepository) GetByUUID(ctx context.Context, uuid string) (*models.User, error) {
+func (r *UserRepository) GetByUUID(ctx context.Context, id string) (*models.User, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return nil, models.ErrInvalidID
+	}
+
 	var user models.User
-	err := r.collection.FindOne(ctx, bson.M{"uuid": uuid}).Decode(&user)
+	err = r.collection.FindOne(ctx, bson.M{"uuid": parsed.String(), "deleted_at": nil}, withComment(ctx, options.FindOne())).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("user not found")
+			return nil, models.ErrNotFound
 		}
 		return nil, err
 	}
@@ -68,97 +101,381 @@ func (r *UserRepository) GetByUUID(ctx context.Context, uuid string) (*models.Us
 	return &user, nil
 }
 
-// GetAll obtiene todos los usuarios con paginación
-func (r *UserRepository) GetAll(ctx context.Context, page, limit int64) ([]models.User, int64, error) {
-	// Contar total de documentos
-	total, err := r.collection.CountDocuments(ctx, bson.M{})
+// EnsureIndexes crea los índices de la colección si no existen: las restricciones de unicidad
+// y los índices que respaldan los filtros y ordenamientos del listado
+func (r *UserRepository) EnsureIndexes(ctx context.Context) error {
+	if err := r.dropLegacyIndexes(ctx); err != nil {
+		return err
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// Email canónico único entre los usuarios activos. Los usuarios activos no tienen
+		// deleted_at, por lo que comparten la clave nula; los de la papelera tienen cada uno
+		// su fecha de eliminación y no bloquean que otro usuario se registre con su email.
+		{
+			Keys:    bson.D{{Key: "email_canonical", Value: 1}, {Key: "deleted_at", Value: 1}},
+			Options: options.Index().SetName(emailIndexName).SetUnique(true),
+		},
+		// UUID único; los documentos antiguos sin uuid quedan fuera del índice
+		{
+			Keys: bson.D{{Key: "uuid", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"uuid": bson.M{"$type": "string"}}),
+		},
+		{Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+		// Filtro name por prefijo; el filtro email usa el índice único de email canónico
+		{Keys: bson.D{{Key: "name_lower", Value: 1}, {Key: "deleted_at", Value: 1}}},
+		{Keys: bson.D{{Key: "age", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "deleted_at", Value: 1}}},
+		// Índice de texto para la búsqueda libre (q)
+		{
+			Keys:    bson.D{{Key: "name", Value: "text"}, {Key: "email", Value: "text"}, {Key: "address", Value: "text"}},
+			Options: options.Index().SetName("users_text_search"),
+		},
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		// El índice único no se puede crear mientras haya emails canónicos repetidos: se informa
+		// cuáles son para poder resolverlos antes de volver a arrancar
+		return r.duplicateEmailsError(ctx, err)
+	}
+	return err
+}
+
+// duplicateEmailsReportLimit es el máximo de emails repetidos que se listan cuando falla el índice único
+const duplicateEmailsReportLimit = 20
+
+// duplicateEmailsError busca los usuarios que comparten email canónico y fecha de eliminación y
+// retorna un error que lista sus emails e IDs. Si la búsqueda falla se retorna indexErr.
+func (r *UserRepository) duplicateEmailsError(ctx context.Context, indexErr error) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"email": "$email_canonical", "deleted_at": "$deleted_at"},
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$sort", Value: bson.M{"_id.email": 1}}},
+		{{Key: "$limit", Value: duplicateEmailsReportLimit}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
 	if err != nil {
-		return nil, 0, err
+		return indexErr
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		Key struct {
+			Email string `bson:"email"`
+		} `bson:"_id"`
+		IDs []primitive.ObjectID `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil || len(groups) == 0 {
+		return indexErr
 	}
 
+	duplicates := make([]string, 0, len(groups))
+	for _, group := range groups {
+		ids := make([]string, 0, len(group.IDs))
+		for _, id := range group.IDs {
+			ids = append(ids, id.Hex())
+		}
+		duplicates = append(duplicates, fmt.Sprintf("%s (ids %s)", group.Key.Email, strings.Join(ids, ", ")))
+	}
+	return fmt.Errorf("unique email index cannot be created, users share a canonical email (showing up to %d): %s: %w",
+		duplicateEmailsReportLimit, strings.Join(duplicates, "; "), indexErr)
+}
+
+// dropLegacyIndexes elimina los índices que versiones anteriores crearon y que ya no se usan.
+// Un índice o una colección inexistente no es un error.
+func (r *UserRepository) dropLegacyIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().DropOne(ctx, legacyEmailIndexName)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Code == codeIndexNotFound || cmdErr.Code == codeNamespaceNotFound) {
+		return nil
+	}
+	return err
+}
+
+// GetAll obtiene los usuarios que cumplen el filtro, ordenados y paginados por página
+func (r *UserRepository) GetAll(ctx context.Context, filter models.UserFilter, page, limit int64) ([]models.User, error) {
 	// Configurar opciones de paginación
 	skip := (page - 1) * limit
 	findOptions := options.Find().
 		SetSkip(skip).
 		SetLimit(limit).
-		SetSort(bson.D{{Key: "created_at", Value: -1}})
+		SetSort(buildUserSort(filter.Sort))
+
+	return r.find(ctx, buildUserQuery(filter), findOptions)
+}
+
+// GetPage obtiene hasta limit usuarios a continuación del cursor en el orden (created_at, _id) descendente.
+// Sin cursor retorna la primera página. Con un cursor hacia atrás los usuarios se retornan
+// desde el más cercano al cursor, es decir, en orden ascendente.
+func (r *UserRepository) GetPage(ctx context.Context, filter models.UserFilter, cursor *models.UserCursor, limit int64) ([]models.User, error) {
+	query := buildUserQuery(filter)
+	direction := -1
+
+	if cursor != nil {
+		operator := "$lt"
+		if cursor.Backward {
+			operator, direction = "$gt", 1
+		}
+
+		// Keyset: (created_at, _id) estrictamente después de la posición del cursor
+		query["$or"] = bson.A{
+			bson.M{"created_at": bson.M{operator: cursor.CreatedAt}},
+			bson.M{"created_at": cursor.CreatedAt, "_id": bson.M{operator: cursor.ID}},
+		}
+	}
+
+	findOptions := options.Find().
+		SetLimit(limit).
+		SetSort(bson.D{{Key: "created_at", Value: direction}, {Key: "_id", Value: direction}})
+
+	return r.find(ctx, query, findOptions)
+}
+
+// Count retorna el número de usuarios que cumplen el filtro
+func (r *UserRepository) Count(ctx context.Context, filter models.UserFilter) (int64, error) {
+	return r.collection.CountDocuments(ctx, buildUserQuery(filter), withComment(ctx, options.Count()))
+}
 
-	// Ejecutar consulta
-	cursor, err := r.collection.Find(ctx, bson.M{}, findOptions)
+// Each recorre todos los usuarios que cumplen el filtro, en su orden, decodificándolos de uno
+// en uno desde el cursor para usar memoria constante. Se detiene en el primer error de fn.
+func (r *UserRepository) Each(ctx context.Context, filter models.UserFilter, fn func(user *models.User) error) error {
+	// Ordenar toda la colección puede superar el límite de memoria de MongoDB para ordenar
+	findOptions := options.Find().
+		SetSort(buildUserSort(filter.Sort)).
+		SetBatchSize(exportBatchSize).
+		SetAllowDiskUse(true)
+
+	cursor, err := r.collection.Find(ctx, buildUserQuery(filter), withComment(ctx, findOptions))
 	if err != nil {
-		return nil, 0, err
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+		if err := fn(&user); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// find ejecuta la consulta y decodifica los usuarios resultantes
+func (r *UserRepository) find(ctx context.Context, query bson.M, findOptions *options.FindOptions) ([]models.User, error) {
+	cursor, err := r.collection.Find(ctx, query, withComment(ctx, findOptions))
+	if err != nil {
+		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	// Decodificar resultados
 	var users []models.User
 	if err = cursor.All(ctx, &users); err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	return users, total, nil
+	return users, nil
 }
 
-// Update actualiza un usuario existente
+// buildUserQuery traduce el filtro a una consulta de MongoDB.
+// Los textos del usuario se escapan para que nunca se interpreten como expresiones regulares u operadores.
+// name y email buscan por prefijo sobre campos guardados en minúsculas, de modo que la expresión
+// regular anclada y sin opciones se resuelve como un rango del índice en lugar de recorrer la colección.
+func buildUserQuery(filter models.UserFilter) bson.M {
+	// Los usuarios eliminados solo aparecen al listar la papelera
+	query := bson.M{"deleted_at": nil}
+	if filter.Deleted {
+		query["deleted_at"] = bson.M{"$ne": nil}
+	}
+
+	if filter.Name != "" {
+		query["name_lower"] = prefixRegex(models.LowerName(filter.Name))
+	}
+	if filter.Email != "" {
+		query["email_canonical"] = prefixRegex(strings.ToLower(filter.Email))
+	}
+
+	age := bson.M{}
+	if filter.MinAge != nil {
+		age["$gte"] = *filter.MinAge
+	}
+	if filter.MaxAge != nil {
+		age["$lte"] = *filter.MaxAge
+	}
+	if len(age) > 0 {
+		query["age"] = age
+	}
+
+	createdAt := bson.M{}
+	if filter.CreatedFrom != nil {
+		createdAt["$gte"] = *filter.CreatedFrom
+	}
+	if filter.CreatedTo != nil {
+		createdAt["$lte"] = *filter.CreatedTo
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+
+	if filter.Search != "" {
+		query["$text"] = bson.M{"$search": filter.Search}
+	}
+
+	return query
+}
+
+// prefixRegex crea una búsqueda de los valores que empiezan por value
+func prefixRegex(value string) primitive.Regex {
+	return primitive.Regex{Pattern: "^" + regexp.QuoteMeta(value)}
+}
+
+// buildUserSort traduce los campos de ordenamiento, agregando _id como desempate para un orden estable
+func buildUserSort(fields []models.SortField) bson.D {
+	if len(fields) == 0 {
+		fields = models.DefaultUserSort
+	}
+
+	sort := make(bson.D, 0, len(fields)+1)
+	for _, field := range fields {
+		direction := 1
+		if field.Desc {
+			direction = -1
+		}
+		sort = append(sort, bson.E{Key: field.Field, Value: direction})
+	}
+	return append(sort, bson.E{Key: "_id", Value: sort[len(sort)-1].Value})
+}
+
+// Update actualiza un usuario existente solo si su versión no cambió desde que se leyó.
+// Si otro proceso lo modificó retorna models.ErrVersionConflict; si tiene éxito incrementa user.Version.
 func (r *UserRepository) Update(ctx context.Context, id string, user *models.User) error {
-	objectID, err := primitive.ObjectIDFromHex(id)
+	idFilter, err := userIDFilter(id)
 	if err != nil {
-		return errors.New("invalid user ID")
+		return err
 	}
 
 	// Actualizar timestamp
 	user.UpdatedAt = time.Now()
 
-	// Preparar documento de actualización
+	filter := versionFilter(idFilter, user.Version)
+	result, err := r.collection.UpdateOne(ctx, filter, updateDocument(user), withCommentValue(ctx, options.Update()))
+	if err != nil {
+		return mapWriteError(err)
+	}
+
+	if result.MatchedCount == 0 {
+		// Distinguir entre un usuario inexistente y uno modificado por otro proceso
+		delete(filter, "version")
+		count, err := r.collection.CountDocuments(ctx, filter, withComment(ctx, options.Count()))
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return models.ErrNotFound
+		}
+		return models.ErrVersionConflict
+	}
+
+	user.Version++
+	return nil
+}
+
+// Delete mueve el usuario a la papelera (borrado lógico) registrando quién lo eliminó
+func (r *UserRepository) Delete(ctx context.Context, id string, deletedBy string) error {
+	filter, err := userIDFilter(id)
+	if err != nil {
+		return err
+	}
+	filter["deleted_at"] = nil
+
+	now := time.Now()
 	update := bson.M{
-		"$set": bson.M{
-			"name":       user.Name,
-			"email":      user.Email,
-			"age":        user.Age,
-			"phone":      user.Phone,
-			"address":    user.Address,
-			"updated_at": user.UpdatedAt,
-		},
+		"$set": bson.M{"deleted_at": now, "deleted_by": deletedBy, "updated_at": now},
+		"$inc": bson.M{"version": 1},
 	}
 
-	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	result, err := r.collection.UpdateOne(ctx, filter, update, withCommentValue(ctx, options.Update()))
 	if err != nil {
 		return err
 	}
 
 	if result.MatchedCount == 0 {
-		return errors.New("user not found")
+		return models.ErrNotFound
 	}
 
 	return nil
 }
 
-// Delete elimina un usuario por su ID
-func (r *UserRepository) Delete(ctx context.Context, id string) error {
-	objectID, err := primitive.ObjectIDFromHex(id)
+// GetDeletedByID obtiene un usuario de la papelera por su ID
+func (r *UserRepository) GetDeletedByID(ctx context.Context, id string) (*models.User, error) {
+	filter, err := userIDFilter(id)
 	if err != nil {
-		return errors.New("invalid user ID")
+		return nil, err
 	}
+	filter["deleted_at"] = bson.M{"$ne": nil}
 
-	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": objectID})
+	var user models.User
+	err = r.collection.FindOne(ctx, filter, withComment(ctx, options.FindOne())).Decode(&user)
 	if err != nil {
-		return err
+		if err == mongo.ErrNoDocuments {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
 	}
 
-	if result.DeletedCount == 0 {
-		return errors.New("user not found")
+	return &user, nil
+}
+
+// Restore saca un usuario de la papelera y retorna el usuario restaurado
+func (r *UserRepository) Restore(ctx context.Context, id string) (*models.User, error) {
+	filter, err := userIDFilter(id)
+	if err != nil {
+		return nil, err
 	}
+	filter["deleted_at"] = bson.M{"$ne": nil}
 
-	return nil
+	update := bson.M{
+		"$unset": bson.M{"deleted_at": "", "deleted_by": ""},
+		"$set":   bson.M{"updated_at": time.Now()},
+		"$inc":   bson.M{"version": 1},
+	}
+	findOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var user models.User
+	err = r.collection.FindOneAndUpdate(ctx, filter, update, withCommentValue(ctx, findOptions)).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, models.ErrNotFound
+		}
+		return nil, mapWriteError(err)
+	}
+
+	return &user, nil
 }
 
-// GetByEmail obtiene un usuario por su email
-func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+// Purge elimina definitivamente los usuarios que están en la papelera desde antes de la fecha indicada
+func (r *UserRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{"deleted_at": bson.M{"$lte": deletedBefore}}, withCommentValue(ctx, options.Delete()))
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// GetByEmail obtiene un usuario activo por la forma canónica de su email
+func (r *UserRepository) GetByEmail(ctx context.Context, canonicalEmail string) (*models.User, error) {
 	var user models.User
-	err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	err := r.collection.FindOne(ctx, bson.M{"email_canonical": canonicalEmail, "deleted_at": nil}, withComment(ctx, options.FindOne())).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("user not found")
+			return nil, models.ErrNotFound
 		}
 		return nil, err
 	}
@@ -166,23 +483,473 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 	return &user, nil
 }
 
-// ExistsByEmail verifica si existe un usuario con el email dado
-func (r *UserRepository) ExistsByEmail(ctx context.Context, email string) (bool, error) {
-	count, err := r.collection.CountDocuments(ctx, bson.M{"email": email})
+// ExistsByEmail verifica si existe un usuario activo con la forma canónica de email dada.
+// Es solo una comprobación previa: la unicidad la garantiza el índice único de email.
+func (r *UserRepository) ExistsByEmail(ctx context.Context, canonicalEmail string) (bool, error) {
+	countOptions := options.Count().SetLimit(1)
+	count, err := r.collection.CountDocuments(ctx, bson.M{"email_canonical": canonicalEmail, "deleted_at": nil}, withComment(ctx, countOptions))
 	if err != nil {
 		return false, err
 	}
 	return count > 0, nil
 }
 
+// FindTakenEmails retorna cuáles de las formas canónicas de email dadas pertenecen a un usuario activo
+func (r *UserRepository) FindTakenEmails(ctx context.Context, canonicalEmails []string) ([]string, error) {
+	taken, err := r.collection.Distinct(ctx, "email_canonical", bson.M{
+		"email_canonical": bson.M{"$in": canonicalEmails},
+		"deleted_at":      nil,
+	}, withCommentValue(ctx, options.Distinct()))
+	if err != nil {
+		return nil, err
+	}
+
+	emails := make([]string, 0, len(taken))
+	for _, email := range taken {
+		if value, ok := email.(string); ok {
+			emails = append(emails, value)
+		}
+	}
+	return emails, nil
+}
+
+// MigrateEmails normaliza el email de los usuarios existentes y guarda su forma canónica.
+// Sin all solo procesa los usuarios que aún no tienen email_canonical; con all recalcula todos,
+// por ejemplo tras cambiar las reglas de normalización. Retorna el número de usuarios modificados.
+func (r *UserRepository) MigrateEmails(ctx context.Context, canonical func(email string) string, all bool) (int64, error) {
+	query := bson.M{}
+	if !all {
+		query["email_canonical"] = bson.M{"$exists": false}
+	}
+	findOptions := options.Find().SetProjection(bson.M{"email": 1, "email_canonical": 1})
+
+	cursor, err := r.collection.Find(ctx, query, findOptions)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var migrated int64
+	var batch []mongo.WriteModel
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		result, err := r.collection.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		if result != nil {
+			migrated += result.ModifiedCount
+		}
+		batch = batch[:0]
+		return mapWriteError(err)
+	}
+
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return migrated, err
+		}
+
+		email := models.NormalizeEmail(user.Email)
+		canonicalEmail := canonical(email)
+		if email == user.Email && canonicalEmail == user.EmailCanonical {
+			continue
+		}
+
+		batch = append(batch, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": user.ID}).
+			SetUpdate(bson.M{
+				"$set": bson.M{"email": email, "email_canonical": canonicalEmail},
+				"$inc": bson.M{"version": 1},
+			}))
+		if len(batch) == migrationBatchSize {
+			if err := flush(); err != nil {
+				return migrated, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return migrated, err
+	}
+
+	return migrated, flush()
+}
+
+// MigrateNames guarda el nombre en minúsculas de los usuarios que aún no lo tienen, necesario para
+// el filtro name. Retorna el número de usuarios modificados.
+func (r *UserRepository) MigrateNames(ctx context.Context) (int64, error) {
+	query := bson.M{"name_lower": bson.M{"$exists": false}}
+	findOptions := options.Find().SetProjection(bson.M{"name": 1})
+
+	cursor, err := r.collection.Find(ctx, query, findOptions)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var migrated int64
+	var batch []mongo.WriteModel
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		result, err := r.collection.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		if result != nil {
+			migrated += result.ModifiedCount
+		}
+		batch = batch[:0]
+		return err
+	}
+
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return migrated, err
+		}
+
+		// Es un campo derivado: no cambia los datos del usuario, por lo que no se incrementa la versión
+		batch = append(batch, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": user.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"name_lower": models.LowerName(user.Name)}}))
+		if len(batch) == migrationBatchSize {
+			if err := flush(); err != nil {
+				return migrated, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return migrated, err
+	}
+
+	return migrated, flush()
+}
+
+// GetByIDs obtiene los usuarios activos con los IDs indicados (ObjectID o UUID).
+// Los IDs que no corresponden a ningún usuario activo simplemente no aparecen en el resultado.
+func (r *UserRepository) GetByIDs(ctx context.Context, ids []string) ([]models.User, error) {
+	var objectIDs []primitive.ObjectID
+	var uuids []string
+	for _, id := range ids {
+		filter, err := userIDFilter(id)
+		if err != nil {
+			return nil, err
+		}
+		if objectID, ok := filter["_id"].(primitive.ObjectID); ok {
+			objectIDs = append(objectIDs, objectID)
+		} else {
+			uuids = append(uuids, filter["uuid"].(string))
+		}
+	}
+
+	// Solo se incluyen las ramas con IDs: el driver codifica un slice nil como {"$in": null},
+	// que MongoDB rechaza
+	var or bson.A
+	if len(objectIDs) > 0 {
+		or = append(or, bson.M{"_id": bson.M{"$in": objectIDs}})
+	}
+	if len(uuids) > 0 {
+		or = append(or, bson.M{"uuid": bson.M{"$in": uuids}})
+	}
+	if len(or) == 0 {
+		return nil, nil
+	}
+
+	query := bson.M{"deleted_at": nil, "$or": or}
+	return r.find(ctx, query, options.Find())
+}
+
+// BulkCreate inserta los usuarios con una sola operación BulkWrite y retorna un error por usuario
+// (nil si se insertó). Con atomic las inserciones se hacen en una transacción: si alguna falla
+// no se inserta ningún usuario.
+func (r *UserRepository) BulkCreate(ctx context.Context, users []*models.User, atomic bool) ([]error, error) {
+	writes := make([]mongo.WriteModel, len(users))
+	for i, user := range users {
+		// El _id se asigna aquí porque BulkWrite no retorna los IDs insertados
+		if user.ID.IsZero() {
+			user.ID = primitive.NewObjectID()
+		}
+		writes[i] = mongo.NewInsertOneModel().SetDocument(user)
+	}
+
+	return r.bulkWrite(ctx, writes, atomic, nil)
+}
+
+// BulkUpdate guarda los campos editables de los usuarios con una sola operación BulkWrite, con el
+// mismo control de versión que Update, y retorna un error por usuario (nil si se guardó).
+// Con atomic se guardan todos o ninguno.
+func (r *UserRepository) BulkUpdate(ctx context.Context, users []*models.User, atomic bool) ([]error, error) {
+	now := time.Now()
+	writes := make([]mongo.WriteModel, len(users))
+	for i, user := range users {
+		user.UpdatedAt = now
+		writes[i] = mongo.NewUpdateOneModel().
+			SetFilter(versionFilter(bson.M{"_id": user.ID}, user.Version)).
+			SetUpdate(updateDocument(user))
+	}
+
+	itemErrs, err := r.bulkWrite(ctx, writes, atomic, r.verifyVersions(users))
+	if err != nil {
+		return nil, err
+	}
+
+	if committed(itemErrs, atomic) {
+		for i, user := range users {
+			if itemErrs[i] == nil {
+				user.Version++
+			}
+		}
+	}
+	return itemErrs, nil
+}
+
+// BulkDelete mueve los usuarios a la papelera con una sola operación BulkWrite, siempre que sigan
+// en la versión con la que se leyeron, y retorna un error por usuario (nil si se eliminó).
+// Con atomic se eliminan todos o ninguno.
+func (r *UserRepository) BulkDelete(ctx context.Context, users []*models.User, deletedBy string, atomic bool) ([]error, error) {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{"deleted_at": now, "deleted_by": deletedBy, "updated_at": now},
+		"$inc": bson.M{"version": 1},
+	}
+
+	writes := make([]mongo.WriteModel, len(users))
+	for i, user := range users {
+		writes[i] = mongo.NewUpdateOneModel().
+			SetFilter(versionFilter(bson.M{"_id": user.ID}, user.Version)).
+			SetUpdate(update)
+	}
+
+	itemErrs, err := r.bulkWrite(ctx, writes, atomic, r.verifyVersions(users))
+	if err != nil {
+		return nil, err
+	}
+
+	if committed(itemErrs, atomic) {
+		for i, user := range users {
+			if itemErrs[i] == nil {
+				user.Version++
+				user.UpdatedAt = now
+				user.DeletedAt = &now
+				user.DeletedBy = deletedBy
+			}
+		}
+	}
+	return itemErrs, nil
+}
+
+// errBulkRollback aborta la transacción de una operación atómica en la que falló algún elemento
+var errBulkRollback = errors.New("bulk write rolled back")
+
+// bulkWrite ejecuta las escrituras y retorna el error de cada una. Los errores de escritura
+// (como un email duplicado) se informan por elemento; solo los errores que impiden ejecutar la
+// operación se retornan como error general. verify, si no es nil, detecta las actualizaciones
+// que no encontraron su documento cuando BulkWrite modifica menos documentos de los esperados.
+// Con atomic las escrituras se ejecutan en una transacción que se aborta si alguna falla.
+func (r *UserRepository) bulkWrite(ctx context.Context, writes []mongo.WriteModel, atomic bool, verify func(ctx context.Context, itemErrs []error) error) ([]error, error) {
+	itemErrs := make([]error, len(writes))
+
+	run := func(ctx context.Context) error {
+		for i := range itemErrs {
+			itemErrs[i] = nil
+		}
+
+		// En modo atómico la primera falla aborta la transacción, así que no tiene sentido seguir
+		result, err := r.collection.BulkWrite(ctx, writes, withCommentValue(ctx, options.BulkWrite().SetOrdered(atomic)))
+		if err != nil {
+			var bulkErr mongo.BulkWriteException
+			if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+				return err
+			}
+			for _, writeErr := range bulkErr.WriteErrors {
+				itemErrs[writeErr.Index] = mapWriteError(writeErr.WriteError)
+			}
+			if atomic {
+				return nil
+			}
+		}
+
+		expected := int64(len(writes) - len(failedItems(itemErrs)))
+		if verify != nil && result != nil && result.MatchedCount < expected {
+			return verify(ctx, itemErrs)
+		}
+		return nil
+	}
+
+	if !atomic {
+		return itemErrs, run(ctx)
+	}
+
+	session, err := r.collection.Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if err := run(sc); err != nil {
+			return nil, err
+		}
+		if len(failedItems(itemErrs)) > 0 {
+			return nil, errBulkRollback
+		}
+		return nil, nil
+	})
+	if err != nil && !errors.Is(err, errBulkRollback) {
+		return nil, err
+	}
+	return itemErrs, nil
+}
+
+// verifyVersions retorna la verificación de bulkWrite para actualizaciones condicionadas a la
+// versión de cada usuario: las que no se aplicaron fallan con ErrVersionConflict, o con
+// ErrNotFound si el usuario ya no está activo
+func (r *UserRepository) verifyVersions(users []*models.User) func(ctx context.Context, itemErrs []error) error {
+	return func(ctx context.Context, itemErrs []error) error {
+		ids := make([]primitive.ObjectID, len(users))
+		for i, user := range users {
+			ids[i] = user.ID
+		}
+
+		findOptions := options.Find().SetProjection(bson.M{"version": 1, "deleted_at": 1})
+		current, err := r.find(ctx, bson.M{"_id": bson.M{"$in": ids}}, findOptions)
+		if err != nil {
+			return err
+		}
+		stored := make(map[primitive.ObjectID]models.User, len(current))
+		for _, user := range current {
+			stored[user.ID] = user
+		}
+
+		for i, user := range users {
+			if itemErrs[i] != nil {
+				continue
+			}
+			found, exists := stored[user.ID]
+			switch {
+			case !exists:
+				itemErrs[i] = models.ErrNotFound
+			case found.Version != user.Version+1:
+				// Otro proceso lo modificó (o eliminó) después de leerlo
+				itemErrs[i] = models.ErrVersionConflict
+			}
+		}
+		return nil
+	}
+}
+
+// failedItems retorna las posiciones de los elementos que fallaron
+func failedItems(itemErrs []error) []int {
+	var failed []int
+	for i, itemErr := range itemErrs {
+		if itemErr != nil {
+			failed = append(failed, i)
+		}
+	}
+	return failed
+}
+
+// committed indica si se aplicaron los elementos sin error: en modo atómico solo si ninguno falló
+func committed(itemErrs []error, atomic bool) bool {
+	return !atomic || len(failedItems(itemErrs)) == 0
+}
+
+// updateDocument retorna la actualización que guarda los campos editables del usuario e incrementa su versión
+func updateDocument(user *models.User) bson.M {
+	return bson.M{
+		"$set": bson.M{
+			"name":            user.Name,
+			"email":           user.Email,
+			"email_canonical": user.EmailCanonical,
+			"age":             user.Age,
+			"phone":           user.Phone,
+			"address":         user.Address,
+			"roles":           user.Roles,
+			"version":         user.Version + 1,
+			"updated_at":      user.UpdatedAt,
+		},
+	}
+}
+
+// versionFilter restringe la consulta a un usuario activo que sigue en la versión indicada
+func versionFilter(idFilter bson.M, version int64) bson.M {
+	filter := bson.M{"version": version, "deleted_at": nil}
+	for key, value := range idFilter {
+		filter[key] = value
+	}
+	if version == 0 {
+		// Documentos creados antes de existir el campo version
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	return filter
+}
+
+// userIDFilter retorna la consulta que identifica a un usuario por su ObjectID o por su UUID
+func userIDFilter(id string) (bson.M, error) {
+	if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+		return bson.M{"_id": objectID}, nil
+	}
+	if parsed, err := uuid.Parse(id); err == nil {
+		return bson.M{"uuid": parsed.String()}, nil
+	}
+	return nil, models.ErrInvalidID
+}
+
+// mapWriteError traduce las violaciones del índice único de email a ErrEmailTaken
+func mapWriteError(err error) error {
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	for _, raw := range serverErrorDocuments(err) {
+		if _, lookupErr := raw.LookupErr("keyPattern", emailIndexKey); lookupErr == nil {
+			return models.ErrEmailTaken
+		}
+	}
+	return err
+}
+
+// serverErrorDocuments retorna los documentos de error originales del servidor contenidos en err
+func serverErrorDocuments(err error) []bson.Raw {
+	var writeErr mongo.WriteError
+	var writeException mongo.WriteException
+	var bulkException mongo.BulkWriteException
+	var cmdErr mongo.CommandError
+
+	var docs []bson.Raw
+	switch {
+	case errors.As(err, &writeErr):
+		docs = append(docs, writeErr.Raw)
+	case errors.As(err, &writeException):
+		for _, e := range writeException.WriteErrors {
+			docs = append(docs, e.Raw)
+		}
+	case errors.As(err, &bulkException):
+		for _, e := range bulkException.WriteErrors {
+			docs = append(docs, e.Raw)
+		}
+	case errors.As(err, &cmdErr):
+		docs = append(docs, cmdErr.Raw)
+	}
+	return docs
+}
+
 // UserRepositoryInterface define los métodos del repositorio de usuario para facilitar el testing y la inyección de dependencias
 type UserRepositoryInterface interface {
 	Create(ctx context.Context, user *models.User) error
 	GetByID(ctx context.Context, id string) (*models.User, error)
 	GetByUUID(ctx context.Context, uuid string) (*models.User, error)
-	GetAll(ctx context.Context, page, limit int64) ([]models.User, int64, error)
+	GetAll(ctx context.Context, filter models.UserFilter, page, limit int64) ([]models.User, error)
+	GetPage(ctx context.Context, filter models.UserFilter, cursor *models.UserCursor, limit int64) ([]models.User, error)
+	Count(ctx context.Context, filter models.UserFilter) (int64, error)
+	Each(ctx context.Context, filter models.UserFilter, fn func(user *models.User) error) error
 	Update(ctx context.Context, id string, user *models.User) error
-	Delete(ctx context.Context, id string) error
-	GetByEmail(ctx context.Context, email string) (*models.User, error)
-	ExistsByEmail(ctx context.Context, email string) (bool, error)
+	Delete(ctx context.Context, id string, deletedBy string) error
+	GetDeletedByID(ctx context.Context, id string) (*models.User, error)
+	Restore(ctx context.Context, id string) (*models.User, error)
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+	GetByEmail(ctx context.Context, canonicalEmail string) (*models.User, error)
+	ExistsByEmail(ctx context.Context, canonicalEmail string) (bool, error)
+	FindTakenEmails(ctx context.Context, canonicalEmails []string) ([]string, error)
+	GetByIDs(ctx context.Context, ids []string) ([]models.User, error)
+	BulkCreate(ctx context.Context, users []*models.User, atomic bool) ([]error, error)
+	BulkUpdate(ctx context.Context, users []*models.User, atomic bool) ([]error, error)
+	BulkDelete(ctx context.Context, users []*models.User, deletedBy string, atomic bool) ([]error, error)
 }
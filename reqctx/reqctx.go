@@ -0,0 +1,69 @@
+// Package reqctx guarda en el context.Context los datos de la petición que necesitan las capas
+// inferiores (servicios, repositorios) sin depender de Gin.
+package reqctx
+
+import (
+	"context"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	requestIDKey
+	clientIPKey
+	traceParentKey
+)
+
+// WithActor retorna un contexto que identifica al usuario autenticado que realiza la petición
+func WithActor(ctx context.Context, actorID string) context.Context {
+	return context.WithValue(ctx, actorKey, actorID)
+}
+
+// Actor retorna el ID del usuario autenticado, o "" si la petición es anónima
+func Actor(ctx context.Context) string {
+	actorID, _ := ctx.Value(actorKey).(string)
+	return actorID
+}
+
+// WithRequestID retorna un contexto con el identificador de la petición
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID retorna el identificador de la petición, o "" si no se conoce
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// WithClientIP retorna un contexto con la IP del cliente que realiza la petición
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+// ClientIP retorna la IP del cliente, o "" si no se conoce
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey).(string)
+	return ip
+}
+
+// WithTraceParent retorna un contexto con la cabecera W3C traceparent que deben propagar las
+// llamadas que haga la petición a otros servicios
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	return context.WithValue(ctx, traceParentKey, traceParent)
+}
+
+// TraceParent retorna la cabecera traceparent de la petición, o "" si no se conoce
+func TraceParent(ctx context.Context) string {
+	traceParent, _ := ctx.Value(traceParentKey).(string)
+	return traceParent
+}
+
+// TraceID retorna el identificador de la traza W3C de la petición (el segundo campo de
+// traceparent, "00-<trace-id>-<parent-id>-<flags>"), o "" si no se conoce
+func TraceID(ctx context.Context) string {
+	traceID, _, _ := strings.Cut(strings.TrimPrefix(TraceParent(ctx), "00-"), "-")
+	return traceID
+}
@@ -2,7 +2,6 @@ package routes
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -10,41 +9,104 @@ import (
 
 	"go-users-api/controllers"
 	"go-users-api/middleware"
+	"go-users-api/models"
+	"go-users-api/services"
 )
 
+// Dependencies agrupa los controladores y servicios que necesitan las rutas
+type Dependencies struct {
+	UserController   *controllers.UserController
+	AuthController   *controllers.AuthController
+	AuditController  *controllers.AuditController
+	ImportController *controllers.ImportController
+	HealthController *controllers.HealthController
+	TokenService     services.TokenServiceInterface
+	// RateLimitService, si no es nil, limita las peticiones de cada cliente por grupo de rutas
+	RateLimitService services.RateLimitServiceInterface
+	// IdempotencyService, si no es nil, repite las respuestas de los POST y PATCH con Idempotency-Key
+	IdempotencyService services.IdempotencyServiceInterface
+	// MetricsHandler, si no es nil, se sirve en GET /metrics del router principal
+	MetricsHandler http.Handler
+}
+
 // SetupRoutes configura todas las rutas de la aplicación
-func SetupRoutes(router *gin.Engine, userController *controllers.UserController) {
+func SetupRoutes(router *gin.Engine, deps Dependencies) {
 	// Middleware global
 	router.Use(middleware.CORS())
+	router.Use(middleware.Tracing())
+	router.Use(middleware.RequestContext())
 	router.Use(middleware.Logger())
+	router.Use(middleware.Metrics())
 	router.Use(middleware.Recovery())
 
+	// Sondas de salud de Kubernetes, fuera del prefijo versionado de la API
+	router.GET("/livez", deps.HealthController.Livez)
+	router.GET("/readyz", deps.HealthController.Readyz)
+	router.GET("/startupz", deps.HealthController.Startupz)
+
+	if deps.MetricsHandler != nil {
+		router.GET("/metrics", gin.WrapH(deps.MetricsHandler))
+	}
+
 	// API v1 routes
 	api := router.Group("/api/v1")
 	{
-		// Health check
-		api.GET("/health", healthCheck)
+		// Health check: se mantiene por compatibilidad y equivale a /readyz
+		api.GET("/health", deps.HealthController.Readyz)
+
+		// Auth routes (públicas, salvo logout-all); se limitan por IP para frenar ataques de fuerza bruta
+		auth := api.Group("/auth")
+		auth.Use(middleware.RateLimit(deps.RateLimitService, "auth"))
+		{
+			auth.POST("/login", deps.AuthController.Login)
+			auth.POST("/refresh", deps.AuthController.Refresh)
+			auth.POST("/logout", deps.AuthController.Logout)
+			auth.POST("/logout-all", middleware.Auth(deps.TokenService), deps.AuthController.LogoutAll)
+		}
 
-		// User routes
+		// Las rutas autenticadas se limitan primero por IP, para contar también las peticiones
+		// sin token o con un token inválido, y después por usuario
+		ipRateLimit := middleware.RateLimitByIP(deps.RateLimitService, "ip")
+
+		// User routes (requieren un JWT válido y el permiso de cada operación).
+		// :id acepta tanto el ObjectID como el UUID del usuario.
 		users := api.Group("/users")
+		users.Use(ipRateLimit, middleware.Auth(deps.TokenService), middleware.RateLimit(deps.RateLimitService, "users"))
+		// Los POST y PATCH aceptan Idempotency-Key para que el cliente pueda reintentarlos; la
+		// importación no, porque el archivo puede ser demasiado grande para guardarlo en memoria
+		idempotent := middleware.Idempotency(deps.IdempotencyService)
+		{
+			users.POST("", middleware.RequirePermission(models.PermUsersWrite), idempotent, deps.UserController.CreateUser)
+			users.GET("", middleware.RequirePermission(models.PermUsersRead), deps.UserController.GetUsers)
+			users.POST("/bulk", middleware.RequirePermission(models.PermUsersWrite), idempotent, deps.UserController.BulkCreateUsers)
+			users.PATCH("/bulk", middleware.RequirePermission(models.PermUsersWrite), idempotent, deps.UserController.BulkUpdateUsers)
+			users.POST("/bulk/delete", middleware.RequirePermission(models.PermUsersDelete), idempotent, deps.UserController.BulkDeleteUsers)
+			users.POST("/import", middleware.RequirePermission(models.PermUsersWrite), deps.ImportController.ImportUsers)
+			users.GET("/export", middleware.RequirePermission(models.PermUsersRead), deps.UserController.ExportUsers)
+			users.GET("/trash", middleware.RequirePermission(models.PermUsersDelete), deps.UserController.GetDeletedUsers)
+			users.GET("/by-uuid/:uuid", middleware.RequirePermission(models.PermUsersRead), deps.UserController.GetUserByUUID)
+			// Buscar por email permite comprobar si alguien está registrado, por lo que requiere acceso a datos personales
+			users.GET("/by-email", middleware.RequirePermission(models.PermUsersReadPII), deps.UserController.GetUserByEmail)
+			users.GET("/:id", middleware.RequirePermission(models.PermUsersRead), deps.UserController.GetUserByID)
+			users.PUT("/:id", middleware.RequirePermission(models.PermUsersWrite), deps.UserController.UpdateUser)
+			users.PATCH("/:id", middleware.RequirePermission(models.PermUsersWrite), idempotent, deps.UserController.PatchUser)
+			users.DELETE("/:id", middleware.RequirePermission(models.PermUsersDelete), deps.UserController.DeleteUser)
+			users.POST("/:id/restore", middleware.RequirePermission(models.PermUsersDelete), idempotent, deps.UserController.RestoreUser)
+			users.GET("/:id/history", middleware.RequirePermission(models.PermAuditRead), deps.AuditController.GetUserHistory)
+		}
+
+		// Import routes: cada importación solo es visible para quien la inició o con acceso a datos personales
+		imports := api.Group("/imports")
+		imports.Use(ipRateLimit, middleware.Auth(deps.TokenService), middleware.RateLimit(deps.RateLimitService, "imports"), middleware.RequirePermission(models.PermUsersWrite))
 		{
-			users.POST("", userController.CreateUser)
-			users.GET("", userController.GetUsers)
-			users.GET("/:id", userController.GetUserByID)
-			users.PUT("/:id", userController.UpdateUser)
-			users.DELETE("/:id", userController.DeleteUser)
+			imports.GET("/:id", deps.ImportController.GetImportJob)
+			imports.GET("/:id/rejected", deps.ImportController.GetImportRejections)
 		}
+
+		// Audit routes (solo administradores)
+		api.GET("/audit", ipRateLimit, middleware.Auth(deps.TokenService), middleware.RateLimit(deps.RateLimitService, "audit"), middleware.RequirePermission(models.PermAuditRead), deps.AuditController.GetAuditEvents)
 	}
 
 	// Swagger documentation
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 }
-
-// healthCheck maneja el endpoint de health check
-func healthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "ok",
-		"message": "API Users BRM is running",
-		"time":    time.Now().Format(time.RFC3339),
-	})
-}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go-users-api/config"
+	"go-users-api/metrics"
+	"go-users-api/models"
+	"go-users-api/repository"
+	"go-users-api/reqctx"
+)
+
+// auditWriteTimeout limita cuánto puede tardar la escritura de un evento de auditoría, que no
+// depende de que el cliente siga conectado
+const auditWriteTimeout = 5 * time.Second
+
+// AuditService registra y consulta el historial de cambios sobre los usuarios
+type AuditService struct {
+	auditRepo    repository.AuditRepositoryInterface
+	maxPageLimit int64
+}
+
+// NewAuditService crea una nueva instancia del servicio de auditoría
+func NewAuditService(auditRepo repository.AuditRepositoryInterface, cfg *config.Config) *AuditService {
+	return &AuditService{
+		auditRepo:    auditRepo,
+		maxPageLimit: cfg.MaxPageLimit,
+	}
+}
+
+// Record registra un cambio sobre un usuario. El actor, el ID de la petición y la IP del cliente
+// se toman del contexto. before es nil al crear el usuario.
+//
+// El cambio ya está guardado cuando se registra, por lo que el evento se escribe aunque el
+// cliente se haya desconectado y un fallo al escribirlo se registra en el log en lugar de
+// retornarse al cliente. Cada cambio se cuenta también en la métrica user_changes_total.
+func (s *AuditService) Record(ctx context.Context, action models.AuditAction, before, after *models.User) {
+	metrics.UserChanges.WithLabelValues(string(action)).Inc()
+
+	target := after
+	if target == nil {
+		target = before
+	}
+
+	event := &models.AuditEvent{
+		UserID:    target.ID.Hex(),
+		UserUUID:  target.UUID,
+		Action:    action,
+		ActorID:   reqctx.Actor(ctx),
+		RequestID: reqctx.RequestID(ctx),
+		ClientIP:  reqctx.ClientIP(ctx),
+		Changes:   models.DiffUsers(before, after),
+		Timestamp: time.Now(),
+	}
+
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditWriteTimeout)
+	defer cancel()
+	if err := s.auditRepo.Create(writeCtx, event); err != nil {
+		slog.ErrorContext(ctx, "Error recording audit event", "action", action, "target_user_id", event.UserID, "error", err)
+	}
+}
+
+// GetUserHistory obtiene los cambios registrados sobre un usuario (por ObjectID o UUID), del más reciente al más antiguo.
+// El historial se conserva aunque el usuario esté en la papelera o se haya purgado.
+func (s *AuditService) GetUserHistory(ctx context.Context, userID string, query models.AuditQuery) (*models.AuditEventsResponse, error) {
+	filter := buildAuditFilter(query)
+	filter.UserID = userID
+	return s.findEvents(ctx, filter, query)
+}
+
+// QueryEvents obtiene los eventos de auditoría de todos los usuarios que cumplen los filtros
+func (s *AuditService) QueryEvents(ctx context.Context, query models.AuditQuery) (*models.AuditEventsResponse, error) {
+	return s.findEvents(ctx, buildAuditFilter(query), query)
+}
+
+// findEvents obtiene una página de eventos y el total que cumple el filtro
+func (s *AuditService) findEvents(ctx context.Context, filter models.AuditFilter, query models.AuditQuery) (*models.AuditEventsResponse, error) {
+	page, limit := parsePagination(query.Page, query.Limit, s.maxPageLimit)
+
+	events, err := s.auditRepo.Find(ctx, filter, page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := s.auditRepo.Count(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuditEventsResponse{Events: events, Total: total}, nil
+}
+
+// buildAuditFilter convierte los parámetros de consulta en un filtro de auditoría
+func buildAuditFilter(query models.AuditQuery) models.AuditFilter {
+	return models.AuditFilter{
+		ActorID: query.ActorID,
+		Action:  models.AuditAction(query.Action),
+		From:    query.From,
+		To:      query.To,
+	}
+}
+
+// AuditServiceInterface define los métodos del servicio de auditoría para facilitar el testing
+type AuditServiceInterface interface {
+	Record(ctx context.Context, action models.AuditAction, before, after *models.User)
+	GetUserHistory(ctx context.Context, userID string, query models.AuditQuery) (*models.AuditEventsResponse, error)
+	QueryEvents(ctx context.Context, query models.AuditQuery) (*models.AuditEventsResponse, error)
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go-users-api/models"
+	"go-users-api/repository"
+)
+
+// AuthService maneja el inicio de sesión y la emisión de tokens
+type AuthService struct {
+	userService      UserServiceInterface
+	tokenService     TokenServiceInterface
+	refreshTokenRepo repository.RefreshTokenRepositoryInterface
+}
+
+// NewAuthService crea una nueva instancia del servicio de autenticación
+func NewAuthService(userService UserServiceInterface, tokenService TokenServiceInterface, refreshTokenRepo repository.RefreshTokenRepositoryInterface) *AuthService {
+	return &AuthService{
+		userService:      userService,
+		tokenService:     tokenService,
+		refreshTokenRepo: refreshTokenRepo,
+	}
+}
+
+// Login verifica las credenciales y retorna un par de tokens de acceso y refresco
+func (s *AuthService) Login(ctx context.Context, req models.LoginRequest) (*models.TokenResponse, error) {
+	user, err := s.userService.Authenticate(ctx, req.Email, req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cada login inicia una nueva familia (sesión) de tokens de refresco
+	return s.issueTokens(ctx, user, uuid.New().String())
+}
+
+// Refresh rota el token de refresco: invalida el presentado y emite un nuevo par en la misma familia
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*models.TokenResponse, error) {
+	stored, err := s.lookupRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.RevokedAt != nil {
+		return nil, models.ErrInvalidToken
+	}
+
+	if stored.RotatedAt != nil {
+		return nil, s.handleReuse(ctx, stored)
+	}
+
+	// Marcar como usado de forma atómica: si otra petición lo usó primero también es reutilización
+	rotated, err := s.refreshTokenRepo.MarkRotated(ctx, stored.TokenID)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		return nil, s.handleReuse(ctx, stored)
+	}
+
+	user, err := s.userService.GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, models.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, user, stored.FamilyID)
+}
+
+// Logout revoca la sesión a la que pertenece el token de refresco
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	stored, err := s.lookupRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+
+	return s.refreshTokenRepo.RevokeFamily(ctx, stored.FamilyID)
+}
+
+// LogoutAll revoca todas las sesiones del usuario
+func (s *AuthService) LogoutAll(ctx context.Context, userID string) error {
+	return s.refreshTokenRepo.RevokeAllForUser(ctx, userID)
+}
+
+// lookupRefreshToken valida el JWT de refresco y obtiene su registro
+func (s *AuthService) lookupRefreshToken(ctx context.Context, refreshToken string) (*models.RefreshToken, error) {
+	claims, err := s.tokenService.ParseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := s.refreshTokenRepo.GetByTokenID(ctx, claims.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil, models.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	// El registro debe corresponder al mismo usuario y sesión que el token firmado
+	if stored.UserID != claims.Subject || stored.FamilyID != claims.FamilyID {
+		return nil, models.ErrInvalidToken
+	}
+
+	return stored, nil
+}
+
+// handleReuse revoca la familia completa de un token reutilizado, ya que pudo haber sido robado
+func (s *AuthService) handleReuse(ctx context.Context, stored *models.RefreshToken) error {
+	slog.WarnContext(ctx, "Refresh token reuse detected, revoking family", "target_user_id", stored.UserID, "family_id", stored.FamilyID)
+	if err := s.refreshTokenRepo.RevokeFamily(ctx, stored.FamilyID); err != nil {
+		return err
+	}
+	return models.ErrTokenReused
+}
+
+// issueTokens genera y registra el par de tokens para el usuario autenticado
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User, familyID string) (*models.TokenResponse, error) {
+	accessToken, err := s.tokenService.GenerateAccessToken(user)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, claims, err := s.tokenService.GenerateRefreshToken(user, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.refreshTokenRepo.Create(ctx, &models.RefreshToken{
+		TokenID:   claims.ID,
+		FamilyID:  familyID,
+		UserID:    claims.Subject,
+		ExpiresAt: claims.ExpiresAt.Time,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.tokenService.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// AuthServiceInterface define los métodos del servicio de autenticación para facilitar el testing y la inyección de dependencias
+type AuthServiceInterface interface {
+	Login(ctx context.Context, req models.LoginRequest) (*models.TokenResponse, error)
+	Refresh(ctx context.Context, refreshToken string) (*models.TokenResponse, error)
+	Logout(ctx context.Context, refreshToken string) error
+	LogoutAll(ctx context.Context, userID string) error
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-users-api/models"
+)
+
+// errInvalidCursor se retorna cuando el cursor no se puede decodificar o su firma no coincide
+var errInvalidCursor = models.NewValidationError(models.FieldError{Field: "cursor", Message: "is invalid or has been tampered with"})
+
+// cursorPayload es el contenido firmado de un cursor de paginación
+type cursorPayload struct {
+	CreatedAt int64  `json:"t"` // created_at en nanosegundos Unix
+	ID        string `json:"id"`
+	Backward  bool   `json:"b,omitempty"`
+}
+
+// CursorCodec codifica y firma los cursores opacos del listado de usuarios.
+// La firma HMAC impide que el cliente fabrique cursores con posiciones arbitrarias.
+type CursorCodec struct {
+	secret []byte
+}
+
+// NewCursorCodec crea un codec con el secreto indicado. Si está vacío (solo se permite en modo
+// debug, ver config.Validate) se genera uno aleatorio, lo que invalida los cursores emitidos al
+// reiniciar el proceso o entre réplicas.
+func NewCursorCodec(secret string) *CursorCodec {
+	key := []byte(secret)
+	if len(key) == 0 {
+		slog.Warn("CURSOR_SECRET not set, using a random key: cursors will not survive restarts")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			slog.Error("Error generating cursor key", "error", err)
+			os.Exit(1)
+		}
+	}
+	return &CursorCodec{secret: key}
+}
+
+// Encode genera el cursor opaco para la posición indicada
+func (c *CursorCodec) Encode(cursor models.UserCursor) string {
+	payload, _ := json.Marshal(cursorPayload{
+		CreatedAt: cursor.CreatedAt.UnixNano(),
+		ID:        cursor.ID.Hex(),
+		Backward:  cursor.Backward,
+	})
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(c.sign(encoded))
+}
+
+// Decode verifica la firma del cursor y retorna la posición que representa
+func (c *CursorCodec) Decode(value string) (*models.UserCursor, error) {
+	encoded, signature, found := strings.Cut(value, ".")
+	if !found {
+		return nil, errInvalidCursor
+	}
+
+	expected, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, c.sign(encoded)) {
+		return nil, errInvalidCursor
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var payload cursorPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, errInvalidCursor
+	}
+
+	id, err := primitive.ObjectIDFromHex(payload.ID)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	return &models.UserCursor{
+		CreatedAt: time.Unix(0, payload.CreatedAt).UTC(),
+		ID:        id,
+		Backward:  payload.Backward,
+	}, nil
+}
+
+// sign calcula la firma HMAC-SHA256 del contenido codificado
+func (c *CursorCodec) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
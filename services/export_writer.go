@@ -0,0 +1,248 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-users-api/models"
+)
+
+// xlsxMaxRows es el número máximo de filas de una hoja de Excel, incluida la cabecera
+const xlsxMaxRows = 1 << 20
+
+// errXLSXRowLimit se retorna cuando la exportación no cabe en una hoja de Excel
+var errXLSXRowLimit = fmt.Errorf("xlsx export exceeds the limit of %d rows, use csv or ndjson", xlsxMaxRows-1)
+
+// userExportWriter escribe los usuarios exportados en un formato concreto
+type userExportWriter interface {
+	WriteUser(user *models.UserResponse) error
+	// Close termina el archivo; debe llamarse aunque no se haya escrito ningún usuario
+	Close() error
+}
+
+// newUserExportWriter crea el escritor del formato indicado y escribe la cabecera si el formato la tiene
+func newUserExportWriter(w io.Writer, format models.ExportFormat, columns []models.ExportColumn) (userExportWriter, error) {
+	switch format {
+	case models.ExportNDJSON:
+		return &ndjsonExportWriter{writer: bufio.NewWriter(w), columns: columns}, nil
+	case models.ExportXLSX:
+		return newXLSXExportWriter(w, columns)
+	default:
+		return newCSVExportWriter(w, columns)
+	}
+}
+
+// exportText convierte el valor de una columna en texto para CSV y XLSX. Los roles se separan
+// con "|", igual que en la importación.
+func exportText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case []models.Role:
+		roles := make([]string, len(v))
+		for i, role := range v {
+			roles[i] = string(role)
+		}
+		return strings.Join(roles, importRolesSeparator)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// csvExportWriter escribe los usuarios como CSV con cabecera
+type csvExportWriter struct {
+	writer  *csv.Writer
+	columns []models.ExportColumn
+	record  []string
+}
+
+// newCSVExportWriter crea el escritor CSV y escribe la cabecera
+func newCSVExportWriter(w io.Writer, columns []models.ExportColumn) (*csvExportWriter, error) {
+	writer := &csvExportWriter{writer: csv.NewWriter(w), columns: columns, record: make([]string, len(columns))}
+	for i, column := range columns {
+		writer.record[i] = column.Name
+	}
+	return writer, writer.writer.Write(writer.record)
+}
+
+// WriteUser implementa userExportWriter
+func (w *csvExportWriter) WriteUser(user *models.UserResponse) error {
+	for i, column := range w.columns {
+		w.record[i] = csvSafeText(exportText(column.Value(user)))
+	}
+	return w.writer.Write(w.record)
+}
+
+// Close implementa userExportWriter
+func (w *csvExportWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// plainNumber reconoce valores como "+34 600-000-000" o "-5", que las hojas de cálculo tratan como números
+var plainNumber = regexp.MustCompile(`^[+-]?[0-9 ()-]*$`)
+
+// csvSafeText evita que una hoja de cálculo interprete el texto como fórmula (CSV injection)
+// anteponiendo un apóstrofo. Los teléfonos y números con signo se conservan tal cual.
+func csvSafeText(value string) string {
+	if value == "" || !strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return value
+	}
+	if (value[0] == '+' || value[0] == '-') && plainNumber.MatchString(value) {
+		return value
+	}
+	return "'" + value
+}
+
+// ndjsonExportWriter escribe un objeto JSON por usuario con las columnas seleccionadas
+type ndjsonExportWriter struct {
+	writer  *bufio.Writer
+	columns []models.ExportColumn
+}
+
+// WriteUser implementa userExportWriter. Los campos se escriben en el orden de las columnas.
+func (w *ndjsonExportWriter) WriteUser(user *models.UserResponse) error {
+	w.writer.WriteByte('{')
+	for i, column := range w.columns {
+		if i > 0 {
+			w.writer.WriteByte(',')
+		}
+		value, err := json.Marshal(column.Value(user))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w.writer, "%q:", column.Name)
+		w.writer.Write(value)
+	}
+	w.writer.WriteString("}\n")
+	return nil
+}
+
+// Close implementa userExportWriter
+func (w *ndjsonExportWriter) Close() error {
+	return w.writer.Flush()
+}
+
+// xlsxExportWriter escribe un libro de Excel (Office Open XML) con una sola hoja. El libro es un
+// zip que se genera sobre la marcha: la hoja se escribe fila a fila sin guardarla en memoria.
+type xlsxExportWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	columns []models.ExportColumn
+	rows    int
+}
+
+// xlsxStaticParts son las partes fijas del libro, con una única hoja en xl/worksheets/sheet1.xml
+var xlsxStaticParts = []struct{ name, content string }{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Users" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// newXLSXExportWriter escribe las partes fijas del libro, abre la hoja y escribe la cabecera
+func newXLSXExportWriter(w io.Writer, columns []models.ExportColumn) (*xlsxExportWriter, error) {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxStaticParts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	// La hoja es la última parte del zip, así que puede escribirse hasta Close
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	writer := &xlsxExportWriter{archive: archive, sheet: bufio.NewWriter(sheet), columns: columns}
+	writer.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	return writer, writer.writeRow(header)
+}
+
+// WriteUser implementa userExportWriter
+func (w *xlsxExportWriter) WriteUser(user *models.UserResponse) error {
+	if w.rows >= xlsxMaxRows {
+		return errXLSXRowLimit
+	}
+
+	values := make([]interface{}, len(w.columns))
+	for i, column := range w.columns {
+		values[i] = column.Value(user)
+	}
+	return w.writeRow(values)
+}
+
+// writeRow escribe una fila; los números se guardan como números y el resto como texto.
+// El texto se guarda como inlineStr, por lo que Excel nunca lo evalúa como fórmula.
+func (w *xlsxExportWriter) writeRow(values []interface{}) error {
+	w.rows++
+	fmt.Fprintf(w.sheet, `<row r="%d">`, w.rows)
+	for i, value := range values {
+		ref := xlsxColumnName(i) + strconv.Itoa(w.rows)
+		switch value.(type) {
+		case int, int64:
+			fmt.Fprintf(w.sheet, `<c r="%s"><v>%s</v></c>`, ref, exportText(value))
+		default:
+			fmt.Fprintf(w.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			if err := xml.EscapeText(w.sheet, []byte(exportText(value))); err != nil {
+				return err
+			}
+			w.sheet.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := w.sheet.WriteString(`</row>`)
+	return err
+}
+
+// Close implementa userExportWriter cerrando la hoja y el zip
+func (w *xlsxExportWriter) Close() error {
+	w.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.archive.Close()
+}
+
+// xlsxColumnName retorna el nombre de la columna de Excel de índice i (0 -> A, 26 -> AA)
+func xlsxColumnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
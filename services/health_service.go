@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-users-api/models"
+)
+
+// HealthCheck comprueba una dependencia de la que depende la disponibilidad de la API
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// HealthService mantiene el estado del ciclo de vida de la aplicación (arrancando, lista,
+// apagándose) y comprueba sus dependencias para las sondas de salud
+type HealthService struct {
+	checks       []HealthCheck
+	timeout      time.Duration
+	started      atomic.Bool
+	shuttingDown atomic.Bool
+}
+
+// NewHealthService crea el servicio de salud; cada comprobación se cancela tras timeout
+func NewHealthService(timeout time.Duration, checks ...HealthCheck) *HealthService {
+	return &HealthService{
+		checks:  checks,
+		timeout: timeout,
+	}
+}
+
+// MarkStarted indica que terminaron las migraciones y la creación de índices
+func (s *HealthService) MarkStarted() {
+	s.started.Store(true)
+}
+
+// MarkShuttingDown indica que comenzó el apagado graceful; desde entonces la API deja de estar lista
+func (s *HealthService) MarkShuttingDown() {
+	s.shuttingDown.Store(true)
+}
+
+// Started indica si la aplicación terminó de arrancar
+func (s *HealthService) Started() bool {
+	return s.started.Load()
+}
+
+// Readiness comprueba en paralelo todas las dependencias. La API está lista si terminó de
+// arrancar, no se está apagando y todas las dependencias responden.
+func (s *HealthService) Readiness(ctx context.Context) *models.HealthReport {
+	report := &models.HealthReport{Status: models.HealthUp, Time: time.Now().UTC()}
+	switch {
+	case s.shuttingDown.Load():
+		// Durante el apagado no se comprueba nada: el balanceador debe dejar de enviar peticiones ya
+		report.Status = models.HealthShuttingDown
+		return report
+	case !s.started.Load():
+		report.Status = models.HealthStarting
+	}
+
+	results := make([]models.DependencyHealth, len(s.checks))
+	var wg sync.WaitGroup
+	for i, check := range s.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = s.runCheck(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report.Checks = make(map[string]models.DependencyHealth, len(s.checks))
+	for i, check := range s.checks {
+		report.Checks[check.Name] = results[i]
+		if results[i].Status != models.HealthUp && report.Status == models.HealthUp {
+			report.Status = models.HealthDown
+		}
+	}
+	return report
+}
+
+// runCheck ejecuta una comprobación con el timeout del servicio y mide su latencia
+func (s *HealthService) runCheck(ctx context.Context, check HealthCheck) models.DependencyHealth {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	result := models.DependencyHealth{
+		Status:    models.HealthUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Health check failed", "dependency", check.Name, "error", err)
+		result.Status, result.Error = models.HealthDown, "unavailable"
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Error = "timeout"
+		}
+	}
+	return result
+}
+
+// HealthServiceInterface define la interfaz del servicio de salud
+type HealthServiceInterface interface {
+	Started() bool
+	Readiness(ctx context.Context) *models.HealthReport
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"go-users-api/config"
+	"go-users-api/models"
+	"go-users-api/repository"
+)
+
+// idempotencyLockTimeout es el tiempo que una petición en curso retiene su clave. Si el servidor
+// que la atendía se detiene sin terminarla, pasado este tiempo otro reintento puede reclamarla.
+const idempotencyLockTimeout = 5 * time.Minute
+
+// IdempotencyService guarda las respuestas de las peticiones con Idempotency-Key para repetirlas
+// en los reintentos en lugar de ejecutar la operación otra vez
+type IdempotencyService struct {
+	idempotencyRepo repository.IdempotencyRepositoryInterface
+	ttl             time.Duration
+	aead            cipher.AEAD // Cifra los cuerpos de las respuestas guardadas
+}
+
+// errUnreadableResponse se retorna cuando la respuesta guardada no se puede descifrar, por
+// ejemplo porque la guardó otra réplica o un proceso anterior con otra IDEMPOTENCY_SECRET
+var errUnreadableResponse = errors.New("stored idempotent response cannot be decrypted")
+
+// NewIdempotencyService crea una nueva instancia del servicio de idempotencia. Si
+// IdempotencySecret está vacío (solo se permite en modo debug) se genera una clave aleatoria,
+// con lo que las respuestas guardadas se descartan al reiniciar el proceso o en otra réplica.
+func NewIdempotencyService(idempotencyRepo repository.IdempotencyRepositoryInterface, cfg *config.Config) *IdempotencyService {
+	key := sha256.Sum256([]byte(cfg.IdempotencySecret))
+	if cfg.IdempotencySecret == "" {
+		slog.Warn("IDEMPOTENCY_SECRET not set, using a random key: stored responses will be discarded on restart")
+		if _, err := rand.Read(key[:]); err != nil {
+			slog.Error("Error generating idempotency key", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Una clave de 32 bytes siempre es válida para AES-256 y GCM
+	block, _ := aes.NewCipher(key[:])
+	aead, _ := cipher.NewGCM(block)
+
+	return &IdempotencyService{
+		idempotencyRepo: idempotencyRepo,
+		ttl:             cfg.IdempotencyTTL,
+		aead:            aead,
+	}
+}
+
+// Begin reserva la clave id para la petición con la huella fingerprint. Retorna (nil, nil) si la
+// petición debe ejecutarse, o el registro con la respuesta guardada si es un reintento que debe
+// repetirla. Falla con ErrIdempotencyKeyReused si la clave se usó con otra petición y con
+// ErrIdempotencyInProgress si la petición original aún no terminó.
+func (s *IdempotencyService) Begin(ctx context.Context, id, fingerprint string) (*models.IdempotencyRecord, error) {
+	return s.begin(ctx, id, fingerprint, true)
+}
+
+// begin reserva la clave como Begin. Si la respuesta guardada no se puede descifrar, porque la
+// cifró otro proceso con otra IDEMPOTENCY_SECRET, se descarta y con retry se vuelve a intentar
+// reservar la clave una vez, para ejecutar la petición en lugar de fallar durante todo el TTL.
+func (s *IdempotencyService) begin(ctx context.Context, id, fingerprint string, retry bool) (*models.IdempotencyRecord, error) {
+	now := time.Now()
+	existing, err := s.idempotencyRepo.Acquire(ctx, &models.IdempotencyRecord{
+		ID:          id,
+		Fingerprint: fingerprint,
+		Status:      models.IdempotencyInProgress,
+		CreatedAt:   now,
+		LockedUntil: now.Add(idempotencyLockTimeout),
+		ExpiresAt:   now.Add(s.ttl),
+	})
+	if err != nil || existing == nil {
+		return nil, err
+	}
+
+	switch {
+	case existing.Fingerprint != fingerprint:
+		return nil, models.ErrIdempotencyKeyReused
+	case existing.Status != models.IdempotencyCompleted:
+		return nil, models.ErrIdempotencyInProgress
+	}
+
+	body, err := s.open(existing.ID, existing.ResponseBody)
+	if err != nil && retry {
+		slog.WarnContext(ctx, "Discarding stored idempotent response", "error", err)
+		if err := s.idempotencyRepo.DeleteCompleted(ctx, id); err != nil {
+			return nil, err
+		}
+		return s.begin(ctx, id, fingerprint, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	existing.ResponseBody = body
+	return existing, nil
+}
+
+// Complete guarda la respuesta de la petición para repetirla durante el TTL configurado
+func (s *IdempotencyService) Complete(ctx context.Context, id, fingerprint string, status int, headers map[string]string, body []byte) error {
+	return s.idempotencyRepo.Complete(ctx, &models.IdempotencyRecord{
+		ID:              id,
+		Fingerprint:     fingerprint,
+		Status:          models.IdempotencyCompleted,
+		ResponseStatus:  status,
+		ResponseHeaders: headers,
+		ResponseBody:    s.seal(id, body),
+		ExpiresAt:       time.Now().Add(s.ttl),
+	})
+}
+
+// Release libera la clave sin guardar la respuesta, para que un reintento vuelva a ejecutar la petición
+func (s *IdempotencyService) Release(ctx context.Context, id, fingerprint string) error {
+	return s.idempotencyRepo.Release(ctx, id, fingerprint)
+}
+
+// seal cifra el cuerpo de la respuesta de la clave id. El resultado empieza por el nonce; id se
+// autentica junto al cuerpo para que no pueda copiarse a la clave de otro usuario.
+func (s *IdempotencyService) seal(id string, body []byte) []byte {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(body)+s.aead.Overhead())
+	rand.Read(nonce) // Desde Go 1.24 no retorna error: si no puede leer, aborta el programa
+	return s.aead.Seal(nonce, nonce, body, []byte(id))
+}
+
+// open descifra el cuerpo guardado por seal para la clave id
+func (s *IdempotencyService) open(id string, sealed []byte) ([]byte, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, errUnreadableResponse
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	body, err := s.aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnreadableResponse, err)
+	}
+	return body, nil
+}
+
+// IdempotencyServiceInterface define la interfaz del servicio de idempotencia
+type IdempotencyServiceInterface interface {
+	Begin(ctx context.Context, id, fingerprint string) (*models.IdempotencyRecord, error)
+	Complete(ctx context.Context, id, fingerprint string, status int, headers map[string]string, body []byte) error
+	Release(ctx context.Context, id, fingerprint string) error
+}
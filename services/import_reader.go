@@ -0,0 +1,215 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go-users-api/models"
+)
+
+// importRolesSeparator separa los roles dentro de una columna CSV (ej. "admin|support")
+const importRolesSeparator = "|"
+
+// importRow es una fila leída del archivo de importación
+type importRow struct {
+	line   int
+	record []string // Columnas de la fila CSV
+	raw    string   // Línea NDJSON
+	user   models.CreateUserRequest
+	err    error // Error al interpretar la fila; la fila se rechaza sin validarla
+}
+
+// rejection crea el rechazo de la fila con el mensaje y los errores por campo indicados
+func (r *importRow) rejection(message string, fields []models.FieldError) models.ImportRejection {
+	return models.ImportRejection{Line: r.line, Error: message, Errors: fields, Record: r.record, Raw: r.raw}
+}
+
+// importReader lee las filas de un archivo de importación; retorna io.EOF al terminar
+type importReader interface {
+	Next() (*importRow, error)
+}
+
+// newImportReader crea el lector del formato indicado. En CSV lee la cabecera y valida el
+// mapeo de columnas, y la retorna para el reporte de filas rechazadas.
+func newImportReader(src io.Reader, opts models.ImportOptions) (importReader, []string, error) {
+	if opts.Format == models.ImportNDJSON {
+		return &ndjsonImportReader{reader: bufio.NewReader(src)}, nil, nil
+	}
+
+	reader := csv.NewReader(src)
+	reader.Comma = opts.Delimiter
+	reader.FieldsPerRecord = 0 // Todas las filas deben tener las columnas de la cabecera
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, models.NewValidationError(models.FieldError{Field: "file", Message: "is empty"})
+	}
+	if err != nil {
+		return nil, nil, models.NewValidationError(models.FieldError{Field: "file", Message: "has an invalid CSV header: " + err.Error()})
+	}
+	// Excel añade un BOM al guardar en UTF-8
+	header[0] = strings.TrimPrefix(header[0], "\uFEFF")
+
+	columns, err := csvColumns(header, opts.Mapping)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &csvImportReader{reader: reader, columns: columns}, header, nil
+}
+
+// csvColumns asigna a cada columna de la cabecera el campo del usuario que contiene ("" si se
+// ignora). Las columnas del mapeo tienen prioridad; el resto se asigna si su nombre es el de un campo.
+func csvColumns(header []string, mapping map[string]string) ([]string, error) {
+	var fields []models.FieldError
+
+	mapped := make(map[string]bool)
+	for column, field := range mapping {
+		if !slices.Contains(models.ImportColumns, field) {
+			fields = append(fields, models.FieldError{Field: "mapping", Message: fmt.Sprintf("unknown field %q for column %q", field, column)})
+		}
+		if !slices.ContainsFunc(header, func(name string) bool { return strings.TrimSpace(name) == column }) {
+			fields = append(fields, models.FieldError{Field: "mapping", Message: fmt.Sprintf("column %q not found in the CSV header", column)})
+		}
+		mapped[field] = true
+	}
+
+	columns := make([]string, len(header))
+	assigned := make(map[string]bool)
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		field, ok := mapping[name]
+		if !ok {
+			field = strings.ToLower(name)
+			if mapped[field] || !slices.Contains(models.ImportColumns, field) {
+				continue
+			}
+		}
+		if assigned[field] {
+			fields = append(fields, models.FieldError{Field: "mapping", Message: fmt.Sprintf("field %q is assigned to more than one column", field)})
+		}
+		assigned[field] = true
+		columns[i] = field
+	}
+
+	for _, required := range []string{"name", "email", "age"} {
+		if !assigned[required] {
+			fields = append(fields, models.FieldError{Field: "mapping", Message: fmt.Sprintf("no column for required field %q", required)})
+		}
+	}
+
+	if len(fields) > 0 {
+		return nil, models.NewValidationError(fields...)
+	}
+	return columns, nil
+}
+
+// csvImportReader lee usuarios de un CSV con cabecera
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns []string
+}
+
+// Next implementa importReader
+func (r *csvImportReader) Next() (*importRow, error) {
+	record, err := r.reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		// Una fila mal formada se rechaza y la lectura continúa con la siguiente
+		return &importRow{line: parseErr.StartLine, record: record, err: &models.ValidationError{Message: parseErr.Err.Error()}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	line, _ := r.reader.FieldPos(0)
+	row := &importRow{line: line, record: record}
+
+	var fields []models.FieldError
+	for i, value := range record {
+		value = strings.TrimSpace(value)
+		switch r.columns[i] {
+		case "name":
+			row.user.Name = value
+		case "email":
+			row.user.Email = value
+		case "age":
+			if value == "" {
+				continue
+			}
+			age, err := strconv.Atoi(value)
+			if err != nil {
+				fields = append(fields, models.FieldError{Field: "age", Message: "must be a number"})
+			}
+			row.user.Age = age
+		case "phone":
+			row.user.Phone = value
+		case "address":
+			row.user.Address = value
+		case "password":
+			row.user.Password = value
+		case "roles":
+			for _, role := range strings.Split(value, importRolesSeparator) {
+				if role = strings.TrimSpace(role); role != "" {
+					row.user.Roles = append(row.user.Roles, models.Role(role))
+				}
+			}
+		}
+	}
+	if len(fields) > 0 {
+		row.err = models.NewValidationError(fields...)
+	}
+	return row, nil
+}
+
+// ndjsonImportReader lee usuarios de un archivo con un objeto JSON por línea
+type ndjsonImportReader struct {
+	reader *bufio.Reader
+	line   int
+}
+
+// Next implementa importReader; las líneas vacías se ignoran
+func (r *ndjsonImportReader) Next() (*importRow, error) {
+	for {
+		data, err := r.reader.ReadBytes('\n')
+		if len(data) == 0 && err != nil {
+			return nil, err
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		r.line++
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+
+		row := &importRow{line: r.line, raw: string(data)}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&row.user); err != nil {
+			row.err = jsonRowError(err)
+		}
+		return row, nil
+	}
+}
+
+// jsonRowError convierte un error al decodificar una línea NDJSON en un error de validación
+func jsonRowError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return models.NewValidationError(models.FieldError{
+			Field:   typeErr.Field,
+			Message: "must be of type " + typeErr.Type.String(),
+		})
+	}
+	return &models.ValidationError{Message: "invalid JSON: " + err.Error()}
+}
@@ -0,0 +1,410 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"go-users-api/config"
+	"go-users-api/models"
+	"go-users-api/repository"
+	"go-users-api/reqctx"
+	"go-users-api/tracing"
+)
+
+// importQueueSize es el número máximo de importaciones asíncronas pendientes de ejecutar
+const importQueueSize = 20
+
+// errImportInterrupted se guarda en los jobs que no terminaron porque el servidor se detuvo
+var errImportInterrupted = errors.New("import interrupted by a server shutdown, upload the file again")
+
+// importTask es una importación asíncrona en espera de ejecutarse
+type importTask struct {
+	job         *models.ImportJob
+	path        string // Copia temporal del archivo subido
+	opts        models.ImportOptions
+	validate    RequestValidator
+	requestID   string
+	clientIP    string
+	traceParent string
+}
+
+// ImportService importa usuarios desde archivos CSV o NDJSON, de forma síncrona o como job en segundo plano
+type ImportService struct {
+	importRepo         repository.ImportRepositoryInterface
+	userService        UserServiceInterface
+	batchSize          int
+	maxBytes           int64
+	syncMaxBytes       int64
+	retention          time.Duration
+	emailProviderRules bool
+	queue              chan *importTask
+}
+
+// NewImportService crea una nueva instancia del servicio de importación
+func NewImportService(importRepo repository.ImportRepositoryInterface, userService UserServiceInterface, cfg *config.Config) *ImportService {
+	return &ImportService{
+		importRepo:         importRepo,
+		userService:        userService,
+		batchSize:          int(cfg.BulkMaxItems),
+		maxBytes:           cfg.ImportMaxBytes,
+		syncMaxBytes:       cfg.ImportSyncMaxBytes,
+		retention:          cfg.ImportRetention,
+		emailProviderRules: cfg.EmailProviderRules,
+		queue:              make(chan *importTask, importQueueSize),
+	}
+}
+
+// MaxFileSize retorna el tamaño máximo en bytes de un archivo de importación
+func (s *ImportService) MaxFileSize() int64 {
+	return s.maxBytes
+}
+
+// ImportUsers importa el archivo durante la petición y retorna las filas rechazadas.
+// Solo admite archivos de hasta IMPORT_SYNC_MAX_BYTES; los mayores deben importarse con StartImport.
+func (s *ImportService) ImportUsers(ctx context.Context, src io.Reader, size int64, opts models.ImportOptions, validate RequestValidator) (*models.ImportResult, error) {
+	if size > s.syncMaxBytes {
+		return nil, fmt.Errorf("%w for a synchronous import (max %d bytes), use async=true", models.ErrFileTooLarge, s.syncMaxBytes)
+	}
+
+	reader, _, err := newImportReader(src, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.ImportResult{DryRun: opts.DryRun, Rejections: []models.ImportRejection{}}
+	stats, err := s.process(ctx, reader, opts, validate, func(stats models.ImportStats, rejections []models.ImportRejection) error {
+		result.Rejections = append(result.Rejections, rejections...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.ImportStats = stats
+	return result, nil
+}
+
+// StartImport guarda una copia del archivo y crea un job que lo importa en segundo plano.
+// La cabecera CSV se valida antes de crear el job para informar los errores de mapeo en la respuesta.
+func (s *ImportService) StartImport(ctx context.Context, src io.Reader, size int64, opts models.ImportOptions, validate RequestValidator) (*models.ImportJob, error) {
+	if size > s.maxBytes {
+		return nil, fmt.Errorf("%w (max %d bytes)", models.ErrFileTooLarge, s.maxBytes)
+	}
+
+	path, err := copyToTempFile(src)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := s.createJob(ctx, path, opts)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	// El job retornado se serializa en la respuesta mientras el worker modifica su propia copia
+	taskJob := *job
+	task := &importTask{
+		job:         &taskJob,
+		path:        path,
+		opts:        opts,
+		validate:    validate,
+		requestID:   reqctx.RequestID(ctx),
+		clientIP:    reqctx.ClientIP(ctx),
+		traceParent: reqctx.TraceParent(ctx),
+	}
+	select {
+	case s.queue <- task:
+		return job, nil
+	default:
+		s.finishJob(context.WithoutCancel(ctx), task, models.ErrImportQueueFull)
+		return nil, models.ErrImportQueueFull
+	}
+}
+
+// createJob valida la cabecera del archivo y registra el job pendiente
+func (s *ImportService) createJob(ctx context.Context, path string, opts models.ImportOptions) (*models.ImportJob, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	_, header, err := newImportReader(file, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.ImportJob{
+		Status:    models.ImportPending,
+		Format:    opts.Format,
+		DryRun:    opts.DryRun,
+		FileName:  opts.FileName,
+		Header:    header,
+		CreatedBy: reqctx.Actor(ctx),
+		ExpiresAt: time.Now().Add(s.retention),
+	}
+	if err := s.importRepo.CreateJob(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Run ejecuta las importaciones asíncronas de una en una hasta que se cancele el contexto.
+// Las que no llegaron a terminar se marcan como fallidas.
+func (s *ImportService) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			s.drainQueue()
+			return
+		case task := <-s.queue:
+			s.runTask(ctx, task)
+		}
+	}
+}
+
+// drainQueue marca como fallidas las importaciones que quedaron pendientes al apagar el servidor
+func (s *ImportService) drainQueue() {
+	for {
+		select {
+		case task := <-s.queue:
+			s.finishJob(context.Background(), task, errImportInterrupted)
+		default:
+			return
+		}
+	}
+}
+
+// runTask ejecuta una importación asíncrona guardando el progreso y las filas rechazadas tras cada lote
+func (s *ImportService) runTask(ctx context.Context, task *importTask) {
+	job := task.job
+
+	// El span de la importación continúa la traza de la petición que la inició
+	ctx, span := tracing.Start(tracing.ContextWithTraceParent(ctx, task.traceParent), "ImportService.runTask")
+	defer span.End()
+
+	// La importación se registra en la auditoría con los datos de la petición que la inició
+	ctx = reqctx.WithActor(ctx, job.CreatedBy)
+	ctx = reqctx.WithRequestID(ctx, task.requestID)
+	ctx = reqctx.WithClientIP(ctx, task.clientIP)
+	ctx = reqctx.WithTraceParent(ctx, task.traceParent)
+
+	job.Status = models.ImportRunning
+	if err := s.importRepo.UpdateJob(ctx, job); err != nil {
+		s.finishJob(ctx, task, err)
+		return
+	}
+
+	file, err := os.Open(task.path)
+	if err != nil {
+		s.finishJob(ctx, task, err)
+		return
+	}
+	defer file.Close()
+
+	reader, _, err := newImportReader(file, task.opts)
+	if err != nil {
+		s.finishJob(ctx, task, err)
+		return
+	}
+
+	_, err = s.process(ctx, reader, task.opts, task.validate, func(stats models.ImportStats, rejections []models.ImportRejection) error {
+		if err := s.importRepo.AddRejections(ctx, job, rejections); err != nil {
+			return err
+		}
+		job.ImportStats = stats
+		return s.importRepo.UpdateJob(ctx, job)
+	})
+	s.finishJob(ctx, task, err)
+}
+
+// finishJob guarda el estado final del job y elimina la copia temporal del archivo.
+// Los errores inesperados no se exponen en el job.
+func (s *ImportService) finishJob(ctx context.Context, task *importTask, err error) {
+	job := task.job
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Status = models.ImportCompleted
+
+	if err != nil {
+		job.Status = models.ImportFailed
+		switch {
+		case errors.Is(err, models.ErrImportQueueFull), errors.Is(err, errImportInterrupted):
+			job.Error = err.Error()
+		case errors.Is(err, context.Canceled):
+			job.Error = errImportInterrupted.Error()
+		default:
+			slog.ErrorContext(ctx, "Import job failed", "job_id", job.ID.Hex(), "error", err)
+			job.Error = "internal error"
+		}
+	}
+
+	// El job se guarda aunque el contexto se haya cancelado durante el apagado
+	if err := s.importRepo.UpdateJob(context.WithoutCancel(ctx), job); err != nil {
+		slog.ErrorContext(ctx, "Error saving import job", "job_id", job.ID.Hex(), "error", err)
+	}
+	if err := os.Remove(task.path); err != nil {
+		slog.ErrorContext(ctx, "Error removing import file", "path", task.path, "error", err)
+	}
+}
+
+// process lee el archivo y crea los usuarios en lotes de hasta BULK_MAX_ITEMS filas.
+// Tras cada lote llama a onBatch con el progreso acumulado y las filas rechazadas del lote.
+func (s *ImportService) process(ctx context.Context, reader importReader, opts models.ImportOptions, validate RequestValidator, onBatch func(stats models.ImportStats, rejections []models.ImportRejection) error) (models.ImportStats, error) {
+	var stats models.ImportStats
+	var batch []*importRow
+	var rejections []models.ImportRejection
+
+	// En dry_run no se escribe nada, así que los emails repetidos entre lotes se detectan aquí
+	validEmails := make(map[string]bool)
+
+	reject := func(row *importRow, message string, fields []models.FieldError) {
+		rejections = append(rejections, row.rejection(message, fields))
+		stats.Rejected++
+	}
+	rejectError := func(row *importRow, err error) {
+		var validationErr *models.ValidationError
+		if errors.As(err, &validationErr) {
+			reject(row, err.Error(), validationErr.Fields)
+			return
+		}
+		reject(row, err.Error(), nil)
+	}
+
+	flush := func() error {
+		if len(batch) > 0 {
+			users := make([]models.CreateUserRequest, len(batch))
+			for i, row := range batch {
+				users[i] = row.user
+			}
+			response, err := s.userService.BulkCreateUsers(ctx, models.BulkCreateRequest{DryRun: opts.DryRun, Users: users}, validate)
+			if err != nil {
+				return err
+			}
+
+			for i, result := range response.Results {
+				if result.Status != models.BulkCreated && result.Status != models.BulkValid {
+					reject(batch[i], result.Error, result.Errors)
+					continue
+				}
+				stats.Created++
+				if opts.DryRun {
+					validEmails[s.canonicalEmail(batch[i].user.Email)] = true
+				}
+			}
+			batch = batch[:0]
+		}
+
+		// Las filas que no llegaron a validarse se rechazaron antes que las del lote
+		slices.SortFunc(rejections, func(a, b models.ImportRejection) int { return a.Line - b.Line })
+		err := onBatch(stats, rejections)
+		rejections = nil
+		return err
+	}
+
+	for {
+		row, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+		stats.Processed++
+
+		if row.err != nil {
+			rejectError(row, row.err)
+			continue
+		}
+		if len(row.user.Roles) > 0 && !opts.AllowRoles {
+			rejectError(row, fmt.Errorf("%w to assign roles", models.ErrForbidden))
+			continue
+		}
+		if err := s.userService.ValidateUserData(row.user); err != nil {
+			rejectError(row, err)
+			continue
+		}
+		if opts.DryRun && validEmails[s.canonicalEmail(row.user.Email)] {
+			rejectError(row, fmt.Errorf("%w in this file", models.ErrEmailTaken))
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) >= s.batchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	return stats, flush()
+}
+
+// canonicalEmail calcula la forma canónica de un email con las reglas configuradas
+func (s *ImportService) canonicalEmail(email string) string {
+	return models.CanonicalEmail(models.NormalizeEmail(email), s.emailProviderRules)
+}
+
+// GetImportJob obtiene el estado y el progreso de una importación asíncrona
+func (s *ImportService) GetImportJob(ctx context.Context, id string) (*models.ImportJob, error) {
+	return s.importRepo.GetJob(ctx, id)
+}
+
+// WriteRejections escribe el reporte de filas rechazadas del job en el formato del archivo
+// importado: en CSV, las columnas originales precedidas de la línea y el error; en NDJSON, un
+// objeto por fila rechazada.
+func (s *ImportService) WriteRejections(ctx context.Context, job *models.ImportJob, w io.Writer) error {
+	if job.Format == models.ImportNDJSON {
+		encoder := json.NewEncoder(w)
+		return s.importRepo.EachRejection(ctx, job.ID, func(rejection models.ImportRejection) error {
+			return encoder.Encode(rejection)
+		})
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(append([]string{"line", "error"}, job.Header...)); err != nil {
+		return err
+	}
+	err := s.importRepo.EachRejection(ctx, job.ID, func(rejection models.ImportRejection) error {
+		return writer.Write(append([]string{strconv.Itoa(rejection.Line), rejection.Error}, rejection.Record...))
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// copyToTempFile guarda el contenido de src en un archivo temporal y retorna su ruta
+func copyToTempFile(src io.Reader) (string, error) {
+	file, err := os.CreateTemp("", "users-import-*")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, src); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// ImportServiceInterface define los métodos del servicio de importación para facilitar el testing y la inyección de dependencias
+type ImportServiceInterface interface {
+	MaxFileSize() int64
+	ImportUsers(ctx context.Context, src io.Reader, size int64, opts models.ImportOptions, validate RequestValidator) (*models.ImportResult, error)
+	StartImport(ctx context.Context, src io.Reader, size int64, opts models.ImportOptions, validate RequestValidator) (*models.ImportJob, error)
+	GetImportJob(ctx context.Context, id string) (*models.ImportJob, error)
+	WriteRejections(ctx context.Context, job *models.ImportJob, w io.Writer) error
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// PurgeJob elimina periódicamente los usuarios que superaron el tiempo de retención en la papelera
+type PurgeJob struct {
+	userService UserServiceInterface
+	interval    time.Duration
+	retention   time.Duration
+}
+
+// NewPurgeJob crea el job de purga de la papelera
+func NewPurgeJob(userService UserServiceInterface, interval, retention time.Duration) *PurgeJob {
+	return &PurgeJob{
+		userService: userService,
+		interval:    interval,
+		retention:   retention,
+	}
+}
+
+// Run ejecuta la purga cada interval hasta que se cancele el contexto.
+// Un intervalo menor o igual a cero desactiva el job.
+func (j *PurgeJob) Run(ctx context.Context) {
+	if j.interval <= 0 {
+		slog.Info("Trash purge job disabled")
+		return
+	}
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purge ejecuta una pasada de purga registrando el resultado
+func (j *PurgeJob) purge(ctx context.Context) {
+	purged, err := j.userService.PurgeDeletedUsers(ctx, j.retention)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error purging deleted users", "error", err)
+		return
+	}
+	if purged > 0 {
+		slog.InfoContext(ctx, "Purged deleted users", "count", purged, "retention", j.retention)
+	}
+}
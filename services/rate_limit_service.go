@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+
+	"go-users-api/models"
+	"go-users-api/repository"
+)
+
+// RateLimitService aplica las políticas de límite de peticiones de cada grupo de rutas
+type RateLimitService struct {
+	store    repository.RateLimitRepositoryInterface
+	policies map[string]models.RateLimitPolicy
+}
+
+// NewRateLimitService crea el servicio con el almacén de buckets y las políticas por nombre
+func NewRateLimitService(store repository.RateLimitRepositoryInterface, policies map[string]models.RateLimitPolicy) *RateLimitService {
+	return &RateLimitService{
+		store:    store,
+		policies: policies,
+	}
+}
+
+// policy busca la política del grupo para el tipo de operación ("users.read" o "users.write")
+// y, si no existe, la del grupo completo ("users")
+func (s *RateLimitService) policy(group string, write bool) (models.RateLimitPolicy, bool) {
+	operation := group + ".read"
+	if write {
+		operation = group + ".write"
+	}
+	if policy, found := s.policies[operation]; found {
+		return policy, true
+	}
+	policy, found := s.policies[group]
+	return policy, found
+}
+
+// Allow consume un token del bucket del cliente identity en la política del grupo. Retorna nil
+// si el grupo no tiene política, en cuyo caso la petición no se limita.
+func (s *RateLimitService) Allow(ctx context.Context, group string, write bool, identity string) (*models.RateLimitResult, error) {
+	policy, found := s.policy(group, write)
+	if !found {
+		return nil, nil
+	}
+	// Cada política tiene sus propios buckets, aunque se compartan entre grupos
+	return s.store.Take(ctx, policy.Name+"|"+identity, policy)
+}
+
+// RateLimitServiceInterface define la interfaz del servicio de límite de peticiones
+type RateLimitServiceInterface interface {
+	Allow(ctx context.Context, group string, write bool, identity string) (*models.RateLimitResult, error)
+}
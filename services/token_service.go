@@ -0,0 +1,200 @@
+package services
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"go-users-api/config"
+	"go-users-api/models"
+)
+
+// Tipos de token emitidos por la API (claim "token_use")
+const (
+	TokenUseAccess  = "access"
+	TokenUseRefresh = "refresh"
+)
+
+// TokenClaims representa los claims de los tokens emitidos por la API
+type TokenClaims struct {
+	UUID     string        `json:"uuid,omitempty"` // UUID público del usuario; el subject es su ObjectID
+	Email    string        `json:"email,omitempty"`
+	Roles    []models.Role `json:"roles,omitempty"`
+	TokenUse string        `json:"token_use"`
+	FamilyID string        `json:"fid,omitempty"` // Solo en tokens de refresco: sesión a la que pertenece
+	jwt.RegisteredClaims
+}
+
+// TokenService firma y valida los JWT usados para autenticar las peticiones
+type TokenService struct {
+	method     jwt.SigningMethod
+	signKey    interface{}
+	verifyKey  interface{}
+	issuer     string
+	audience   string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// NewTokenService crea una nueva instancia del servicio de tokens a partir de la configuración
+func NewTokenService(cfg *config.Config) (*TokenService, error) {
+	service := &TokenService{
+		issuer:     cfg.JWTIssuer,
+		audience:   cfg.JWTAudience,
+		accessTTL:  cfg.AccessTokenTTL,
+		refreshTTL: cfg.RefreshTokenTTL,
+	}
+
+	switch cfg.JWTAlgorithm {
+	case "HS256":
+		if cfg.JWTSecret == "" {
+			return nil, errors.New("JWT_SECRET is required for HS256")
+		}
+		service.method = jwt.SigningMethodHS256
+		service.signKey = []byte(cfg.JWTSecret)
+		service.verifyKey = []byte(cfg.JWTSecret)
+	case "RS256":
+		publicKey, err := loadRSAPublicKey(cfg.JWTPublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		service.method = jwt.SigningMethodRS256
+		service.verifyKey = publicKey
+
+		// La clave privada es opcional: sin ella el servicio solo puede validar tokens
+		if cfg.JWTPrivateKeyFile != "" {
+			privateKey, err := loadRSAPrivateKey(cfg.JWTPrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			service.signKey = privateKey
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.JWTAlgorithm)
+	}
+
+	return service, nil
+}
+
+// GenerateAccessToken emite un token de acceso firmado para el usuario
+func (s *TokenService) GenerateAccessToken(user *models.User) (string, error) {
+	token, _, err := s.generate(user, TokenUseAccess, "", s.accessTTL)
+	return token, err
+}
+
+// GenerateRefreshToken emite un token de refresco firmado para el usuario dentro de la familia
+// (sesión) indicada. Retorna también los claims para poder registrarlo.
+func (s *TokenService) GenerateRefreshToken(user *models.User, familyID string) (string, *TokenClaims, error) {
+	return s.generate(user, TokenUseRefresh, familyID, s.refreshTTL)
+}
+
+// ParseAccessToken valida un token de acceso y retorna sus claims
+func (s *TokenService) ParseAccessToken(tokenString string) (*TokenClaims, error) {
+	return s.parse(tokenString, TokenUseAccess)
+}
+
+// ParseRefreshToken valida un token de refresco y retorna sus claims
+func (s *TokenService) ParseRefreshToken(tokenString string) (*TokenClaims, error) {
+	return s.parse(tokenString, TokenUseRefresh)
+}
+
+// AccessTokenTTL retorna la duración de los tokens de acceso
+func (s *TokenService) AccessTokenTTL() time.Duration {
+	return s.accessTTL
+}
+
+// generate firma un token del tipo indicado con un identificador (jti) único
+func (s *TokenService) generate(user *models.User, tokenUse, familyID string, ttl time.Duration) (string, *TokenClaims, error) {
+	if s.signKey == nil {
+		return "", nil, errors.New("token signing key not configured")
+	}
+
+	now := time.Now()
+	claims := &TokenClaims{
+		UUID:     user.UUID,
+		Email:    user.Email,
+		Roles:    user.GetRoles(),
+		TokenUse: tokenUse,
+		FamilyID: familyID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Subject:   user.ID.Hex(),
+			Issuer:    s.issuer,
+			Audience:  jwt.ClaimStrings{s.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(s.method, claims).SignedString(s.signKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, claims, nil
+}
+
+// parse valida la firma y los claims del token y comprueba que sea del tipo esperado
+func (s *TokenService) parse(tokenString, tokenUse string) (*TokenClaims, error) {
+	claims := &TokenClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.verifyKey, nil
+	},
+		jwt.WithValidMethods([]string{s.method.Alg()}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(s.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, models.ErrTokenExpired
+		}
+		return nil, models.ErrInvalidToken
+	}
+
+	// Un token de refresco no puede usarse como token de acceso (ni al revés)
+	if claims.Subject == "" || claims.TokenUse != tokenUse {
+		return nil, models.ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// loadRSAPublicKey lee una clave pública RSA en formato PEM
+func loadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	if path == "" {
+		return nil, errors.New("JWT_PUBLIC_KEY_FILE is required for RS256")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading JWT public key: %w", err)
+	}
+
+	return jwt.ParseRSAPublicKeyFromPEM(data)
+}
+
+// loadRSAPrivateKey lee una clave privada RSA en formato PEM
+func loadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading JWT private key: %w", err)
+	}
+
+	return jwt.ParseRSAPrivateKeyFromPEM(data)
+}
+
+// TokenServiceInterface define los métodos del servicio de tokens para facilitar el testing y la inyección de dependencias
+type TokenServiceInterface interface {
+	GenerateAccessToken(user *models.User) (string, error)
+	GenerateRefreshToken(user *models.User, familyID string) (string, *TokenClaims, error)
+	ParseAccessToken(tokenString string) (*TokenClaims, error)
+	ParseRefreshToken(tokenString string) (*TokenClaims, error)
+	AccessTokenTTL() time.Duration
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"go-users-api/models"
+	"go-users-api/tracing"
+)
+
+// tracedUserService envuelve un UserServiceInterface para crear un span por cada método del
+// servicio, del que cuelgan los spans de las operaciones del repositorio que ejecuta
+type tracedUserService struct {
+	svc UserServiceInterface
+}
+
+// NewTracedUserService envuelve el servicio para trazar cada uno de sus métodos
+func NewTracedUserService(svc UserServiceInterface) UserServiceInterface {
+	return &tracedUserService{svc: svc}
+}
+
+func (s *tracedUserService) CreateUser(ctx context.Context, req models.CreateUserRequest) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.CreateUser")
+	defer tracing.End(span, &err)
+	return s.svc.CreateUser(ctx, req)
+}
+
+func (s *tracedUserService) GetUserByID(ctx context.Context, id string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserByID")
+	defer tracing.End(span, &err)
+	return s.svc.GetUserByID(ctx, id)
+}
+
+func (s *tracedUserService) GetUserByUUID(ctx context.Context, uuid string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserByUUID")
+	defer tracing.End(span, &err)
+	return s.svc.GetUserByUUID(ctx, uuid)
+}
+
+func (s *tracedUserService) GetUsers(ctx context.Context, query models.UserListQuery) (_ *models.UsersResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUsers")
+	defer tracing.End(span, &err)
+	return s.svc.GetUsers(ctx, query)
+}
+
+func (s *tracedUserService) ReplaceUser(ctx context.Context, id string, req models.ReplaceUserRequest, expectedVersion *int64) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.ReplaceUser")
+	defer tracing.End(span, &err)
+	return s.svc.ReplaceUser(ctx, id, req, expectedVersion)
+}
+
+func (s *tracedUserService) PatchUser(ctx context.Context, id string, patch models.UserPatch, expectedVersion *int64, allowRoles bool, validate RequestValidator) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.PatchUser")
+	defer tracing.End(span, &err)
+	return s.svc.PatchUser(ctx, id, patch, expectedVersion, allowRoles, validate)
+}
+
+func (s *tracedUserService) DeleteUser(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteUser")
+	defer tracing.End(span, &err)
+	return s.svc.DeleteUser(ctx, id)
+}
+
+func (s *tracedUserService) GetDeletedUsers(ctx context.Context, query models.UserListQuery) (_ *models.UsersResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetDeletedUsers")
+	defer tracing.End(span, &err)
+	return s.svc.GetDeletedUsers(ctx, query)
+}
+
+func (s *tracedUserService) PrepareUserExport(ctx context.Context, query models.UserExportQuery) (_ *models.UserExport, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.PrepareUserExport")
+	defer tracing.End(span, &err)
+	return s.svc.PrepareUserExport(ctx, query)
+}
+
+func (s *tracedUserService) ExportUsers(ctx context.Context, export *models.UserExport, w io.Writer) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.ExportUsers")
+	defer tracing.End(span, &err)
+	return s.svc.ExportUsers(ctx, export, w)
+}
+
+func (s *tracedUserService) RestoreUser(ctx context.Context, id string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.RestoreUser")
+	defer tracing.End(span, &err)
+	return s.svc.RestoreUser(ctx, id)
+}
+
+func (s *tracedUserService) PurgeDeletedUsers(ctx context.Context, retention time.Duration) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.PurgeDeletedUsers")
+	defer tracing.End(span, &err)
+	return s.svc.PurgeDeletedUsers(ctx, retention)
+}
+
+func (s *tracedUserService) BulkCreateUsers(ctx context.Context, req models.BulkCreateRequest, validate RequestValidator) (_ *models.BulkResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.BulkCreateUsers")
+	defer tracing.End(span, &err)
+	return s.svc.BulkCreateUsers(ctx, req, validate)
+}
+
+func (s *tracedUserService) BulkUpdateUsers(ctx context.Context, req models.BulkUpdateRequest, allowRoles bool, validate RequestValidator) (_ *models.BulkResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.BulkUpdateUsers")
+	defer tracing.End(span, &err)
+	return s.svc.BulkUpdateUsers(ctx, req, allowRoles, validate)
+}
+
+func (s *tracedUserService) BulkDeleteUsers(ctx context.Context, req models.BulkDeleteRequest) (_ *models.BulkResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.BulkDeleteUsers")
+	defer tracing.End(span, &err)
+	return s.svc.BulkDeleteUsers(ctx, req)
+}
+
+func (s *tracedUserService) GetUserByEmail(ctx context.Context, email string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserByEmail")
+	defer tracing.End(span, &err)
+	return s.svc.GetUserByEmail(ctx, email)
+}
+
+func (s *tracedUserService) Authenticate(ctx context.Context, email, password string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Authenticate")
+	defer tracing.End(span, &err)
+	return s.svc.Authenticate(ctx, email, password)
+}
+
+// ValidateUserData no recibe contexto ni accede a la base de datos, así que no se traza
+func (s *tracedUserService) ValidateUserData(req models.CreateUserRequest) error {
+	return s.svc.ValidateUserData(req)
+}
@@ -0,0 +1,362 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-users-api/metrics"
+	"go-users-api/models"
+	"go-users-api/reqctx"
+)
+
+// bulkItem es un elemento de una petición masiva listo para escribirse
+type bulkItem struct {
+	index  int          // Posición en la petición
+	before *models.User // Estado anterior para la auditoría; nil en las altas
+	user   *models.User
+}
+
+// bulkWrite escribe los usuarios de los elementos válidos y retorna un error por usuario
+type bulkWrite func(users []*models.User) ([]error, error)
+
+// BulkCreateUsers crea varios usuarios en una sola escritura. Los elementos no válidos o con el
+// email en uso se informan en su resultado; con req.Atomic no se crea ninguno si alguno falla.
+// Con req.DryRun solo se valida cada elemento, sin crear ninguno.
+func (s *UserService) BulkCreateUsers(ctx context.Context, req models.BulkCreateRequest, validate RequestValidator) (*models.BulkResponse, error) {
+	if err := s.checkBulkSize("users", len(req.Users)); err != nil {
+		return nil, err
+	}
+
+	results := newBulkResults(len(req.Users))
+	emails := make(map[string]bool)
+	var items []bulkItem
+	for i, item := range req.Users {
+		if err := validate(&item); err != nil {
+			results[i] = bulkErrorResult(ctx, i, err)
+			continue
+		}
+
+		item.Email = models.NormalizeEmail(item.Email)
+		canonicalEmail := s.CanonicalEmail(item.Email)
+		if emails[canonicalEmail] {
+			results[i] = bulkErrorResult(ctx, i, fmt.Errorf("%w in this request", models.ErrEmailTaken))
+			continue
+		}
+		emails[canonicalEmail] = true
+
+		user := models.NewUser(item)
+		user.EmailCanonical = canonicalEmail
+		// En dry_run no se calcula el hash: bcrypt es costoso y el usuario no se guarda
+		if item.Password != "" && !req.DryRun {
+			if err := user.SetPassword(item.Password); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, bulkItem{index: i, user: user})
+	}
+
+	if req.DryRun {
+		return s.checkBulkCreate(ctx, req.Atomic, results, items)
+	}
+
+	write := func(users []*models.User) ([]error, error) {
+		return s.userRepo.BulkCreate(ctx, users, req.Atomic)
+	}
+	return s.applyBulk(ctx, req.Atomic, results, items, write, models.BulkCreated, models.AuditUserCreated)
+}
+
+// checkBulkCreate completa los resultados de un alta masiva en dry_run: los elementos válidos
+// cuyo email no está en uso se marcan como valid, sin escribir nada
+func (s *UserService) checkBulkCreate(ctx context.Context, atomic bool, results []models.BulkItemResult, items []bulkItem) (*models.BulkResponse, error) {
+	if len(items) > 0 {
+		emails := make([]string, len(items))
+		for k, item := range items {
+			emails[k] = item.user.EmailCanonical
+		}
+		taken, err := s.userRepo.FindTakenEmails(ctx, emails)
+		if err != nil {
+			return nil, err
+		}
+
+		takenSet := make(map[string]bool, len(taken))
+		for _, email := range taken {
+			takenSet[email] = true
+		}
+		for _, item := range items {
+			if takenSet[item.user.EmailCanonical] {
+				results[item.index] = bulkErrorResult(ctx, item.index, models.ErrEmailTaken)
+			} else {
+				results[item.index].Status = models.BulkValid
+			}
+		}
+	}
+
+	return newBulkResponse(atomic, false, results, models.BulkValid), nil
+}
+
+// BulkUpdateUsers aplica un JSON Merge Patch a cada usuario indicado en una sola escritura,
+// con las mismas validaciones y permisos que PATCH. Con req.Atomic no se modifica ninguno si alguno falla.
+func (s *UserService) BulkUpdateUsers(ctx context.Context, req models.BulkUpdateRequest, allowRoles bool, validate RequestValidator) (*models.BulkResponse, error) {
+	if err := s.checkBulkSize("users", len(req.Users)); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(req.Users))
+	for i, item := range req.Users {
+		ids[i] = item.ID
+	}
+	results := newBulkResults(len(req.Users))
+	stored, err := s.loadBulkUsers(ctx, ids, results)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []bulkItem
+	for i, item := range req.Users {
+		if results[i].Status != "" {
+			continue
+		}
+
+		user, err := s.prepareBulkUpdate(stored[i], item, allowRoles, validate)
+		if err != nil {
+			results[i] = bulkErrorResult(ctx, i, err)
+			continue
+		}
+		items = append(items, bulkItem{index: i, before: stored[i], user: user})
+	}
+
+	write := func(users []*models.User) ([]error, error) {
+		return s.userRepo.BulkUpdate(ctx, users, req.Atomic)
+	}
+	return s.applyBulk(ctx, req.Atomic, results, items, write, models.BulkUpdated, models.AuditUserUpdated)
+}
+
+// prepareBulkUpdate aplica los cambios de un elemento sobre una copia del usuario. Sin allowRoles
+// rechaza los cambios cuyo resultado asigna otros roles que los guardados.
+func (s *UserService) prepareBulkUpdate(stored *models.User, item models.BulkUpdateItem, allowRoles bool, validate RequestValidator) (*models.User, error) {
+	if item.Version != nil && stored.Version != *item.Version {
+		return nil, models.ErrPreconditionFailed
+	}
+	if len(item.Changes) == 0 {
+		return nil, models.NewValidationError(models.FieldError{Field: "changes", Message: "is required"})
+	}
+
+	patch, err := models.NewUserPatch(models.MIMEMergePatch, item.Changes)
+	if err != nil {
+		return nil, err
+	}
+	req, err := patch.Apply(stored.ToReplaceRequest())
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(&req); err != nil {
+		return nil, err
+	}
+	if err := checkRoleChange(stored, req.Roles, allowRoles); err != nil {
+		return nil, err
+	}
+
+	req.Email = models.NormalizeEmail(req.Email)
+	user := *stored
+	user.Replace(req)
+	user.EmailCanonical = s.CanonicalEmail(req.Email)
+	return &user, nil
+}
+
+// BulkDeleteUsers mueve varios usuarios a la papelera en una sola escritura.
+// Con req.Atomic no se elimina ninguno si alguno falla.
+func (s *UserService) BulkDeleteUsers(ctx context.Context, req models.BulkDeleteRequest) (*models.BulkResponse, error) {
+	if err := s.checkBulkSize("ids", len(req.IDs)); err != nil {
+		return nil, err
+	}
+
+	results := newBulkResults(len(req.IDs))
+	stored, err := s.loadBulkUsers(ctx, req.IDs, results)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []bulkItem
+	for i := range req.IDs {
+		if results[i].Status != "" {
+			continue
+		}
+		user := *stored[i]
+		items = append(items, bulkItem{index: i, before: stored[i], user: &user})
+	}
+
+	write := func(users []*models.User) ([]error, error) {
+		return s.userRepo.BulkDelete(ctx, users, reqctx.Actor(ctx), req.Atomic)
+	}
+	return s.applyBulk(ctx, req.Atomic, results, items, write, models.BulkDeleted, models.AuditUserDeleted)
+}
+
+// loadBulkUsers obtiene con una sola consulta los usuarios activos de cada ID, en la misma
+// posición. Los IDs no válidos, inexistentes o repetidos se marcan como fallidos en results.
+func (s *UserService) loadBulkUsers(ctx context.Context, ids []string, results []models.BulkItemResult) ([]*models.User, error) {
+	var valid []string
+	for i, id := range ids {
+		if !models.IsValidUserID(id) {
+			results[i] = bulkErrorResult(ctx, i, models.ErrInvalidID)
+			continue
+		}
+		valid = append(valid, id)
+	}
+
+	found := make(map[string]*models.User)
+	if len(valid) > 0 {
+		users, err := s.userRepo.GetByIDs(ctx, valid)
+		if err != nil {
+			return nil, err
+		}
+		for i := range users {
+			found[users[i].ID.Hex()] = &users[i]
+			found[strings.ToLower(users[i].UUID)] = &users[i]
+		}
+	}
+
+	stored := make([]*models.User, len(ids))
+	seen := make(map[primitive.ObjectID]bool)
+	for i, id := range ids {
+		if results[i].Status != "" {
+			continue
+		}
+		user, exists := found[strings.ToLower(id)]
+		if !exists {
+			results[i] = bulkErrorResult(ctx, i, models.ErrNotFound)
+			continue
+		}
+		// Un mismo usuario solo puede aparecer una vez, aunque se indique por ObjectID y por UUID
+		if seen[user.ID] {
+			results[i] = bulkErrorResult(ctx, i, models.NewValidationError(models.FieldError{
+				Field:   "id",
+				Message: "user appears more than once in the request",
+			}))
+			continue
+		}
+		seen[user.ID] = true
+		stored[i] = user
+	}
+	return stored, nil
+}
+
+// applyBulk escribe los elementos válidos y completa sus resultados. En modo atómico no se
+// escribe nada si algún elemento ya falló, y si alguno falla al escribir no se aplica ninguno.
+// Si la escritura no se puede ejecutar se retorna el error en lugar de los resultados.
+func (s *UserService) applyBulk(ctx context.Context, atomic bool, results []models.BulkItemResult, items []bulkItem, write bulkWrite, success models.BulkItemStatus, action models.AuditAction) (*models.BulkResponse, error) {
+	if len(items) > 0 && !(atomic && hasBulkFailures(results)) {
+		users := make([]*models.User, len(items))
+		for k, item := range items {
+			users[k] = item.user
+		}
+
+		itemErrs, err := write(users)
+		if err != nil {
+			return nil, err
+		}
+		for k, item := range items {
+			if itemErrs[k] != nil {
+				results[item.index] = bulkErrorResult(ctx, item.index, itemErrs[k])
+			}
+		}
+	}
+
+	committed := !atomic || !hasBulkFailures(results)
+	for _, item := range items {
+		result := &results[item.index]
+		if result.Status != "" {
+			continue
+		}
+		if !committed {
+			result.Status = models.BulkSkipped
+			continue
+		}
+
+		result.Status = success
+		result.ID = item.user.ID.Hex()
+		result.UUID = item.user.UUID
+		result.Version = item.user.Version
+		s.audit.Record(ctx, action, item.before, item.user)
+	}
+
+	return newBulkResponse(atomic, committed, results, success), nil
+}
+
+// newBulkResponse crea la respuesta de una operación masiva contando los elementos con el
+// estado success como aplicados y el resto como fallidos
+func newBulkResponse(atomic, committed bool, results []models.BulkItemResult, success models.BulkItemStatus) *models.BulkResponse {
+	response := &models.BulkResponse{Atomic: atomic, Committed: committed, Results: results}
+	for _, result := range results {
+		if result.Status == success {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+	return response
+}
+
+// checkBulkSize verifica que la petición no supere el número máximo de elementos
+func (s *UserService) checkBulkSize(field string, size int) error {
+	if int64(size) > s.bulkMaxItems {
+		return models.NewValidationError(models.FieldError{
+			Field:   field,
+			Message: fmt.Sprintf("must contain at most %d items", s.bulkMaxItems),
+		})
+	}
+	return nil
+}
+
+// newBulkResults crea los resultados vacíos de una petición con size elementos
+func newBulkResults(size int) []models.BulkItemResult {
+	results := make([]models.BulkItemResult, size)
+	for i := range results {
+		results[i].Index = i
+	}
+	return results
+}
+
+// hasBulkFailures indica si algún elemento ya tiene un resultado de error
+func hasBulkFailures(results []models.BulkItemResult) bool {
+	for _, result := range results {
+		if result.Status != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// bulkErrorResult convierte el error de un elemento en su resultado
+func bulkErrorResult(ctx context.Context, index int, err error) models.BulkItemResult {
+	result := models.BulkItemResult{Index: index, Error: err.Error()}
+
+	var validationErr *models.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		result.Status = models.BulkInvalid
+		result.Errors = validationErr.Fields
+	case errors.Is(err, models.ErrInvalidID):
+		result.Status = models.BulkInvalid
+	case errors.Is(err, models.ErrNotFound):
+		result.Status = models.BulkNotFound
+	case errors.Is(err, models.ErrForbidden):
+		result.Status = models.BulkForbidden
+	case errors.Is(err, models.ErrEmailTaken),
+		errors.Is(err, models.ErrVersionConflict),
+		errors.Is(err, models.ErrPreconditionFailed),
+		errors.Is(err, models.ErrPatchTestFailed):
+		metrics.ObserveConflict(err)
+		result.Status = models.BulkConflict
+	default:
+		// No se exponen los detalles de errores inesperados
+		slog.ErrorContext(ctx, "Bulk item failed", "index", index, "error", err)
+		result.Status = models.BulkFailed
+		result.Error = "internal error"
+	}
+	return result
+}
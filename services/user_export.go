@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"io"
+
+	"go-users-api/models"
+)
+
+// PrepareUserExport valida los parámetros de una exportación. Se llama antes de escribir la
+// respuesta para que los errores de la consulta puedan responderse con su código de estado.
+func (s *UserService) PrepareUserExport(ctx context.Context, query models.UserExportQuery) (*models.UserExport, error) {
+	filter, err := s.buildUserFilter(query.ListQuery())
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := models.ParseExportColumns(query.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &models.UserExport{Format: models.ExportFormat(query.Format), Columns: columns, Filter: filter}
+	if export.Format == "" {
+		export.Format = models.ExportCSV
+	}
+
+	// Una hoja de Excel tiene un número máximo de filas; se comprueba antes de empezar a escribir
+	if export.Format == models.ExportXLSX {
+		total, err := s.userRepo.Count(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		if total >= xlsxMaxRows {
+			return nil, models.NewValidationError(models.FieldError{Field: "format", Message: errXLSXRowLimit.Error()})
+		}
+	}
+
+	return export, nil
+}
+
+// ExportUsers escribe en w todos los usuarios que cumplen el filtro de la exportación, leyéndolos
+// del cursor de la base de datos de uno en uno, por lo que la memoria no depende del número de usuarios
+func (s *UserService) ExportUsers(ctx context.Context, export *models.UserExport, w io.Writer) error {
+	writer, err := newUserExportWriter(w, export.Format, export.Columns)
+	if err != nil {
+		return err
+	}
+
+	err = s.userRepo.Each(ctx, export.Filter, func(user *models.User) error {
+		response := user.ToResponse()
+		if export.MaskPII {
+			response = response.MaskPII()
+		}
+		return writer.WriteUser(&response)
+	})
+	if err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
@@ -3,37 +3,75 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"strconv"
+	"strings"
+	"time"
 
+	"go-users-api/config"
 	"go-users-api/models"
 	"go-users-api/repository"
+	"go-users-api/reqctx"
 )
 
+// dummyPasswordHash se compara cuando el usuario no existe para que el tiempo de respuesta
+// no revele qué emails están registrados
+const dummyPasswordHash = "$2a$10$QmlcG.o.qhzCQcKYKELEK.x7oybyUKaAJVrCrfGvpOZT1LRqTgcoa"
+
 // UserService maneja la lógica de negocio para usuarios
 type UserService struct {
-	userRepo repository.UserRepositoryInterface
+	userRepo     repository.UserRepositoryInterface
+	audit        AuditServiceInterface
+	cursors      *CursorCodec
+	maxPageLimit int64
+	bulkMaxItems int64
+
+	// emailProviderRules aplica las reglas de cada proveedor al calcular el email canónico
+	emailProviderRules bool
 }
 
 // NewUserService crea una nueva instancia del servicio de usuarios
-func NewUserService(userRepo repository.UserRepositoryInterface) *UserService {
+func NewUserService(userRepo repository.UserRepositoryInterface, audit AuditServiceInterface, cfg *config.Config) *UserService {
 	return &UserService{
-		userRepo: userRepo,
+		userRepo:     userRepo,
+		audit:        audit,
+		cursors:      NewCursorCodec(cfg.CursorSecret),
+		maxPageLimit: cfg.MaxPageLimit,
+		bulkMaxItems: cfg.BulkMaxItems,
+
+		emailProviderRules: cfg.EmailProviderRules,
 	}
 }
 
+// CanonicalEmail retorna la forma canónica del email con la que se buscan los usuarios
+func (s *UserService) CanonicalEmail(email string) string {
+	return models.CanonicalEmail(email, s.emailProviderRules)
+}
+
 // CreateUser crea un nuevo usuario
 func (s *UserService) CreateUser(ctx context.Context, req models.CreateUserRequest) (*models.User, error) {
-	// Verificar si el email ya existe
-	exists, err := s.userRepo.ExistsByEmail(ctx, req.Email)
+	req.Email = models.NormalizeEmail(req.Email)
+	canonicalEmail := s.CanonicalEmail(req.Email)
+
+	// Verificar si el email ya existe. Dos altas simultáneas pueden pasar esta comprobación;
+	// en ese caso el índice único hace que Create retorne ErrEmailTaken.
+	exists, err := s.userRepo.ExistsByEmail(ctx, canonicalEmail)
 	if err != nil {
 		return nil, err
 	}
 	if exists {
-		return nil, errors.New("email already exists")
+		return nil, models.ErrEmailTaken
 	}
 
 	// Crear nuevo usuario
 	user := models.NewUser(req)
+	user.EmailCanonical = canonicalEmail
+	if req.Password != "" {
+		if err := user.SetPassword(req.Password); err != nil {
+			return nil, err
+		}
+	}
 
 	// Guardar en la base de datos
 	err = s.userRepo.Create(ctx, user)
@@ -41,10 +79,11 @@ func (s *UserService) CreateUser(ctx context.Context, req models.CreateUserReque
 		return nil, err
 	}
 
+	s.audit.Record(ctx, models.AuditUserCreated, nil, user)
 	return user, nil
 }
 
-// GetUserByID obtiene un usuario por su ID
+// GetUserByID obtiene un usuario por su ID (ObjectID o UUID)
 func (s *UserService) GetUserByID(ctx context.Context, id string) (*models.User, error) {
 	user, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
@@ -54,83 +93,320 @@ func (s *UserService) GetUserByID(ctx context.Context, id string) (*models.User,
 	return user, nil
 }
 
-// GetUsers obtiene todos los usuarios con paginación
-func (s *UserService) GetUsers(ctx context.Context, pageStr, limitStr string) (*models.UsersResponse, error) {
-	// Parsear parámetros de paginación
-	page, err := strconv.ParseInt(pageStr, 10, 64)
+// GetUserByUUID obtiene un usuario por su UUID público
+func (s *UserService) GetUserByUUID(ctx context.Context, uuid string) (*models.User, error) {
+	return s.userRepo.GetByUUID(ctx, uuid)
+}
+
+// GetUsers obtiene los usuarios que cumplen los filtros de la consulta, paginados por página
+// o por cursor si la consulta incluye el parámetro cursor
+func (s *UserService) GetUsers(ctx context.Context, query models.UserListQuery) (*models.UsersResponse, error) {
+	return s.listUsers(ctx, query, false)
+}
+
+// GetDeletedUsers obtiene los usuarios de la papelera con los mismos filtros y paginación que GetUsers
+func (s *UserService) GetDeletedUsers(ctx context.Context, query models.UserListQuery) (*models.UsersResponse, error) {
+	return s.listUsers(ctx, query, true)
+}
+
+// listUsers obtiene los usuarios activos o los de la papelera según deleted
+func (s *UserService) listUsers(ctx context.Context, query models.UserListQuery, deleted bool) (*models.UsersResponse, error) {
+	page, limit := parsePagination(query.Page, query.Limit, s.maxPageLimit)
+
+	filter, err := s.buildUserFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	filter.Deleted = deleted
+
+	var response *models.UsersResponse
+	if query.Cursor != nil {
+		response, err = s.getUsersByCursor(ctx, filter, *query.Cursor, limit)
+	} else {
+		response, err = s.getUsersByPage(ctx, filter, page, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// El total requiere recorrer todos los documentos que cumplen el filtro, por lo que es opcional
+	if query.IncludeTotal == nil || *query.IncludeTotal {
+		total, err := s.userRepo.Count(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		response.Total = &total
+	}
+
+	return response, nil
+}
+
+// parsePagination interpreta los parámetros page y limit, usando los valores por defecto
+// si no son válidos y limitando limit a maxLimit
+func parsePagination(rawPage, rawLimit string, maxLimit int64) (page, limit int64) {
+	page, err := strconv.ParseInt(rawPage, 10, 64)
 	if err != nil || page < 1 {
 		page = 1
 	}
 
-	limit, err := strconv.ParseInt(limitStr, 10, 64)
+	limit, err = strconv.ParseInt(rawLimit, 10, 64)
 	if err != nil || limit < 1 {
 		limit = 10
 	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
 
-	// Obtener usuarios de la base de datos
-	users, total, err := s.userRepo.GetAll(ctx, page, limit)
+	return page, limit
+}
+
+// getUsersByPage obtiene una página del listado usando skip/limit
+func (s *UserService) getUsersByPage(ctx context.Context, filter models.UserFilter, page, limit int64) (*models.UsersResponse, error) {
+	users, err := s.userRepo.GetAll(ctx, filter, page, limit)
 	if err != nil {
 		return nil, err
 	}
 
-	// Convertir a respuesta
+	return &models.UsersResponse{Users: toUserResponses(users)}, nil
+}
+
+// getUsersByCursor obtiene una página del listado a continuación del cursor (keyset sobre created_at, _id)
+func (s *UserService) getUsersByCursor(ctx context.Context, filter models.UserFilter, rawCursor string, limit int64) (*models.UsersResponse, error) {
+	if len(filter.Sort) != 1 || filter.Sort[0] != models.DefaultUserSort[0] {
+		return nil, models.NewValidationError(models.FieldError{Field: "sort", Message: "is not supported with cursor pagination"})
+	}
+
+	var cursor *models.UserCursor
+	if rawCursor != "" {
+		var err error
+		if cursor, err = s.cursors.Decode(rawCursor); err != nil {
+			return nil, err
+		}
+	}
+
+	// Se pide un elemento extra para saber si hay más resultados después de la página
+	users, err := s.userRepo.GetPage(ctx, filter, cursor, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := int64(len(users)) > limit
+	if hasMore {
+		users = users[:limit]
+	}
+
+	backward := cursor != nil && cursor.Backward
+	if backward {
+		// La página anterior llega en orden inverso
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+
+	response := &models.UsersResponse{Users: toUserResponses(users)}
+	if len(users) == 0 {
+		return response, nil
+	}
+
+	first, last := users[0], users[len(users)-1]
+	if hasMore || backward {
+		response.NextCursor = s.cursors.Encode(models.UserCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	if (hasMore && backward) || (cursor != nil && !backward) {
+		response.PrevCursor = s.cursors.Encode(models.UserCursor{CreatedAt: first.CreatedAt, ID: first.ID, Backward: true})
+	}
+
+	return response, nil
+}
+
+// toUserResponses convierte los usuarios a su representación de respuesta
+func toUserResponses(users []models.User) []models.UserResponse {
 	userResponses := make([]models.UserResponse, len(users))
 	for i, user := range users {
 		userResponses[i] = user.ToResponse()
 	}
+	return userResponses
+}
+
+// buildUserFilter valida los filtros de la consulta y los convierte en un UserFilter
+func (s *UserService) buildUserFilter(query models.UserListQuery) (models.UserFilter, error) {
+	sort, err := models.ParseUserSort(query.Sort)
+	if err != nil {
+		return models.UserFilter{}, err
+	}
+
+	var fieldErrors []models.FieldError
+	if query.MinAge != nil && query.MaxAge != nil && *query.MinAge > *query.MaxAge {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "min_age", Message: "must be less than or equal to max_age"})
+	}
+	if query.CreatedFrom != nil && query.CreatedTo != nil && query.CreatedFrom.After(*query.CreatedTo) {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "created_from", Message: "must be before created_to"})
+	}
+	if len(fieldErrors) > 0 {
+		return models.UserFilter{}, models.NewValidationError(fieldErrors...)
+	}
 
-	return &models.UsersResponse{
-		Users: userResponses,
-		Total: total,
+	return models.UserFilter{
+		Name:        strings.TrimSpace(query.Name),
+		Email:       strings.TrimSpace(query.Email),
+		MinAge:      query.MinAge,
+		MaxAge:      query.MaxAge,
+		CreatedFrom: query.CreatedFrom,
+		CreatedTo:   query.CreatedTo,
+		Search:      strings.TrimSpace(query.Search),
+		Sort:        sort,
 	}, nil
 }
 
-// UpdateUser actualiza un usuario existente
-func (s *UserService) UpdateUser(ctx context.Context, id string, req models.UpdateUserRequest) (*models.User, error) {
-	// Obtener usuario existente
+// RequestValidator valida una petición con las reglas declaradas en sus tags binding
+type RequestValidator func(req any) error
+
+// ReplaceUser reemplaza los campos editables de un usuario existente (PUT).
+// Si expectedVersion no es nil (header If-Match) la actualización solo se aplica sobre esa versión.
+func (s *UserService) ReplaceUser(ctx context.Context, id string, req models.ReplaceUserRequest, expectedVersion *int64) (*models.User, error) {
+	user, err := s.getForUpdate(ctx, id, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.saveReplacement(ctx, id, user, req, expectedVersion)
+}
+
+// PatchUser aplica una modificación parcial (JSON Merge Patch o JSON Patch) sobre un usuario existente.
+// El resultado se valida con validate usando las mismas reglas que una actualización completa.
+func (s *UserService) PatchUser(ctx context.Context, id string, patch models.UserPatch, expectedVersion *int64, allowRoles bool, validate RequestValidator) (*models.User, error) {
+	user, err := s.getForUpdate(ctx, id, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := patch.Apply(user.ToReplaceRequest())
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(&req); err != nil {
+		return nil, err
+	}
+	if err := checkRoleChange(user, req.Roles, allowRoles); err != nil {
+		return nil, err
+	}
+
+	return s.saveReplacement(ctx, id, user, req, expectedVersion)
+}
+
+// checkRoleChange rechaza con ErrForbidden los cambios de roles si no se permiten. Se decide con
+// el resultado de aplicar el patch y no con su contenido: json.Unmarshal acepta claves con otras
+// mayúsculas ("Roles"), así que inspeccionar las claves del patch no basta.
+func checkRoleChange(user *models.User, roles []models.Role, allowRoles bool) error {
+	if allowRoles || models.SameRoles(user.GetRoles(), roles) {
+		return nil
+	}
+	return fmt.Errorf("%w to assign roles", models.ErrForbidden)
+}
+
+// getForUpdate obtiene el usuario a modificar verificando la versión exigida por If-Match
+func (s *UserService) getForUpdate(ctx context.Context, id string, expectedVersion *int64) (*models.User, error) {
 	user, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	// Verificar si el nuevo email ya existe (si se está actualizando)
-	if req.Email != "" && req.Email != user.Email {
-		exists, err := s.userRepo.ExistsByEmail(ctx, req.Email)
+	if expectedVersion != nil && user.Version != *expectedVersion {
+		return nil, models.ErrPreconditionFailed
+	}
+	return user, nil
+}
+
+// saveReplacement aplica los nuevos valores al usuario y los guarda con control de concurrencia
+func (s *UserService) saveReplacement(ctx context.Context, id string, user *models.User, req models.ReplaceUserRequest, expectedVersion *int64) (*models.User, error) {
+	req.Email = models.NormalizeEmail(req.Email)
+	canonicalEmail := s.CanonicalEmail(req.Email)
+
+	// Verificar si el nuevo email ya existe
+	if canonicalEmail != s.CanonicalEmail(user.Email) {
+		exists, err := s.userRepo.ExistsByEmail(ctx, canonicalEmail)
 		if err != nil {
 			return nil, err
 		}
 		if exists {
-			return nil, errors.New("email already exists")
+			return nil, models.ErrEmailTaken
 		}
 	}
 
-	// Actualizar campos del usuario
-	user.Update(req)
+	// Reemplazar campos del usuario, conservando la versión anterior para la auditoría
+	before := *user
+	user.Replace(req)
+	user.EmailCanonical = canonicalEmail
 
 	// Guardar cambios en la base de datos
-	err = s.userRepo.Update(ctx, id, user)
+	err := s.userRepo.Update(ctx, id, user)
 	if err != nil {
+		// Con If-Match el cliente pidió modificar esa versión concreta, que ya no es la actual
+		if expectedVersion != nil && errors.Is(err, models.ErrVersionConflict) {
+			return nil, models.ErrPreconditionFailed
+		}
 		return nil, err
 	}
 
+	s.audit.Record(ctx, models.AuditUserUpdated, &before, user)
 	return user, nil
 }
 
 // DeleteUser elimina un usuario
 func (s *UserService) DeleteUser(ctx context.Context, id string) error {
 	// Verificar que el usuario existe
-	_, err := s.userRepo.GetByID(ctx, id)
+	user, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	// Eliminar usuario
-	return s.userRepo.Delete(ctx, id)
+	// Mover a la papelera; se elimina definitivamente al purgar
+	deletedBy := reqctx.Actor(ctx)
+	if err := s.userRepo.Delete(ctx, id, deletedBy); err != nil {
+		return err
+	}
+
+	deleted := *user
+	deletedAt := time.Now()
+	deleted.DeletedAt = &deletedAt
+	deleted.DeletedBy = deletedBy
+	s.audit.Record(ctx, models.AuditUserDeleted, user, &deleted)
+	return nil
 }
 
-// GetUserByEmail obtiene un usuario por su email
+// RestoreUser saca un usuario de la papelera
+func (s *UserService) RestoreUser(ctx context.Context, id string) (*models.User, error) {
+	user, err := s.userRepo.GetDeletedByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mientras estaba en la papelera otro usuario pudo registrarse con el mismo email
+	exists, err := s.userRepo.ExistsByEmail(ctx, s.CanonicalEmail(user.Email))
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, models.ErrEmailTaken
+	}
+
+	restored, err := s.userRepo.Restore(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, models.AuditUserRestored, user, restored)
+	return restored, nil
+}
+
+// PurgeDeletedUsers elimina definitivamente los usuarios que llevan en la papelera más que retention
+func (s *UserService) PurgeDeletedUsers(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.userRepo.Purge(ctx, time.Now().Add(-retention))
+}
+
+// GetUserByEmail obtiene un usuario por su email, comparando la forma canónica
 func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	user, err := s.userRepo.GetByEmail(ctx, email)
+	user, err := s.userRepo.GetByEmail(ctx, s.CanonicalEmail(email))
 	if err != nil {
 		return nil, err
 	}
@@ -138,18 +414,42 @@ func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*models
 	return user, nil
 }
 
+// Authenticate verifica el email y la contraseña de un usuario
+func (s *UserService) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	user, err := s.userRepo.GetByEmail(ctx, s.CanonicalEmail(email))
+	if err != nil {
+		if !errors.Is(err, models.ErrNotFound) {
+			return nil, err
+		}
+		(&models.User{PasswordHash: dummyPasswordHash}).CheckPassword(password)
+		return nil, models.ErrInvalidCredentials
+	}
+
+	if !user.CheckPassword(password) {
+		return nil, models.ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
 // ValidateUserData valida los datos del usuario
 func (s *UserService) ValidateUserData(req models.CreateUserRequest) error {
+	var fields []models.FieldError
+
 	if req.Name == "" {
-		return errors.New("name is required")
+		fields = append(fields, models.FieldError{Field: "name", Message: "is required"})
 	}
 
 	if req.Email == "" {
-		return errors.New("email is required")
+		fields = append(fields, models.FieldError{Field: "email", Message: "is required"})
 	}
 
 	if req.Age < 1 || req.Age > 120 {
-		return errors.New("age must be between 1 and 120")
+		fields = append(fields, models.FieldError{Field: "age", Message: "must be between 1 and 120"})
+	}
+
+	if len(fields) > 0 {
+		return models.NewValidationError(fields...)
 	}
 
 	return nil
@@ -159,9 +459,20 @@ func (s *UserService) ValidateUserData(req models.CreateUserRequest) error {
 type UserServiceInterface interface {
 	CreateUser(ctx context.Context, req models.CreateUserRequest) (*models.User, error)
 	GetUserByID(ctx context.Context, id string) (*models.User, error)
-	GetUsers(ctx context.Context, pageStr, limitStr string) (*models.UsersResponse, error)
-	UpdateUser(ctx context.Context, id string, req models.UpdateUserRequest) (*models.User, error)
+	GetUserByUUID(ctx context.Context, uuid string) (*models.User, error)
+	GetUsers(ctx context.Context, query models.UserListQuery) (*models.UsersResponse, error)
+	ReplaceUser(ctx context.Context, id string, req models.ReplaceUserRequest, expectedVersion *int64) (*models.User, error)
+	PatchUser(ctx context.Context, id string, patch models.UserPatch, expectedVersion *int64, allowRoles bool, validate RequestValidator) (*models.User, error)
 	DeleteUser(ctx context.Context, id string) error
+	GetDeletedUsers(ctx context.Context, query models.UserListQuery) (*models.UsersResponse, error)
+	PrepareUserExport(ctx context.Context, query models.UserExportQuery) (*models.UserExport, error)
+	ExportUsers(ctx context.Context, export *models.UserExport, w io.Writer) error
+	RestoreUser(ctx context.Context, id string) (*models.User, error)
+	PurgeDeletedUsers(ctx context.Context, retention time.Duration) (int64, error)
+	BulkCreateUsers(ctx context.Context, req models.BulkCreateRequest, validate RequestValidator) (*models.BulkResponse, error)
+	BulkUpdateUsers(ctx context.Context, req models.BulkUpdateRequest, allowRoles bool, validate RequestValidator) (*models.BulkResponse, error)
+	BulkDeleteUsers(ctx context.Context, req models.BulkDeleteRequest) (*models.BulkResponse, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	Authenticate(ctx context.Context, email, password string) (*models.User, error)
 	ValidateUserData(req models.CreateUserRequest) error
 }
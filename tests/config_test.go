@@ -0,0 +1,29 @@
+package tests
+
+import (
+	"testing"
+
+	"go-users-api/config"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		wantErr bool
+	}{
+		{name: "Debug mode without secrets", cfg: config.Config{GinMode: "debug"}},
+		{name: "Release mode with secrets", cfg: config.Config{GinMode: "release", CursorSecret: "secret", IdempotencySecret: "secret"}},
+		{name: "Release mode without cursor secret", cfg: config.Config{GinMode: "release", IdempotencySecret: "secret"}, wantErr: true},
+		{name: "Release mode without idempotency secret", cfg: config.Config{GinMode: "release", CursorSecret: "secret"}, wantErr: true},
+		{name: "Test mode without secrets", cfg: config.Config{GinMode: "test"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
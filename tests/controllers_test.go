@@ -4,14 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"go-users-api/controllers"
 	"go-users-api/models"
+	"go-users-api/services"
 )
 
 func TestCreateUser(t *testing.T) {
@@ -97,7 +100,9 @@ func TestGetUsers(t *testing.T) {
 	var response models.UsersResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(2), response.Total)
+	if assert.NotNil(t, response.Total) {
+		assert.Equal(t, int64(2), *response.Total)
+	}
 	assert.Len(t, response.Users, 2)
 }
 
@@ -206,3 +211,272 @@ func TestDeleteUser(t *testing.T) {
 
 	assert.Equal(t, http.StatusInternalServerError, w2.Code)
 }
+
+func TestLogin(t *testing.T) {
+	mockService := NewMockUserService()
+	tokenService := newTestTokenService()
+	controller := controllers.NewAuthController(services.NewAuthService(mockService, tokenService, NewMockRefreshTokenRepository()))
+	router := setupTestRouter()
+
+	router.POST("/auth/login", controller.Login)
+
+	// Crear un usuario con contraseña en el mock
+	req := models.CreateUserRequest{Name: "John Doe", Email: "john@example.com", Age: 30, Password: "S3cure-passw0rd"}
+	user, _ := mockService.CreateUser(context.Background(), req)
+
+	tests := []struct {
+		name           string
+		body           interface{}
+		expectedStatus int
+	}{
+		{
+			name:           "Valid credentials",
+			body:           models.LoginRequest{Email: "john@example.com", Password: "S3cure-passw0rd"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Wrong password",
+			body:           models.LoginRequest{Email: "john@example.com", Password: "wrong-password"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Unknown email",
+			body:           models.LoginRequest{Email: "nobody@example.com", Password: "S3cure-passw0rd"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Missing password",
+			body:           map[string]string{"email": "john@example.com"},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonBody, _ := json.Marshal(tt.body)
+			httpReq, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(jsonBody))
+			httpReq.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httpReq)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				var response models.TokenResponse
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.NoError(t, err)
+				assert.Equal(t, "Bearer", response.TokenType)
+				assert.Equal(t, int64(900), response.ExpiresIn)
+
+				claims, err := tokenService.ParseAccessToken(response.AccessToken)
+				assert.NoError(t, err)
+				assert.Equal(t, user.ID.Hex(), claims.Subject)
+
+				// El token de refresco no debe servir como token de acceso
+				_, err = tokenService.ParseAccessToken(response.RefreshToken)
+				assert.Error(t, err)
+				_, err = tokenService.ParseRefreshToken(response.RefreshToken)
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestUserConditionalRequests(t *testing.T) {
+	mockService := NewMockUserService()
+	controller := controllers.NewUserController(mockService)
+	router := setupTestRouter()
+
+	router.GET("/users/:id", controller.GetUserByID)
+	router.PUT("/users/:id", controller.UpdateUser)
+
+	user, _ := mockService.CreateUser(context.Background(), models.CreateUserRequest{Name: "John Doe", Email: "john@example.com", Age: 30})
+
+	send := func(method, headerName, headerValue string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/users/"+user.UUID, bytes.NewBufferString(`{"name": "John Updated", "email": "john@example.com", "age": 30}`))
+		req.Header.Set("Content-Type", "application/json")
+		if headerName != "" {
+			req.Header.Set(headerName, headerValue)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// GET retorna la versión actual en el ETag
+	w := send("GET", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+	// El cuerpo depende de los permisos del token (enmascarado de datos personales)
+	assert.Equal(t, "Authorization", w.Header().Get("Vary"))
+
+	// If-None-Match con la versión actual evita reenviar el cuerpo
+	w = send("GET", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, "Authorization", w.Header().Get("Vary"))
+
+	w = send("GET", "If-None-Match", `W/"1", "7"`)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// If-Match con la versión actual actualiza y retorna el nuevo ETag
+	w = send("PUT", "If-Match", etag)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	// Reutilizar el ETag anterior falla: otro cliente ya modificó el usuario
+	w = send("PUT", "If-Match", etag)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// Las etiquetas débiles no sirven para If-Match
+	w = send("PUT", "If-Match", `W/"2"`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// La versión anterior ya no coincide con If-None-Match
+	w = send("GET", "If-None-Match", etag)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestPatchUser(t *testing.T) {
+	mockService := NewMockUserService()
+	controller := controllers.NewUserController(mockService)
+	router := setupTestRouter()
+
+	router.PATCH("/users/:id", controller.PatchUser)
+
+	user, _ := mockService.CreateUser(context.Background(), models.CreateUserRequest{
+		Name: "John Doe", Email: "john@example.com", Age: 30, Phone: "+1234567890", Address: "123 Main St",
+	})
+
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		expectedStatus int
+		check          func(t *testing.T)
+	}{
+		{
+			name:           "Merge patch clears phone and sets age",
+			contentType:    models.MIMEMergePatch,
+			body:           `{"phone": null, "age": 31}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T) {
+				assert.Equal(t, "", user.Phone)
+				assert.Equal(t, 31, user.Age)
+				assert.Equal(t, "123 Main St", user.Address)
+			},
+		},
+		{
+			name:           "JSON patch with passing test operation",
+			contentType:    models.MIMEJSONPatch,
+			body:           `[{"op": "test", "path": "/age", "value": 31}, {"op": "remove", "path": "/address"}]`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T) {
+				assert.Equal(t, "", user.Address)
+			},
+		},
+		{
+			name:           "JSON patch with failing test operation",
+			contentType:    models.MIMEJSONPatch,
+			body:           `[{"op": "test", "path": "/name", "value": "Someone Else"}, {"op": "replace", "path": "/name", "value": "Hijacked"}]`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Result violates validation rules",
+			contentType:    models.MIMEMergePatch,
+			body:           `{"email": "not-an-email", "age": null}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Malformed JSON patch",
+			contentType:    models.MIMEJSONPatch,
+			body:           `{"op": "replace"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unsupported content type",
+			contentType:    "application/json",
+			body:           `{"age": 40}`,
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("PATCH", "/users/"+user.UUID, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.check != nil {
+				tt.check(t)
+			}
+		})
+	}
+}
+
+func TestHealthProbes(t *testing.T) {
+	var mongoErr error
+	healthService := services.NewHealthService(20*time.Millisecond,
+		services.HealthCheck{Name: "mongodb", Check: func(ctx context.Context) error { return mongoErr }},
+		services.HealthCheck{Name: "slow", Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	)
+	controller := controllers.NewHealthController(healthService)
+	router := setupTestRouter()
+	router.GET("/livez", controller.Livez)
+	router.GET("/readyz", controller.Readyz)
+	router.GET("/startupz", controller.Startupz)
+
+	probe := func(path string) (int, models.HealthReport) {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var report models.HealthReport
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return w.Code, report
+	}
+
+	// Mientras arranca, el proceso está vivo pero no listo
+	code, _ := probe("/livez")
+	assert.Equal(t, http.StatusOK, code)
+	code, report := probe("/startupz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, models.HealthStarting, report.Status)
+	code, report = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, models.HealthStarting, report.Status)
+
+	// Tras el arranque, una dependencia que no responde a tiempo impide estar listo
+	healthService.MarkStarted()
+	code, _ = probe("/startupz")
+	assert.Equal(t, http.StatusOK, code)
+	code, report = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, models.HealthDown, report.Status)
+	assert.Equal(t, models.HealthUp, report.Checks["mongodb"].Status)
+	assert.Equal(t, models.HealthDown, report.Checks["slow"].Status)
+	assert.Equal(t, "timeout", report.Checks["slow"].Error)
+	assert.GreaterOrEqual(t, report.Checks["slow"].LatencyMs, float64(20))
+
+	// El detalle del error no se expone en la respuesta
+	mongoErr = errors.New("server selection error: mongo-0.internal:27017")
+	_, report = probe("/readyz")
+	assert.Equal(t, "unavailable", report.Checks["mongodb"].Error)
+
+	// Desde que comienza el apagado deja de estar listo sin comprobar las dependencias
+	healthService.MarkShuttingDown()
+	code, report = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, models.HealthShuttingDown, report.Status)
+	assert.Empty(t, report.Checks)
+	code, _ = probe("/livez")
+	assert.Equal(t, http.StatusOK, code)
+}
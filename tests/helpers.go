@@ -2,17 +2,113 @@ package tests
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 
+	"go-users-api/config"
+	"go-users-api/controllers"
+	"go-users-api/metrics"
+	"go-users-api/middleware"
 	"go-users-api/models"
 	"go-users-api/repository"
+	"go-users-api/reqctx"
+	"go-users-api/routes"
 	"go-users-api/services"
 )
 
+// testJWTSecret es el secreto HS256 usado por los tests
+const testJWTSecret = "test-secret-with-enough-entropy-for-hs256"
+
+// testMetricsToken protege /metrics en las rutas de prueba
+const testMetricsToken = "test-metrics-token"
+
+// newTestConfig crea una configuración de prueba con autenticación HS256
+func newTestConfig() *config.Config {
+	return &config.Config{
+		JWTAlgorithm:       "HS256",
+		JWTSecret:          testJWTSecret,
+		JWTIssuer:          "go-users-api-test",
+		JWTAudience:        "go-users-api-test",
+		AccessTokenTTL:     15 * time.Minute,
+		RefreshTokenTTL:    24 * time.Hour,
+		CursorSecret:       "test-cursor-secret",
+		MaxPageLimit:       100,
+		BulkMaxItems:       50,
+		ImportMaxBytes:     1 << 20,
+		ImportSyncMaxBytes: 4 << 10,
+		ImportRetention:    time.Hour,
+		IdempotencyTTL:     time.Hour,
+		IdempotencySecret:  "test-idempotency-secret",
+	}
+}
+
+// newTestTokenService crea un servicio de tokens con la configuración de prueba
+func newTestTokenService() *services.TokenService {
+	tokenService, err := services.NewTokenService(newTestConfig())
+	if err != nil {
+		panic(err)
+	}
+	return tokenService
+}
+
+// newTestAccessToken emite un token de acceso válido para un usuario de prueba con los roles dados
+func newTestAccessToken(roles ...models.Role) string {
+	user := createTestUser()
+	user.ID = primitive.NewObjectID()
+	user.Roles = roles
+
+	return newTestAccessTokenFor(user)
+}
+
+// newTestAccessTokenFor emite un token de acceso válido para el usuario dado
+func newTestAccessTokenFor(user *models.User) string {
+	token, err := newTestTokenService().GenerateAccessToken(user)
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
+// setupTestRoutes crea un router de prueba con todas las rutas de la aplicación
+func setupTestRoutes(userService services.UserServiceInterface) *gin.Engine {
+	router := setupTestRouter()
+	routes.SetupRoutes(router, newTestDependencies(userService))
+	return router
+}
+
+// newTestDependencies crea las dependencias de las rutas con repositorios simulados
+func newTestDependencies(userService services.UserServiceInterface) routes.Dependencies {
+	tokenService := newTestTokenService()
+	healthService := services.NewHealthService(time.Second)
+	healthService.MarkStarted()
+	return routes.Dependencies{
+		UserController:   controllers.NewUserController(userService),
+		AuthController:   controllers.NewAuthController(services.NewAuthService(userService, tokenService, NewMockRefreshTokenRepository())),
+		AuditController:  controllers.NewAuditController(newTestAuditService(NewMockAuditRepository())),
+		ImportController: controllers.NewImportController(services.NewImportService(NewMockImportRepository(), userService, newTestConfig())),
+		HealthController: controllers.NewHealthController(healthService),
+		TokenService:     tokenService,
+		MetricsHandler:   metrics.Handler(testMetricsToken),
+	}
+}
+
+// validateTestRequest valida una petición con sus tags binding, igual que los controladores
+func validateTestRequest(req any) error {
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		return middleware.BindingError(err)
+	}
+	return nil
+}
+
 // setupTestRouter crea un router de prueba configurado
 func setupTestRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
@@ -46,8 +142,8 @@ func createTestUserRequest() models.CreateUserRequest {
 }
 
 // createTestUpdateRequest crea una request de actualización de prueba
-func createTestUpdateRequest() models.UpdateUserRequest {
-	return models.UpdateUserRequest{
+func createTestUpdateRequest() models.ReplaceUserRequest {
+	return models.ReplaceUserRequest{
 		Name:    "Updated Test User",
 		Email:   "updated@example.com",
 		Age:     26,
@@ -58,138 +154,774 @@ func createTestUpdateRequest() models.UpdateUserRequest {
 
 // MockUserRepository implementa la interfaz UserRepositoryInterface para testing
 type MockUserRepository struct {
-	users  map[string]*models.User
-	emails map[string]bool
+	users map[string]*models.User
 }
 
 func NewMockUserRepository() repository.UserRepositoryInterface {
 	return &MockUserRepository{
-		users:  make(map[string]*models.User),
-		emails: make(map[string]bool),
+		users: make(map[string]*models.User),
 	}
 }
 
 func (m *MockUserRepository) Create(ctx context.Context, user *models.User) error {
+	// Simula el índice único de email
+	if m.emailTaken(mockCanonicalEmail(user), user.UUID) {
+		return models.ErrEmailTaken
+	}
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
 	m.users[user.UUID] = user
-	m.emails[user.Email] = true
 	return nil
 }
 
-func (m *MockUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+// emailTaken indica si otro usuario activo distinto de uuid usa el email canónico
+func (m *MockUserRepository) emailTaken(canonicalEmail, uuid string) bool {
 	for _, user := range m.users {
-		if user.UUID == id {
-			return user, nil
+		if user.UUID != uuid && user.DeletedAt == nil && mockCanonicalEmail(user) == canonicalEmail {
+			return true
 		}
 	}
-	return nil, errors.New("user not found")
+	return false
+}
+
+// mockCanonicalEmail retorna el email canónico del usuario; los usuarios creados directamente
+// en el repositorio (sin pasar por el servicio) no lo tienen
+func mockCanonicalEmail(user *models.User) string {
+	if user.EmailCanonical != "" {
+		return user.EmailCanonical
+	}
+	return models.CanonicalEmail(user.Email, false)
 }
 
-func (m *MockUserRepository) GetAll(ctx context.Context, page, limit int64) ([]models.User, int64, error) {
+// lookup busca un usuario por su ObjectID o por su UUID, igual que el repositorio real
+func (m *MockUserRepository) lookup(id string) (*models.User, bool) {
+	if user, exists := m.users[id]; exists {
+		return user, true
+	}
+	for _, user := range m.users {
+		if user.ID.Hex() == id {
+			return user, true
+		}
+	}
+	return nil, false
+}
+
+func (m *MockUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	if user, exists := m.lookup(id); exists && user.DeletedAt == nil {
+		// Retornar una copia, igual que al leer de MongoDB
+		found := *user
+		return &found, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+func (m *MockUserRepository) GetAll(ctx context.Context, filter models.UserFilter, page, limit int64) ([]models.User, error) {
+	return m.filter(filter), nil
+}
+
+func (m *MockUserRepository) GetPage(ctx context.Context, filter models.UserFilter, cursor *models.UserCursor, limit int64) ([]models.User, error) {
+	users := m.filter(filter)
+
+	// Orden (created_at, _id) descendente, o ascendente si el cursor va hacia atrás
+	backward := cursor != nil && cursor.Backward
+	sort.Slice(users, func(i, j int) bool {
+		return userBefore(users[i], users[j]) != backward
+	})
+
+	var page []models.User
+	for _, user := range users {
+		if cursor != nil {
+			position := models.User{CreatedAt: cursor.CreatedAt, ID: cursor.ID}
+			if userBefore(user, position) != backward || user.ID == cursor.ID {
+				continue
+			}
+		}
+		if int64(len(page)) == limit {
+			break
+		}
+		page = append(page, user)
+	}
+	return page, nil
+}
+
+func (m *MockUserRepository) Count(ctx context.Context, filter models.UserFilter) (int64, error) {
+	return int64(len(m.filter(filter))), nil
+}
+
+func (m *MockUserRepository) Each(ctx context.Context, filter models.UserFilter, fn func(user *models.User) error) error {
+	users := m.filter(filter)
+	sort.Slice(users, func(i, j int) bool {
+		return userBefore(users[i], users[j])
+	})
+	for i := range users {
+		if err := fn(&users[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filter aplica los filtros de nombre, email y edad sobre los usuarios en memoria
+func (m *MockUserRepository) filter(filter models.UserFilter) []models.User {
 	var users []models.User
 	for _, user := range m.users {
+		if (user.DeletedAt != nil) != filter.Deleted {
+			continue
+		}
+		if filter.Name != "" && !strings.HasPrefix(models.LowerName(user.Name), models.LowerName(filter.Name)) {
+			continue
+		}
+		if filter.Email != "" && !strings.HasPrefix(user.EmailCanonical, strings.ToLower(filter.Email)) {
+			continue
+		}
+		if filter.MinAge != nil && user.Age < *filter.MinAge {
+			continue
+		}
+		if filter.MaxAge != nil && user.Age > *filter.MaxAge {
+			continue
+		}
 		users = append(users, *user)
 	}
-	return users, int64(len(users)), nil
+	return users
+}
+
+// userBefore indica si a va antes que b en el orden (created_at, _id) descendente
+func userBefore(a, b models.User) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID.Hex() > b.ID.Hex()
 }
 
 func (m *MockUserRepository) Update(ctx context.Context, id string, user *models.User) error {
-	for uuid := range m.users {
-		if uuid == id {
-			m.users[uuid] = user
-			return nil
+	if stored, exists := m.lookup(id); exists && stored.DeletedAt == nil {
+		if stored.Version != user.Version {
+			return models.ErrVersionConflict
 		}
+		if m.emailTaken(mockCanonicalEmail(user), stored.UUID) {
+			return models.ErrEmailTaken
+		}
+		user.Version++
+		updated := *user
+		m.users[stored.UUID] = &updated
+		return nil
+	}
+	return models.ErrNotFound
+}
+
+func (m *MockUserRepository) Delete(ctx context.Context, id string, deletedBy string) error {
+	if user, exists := m.lookup(id); exists && user.DeletedAt == nil {
+		now := time.Now()
+		user.DeletedAt = &now
+		user.DeletedBy = deletedBy
+		user.Version++
+		return nil
+	}
+	return models.ErrNotFound
+}
+
+func (m *MockUserRepository) GetDeletedByID(ctx context.Context, id string) (*models.User, error) {
+	if user, exists := m.lookup(id); exists && user.DeletedAt != nil {
+		found := *user
+		return &found, nil
 	}
-	return errors.New("user not found")
+	return nil, models.ErrNotFound
 }
 
-func (m *MockUserRepository) Delete(ctx context.Context, id string) error {
-	for uuid := range m.users {
-		if uuid == id {
+func (m *MockUserRepository) Restore(ctx context.Context, id string) (*models.User, error) {
+	if user, exists := m.lookup(id); exists && user.DeletedAt != nil {
+		if m.emailTaken(mockCanonicalEmail(user), user.UUID) {
+			return nil, models.ErrEmailTaken
+		}
+		user.DeletedAt = nil
+		user.DeletedBy = ""
+		user.Version++
+		restored := *user
+		return &restored, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+func (m *MockUserRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+	for uuid, user := range m.users {
+		if user.DeletedAt != nil && !user.DeletedAt.After(deletedBefore) {
 			delete(m.users, uuid)
-			return nil
+			purged++
 		}
 	}
-	return errors.New("user not found")
+	return purged, nil
 }
 
-func (m *MockUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+func (m *MockUserRepository) GetByEmail(ctx context.Context, canonicalEmail string) (*models.User, error) {
 	for _, user := range m.users {
-		if user.Email == email {
+		if mockCanonicalEmail(user) == canonicalEmail && user.DeletedAt == nil {
 			return user, nil
 		}
 	}
-	return nil, errors.New("user not found")
+	return nil, models.ErrNotFound
 }
 
-func (m *MockUserRepository) ExistsByEmail(ctx context.Context, email string) (bool, error) {
-	return m.emails[email], nil
+func (m *MockUserRepository) ExistsByEmail(ctx context.Context, canonicalEmail string) (bool, error) {
+	_, err := m.GetByEmail(ctx, canonicalEmail)
+	return err == nil, nil
+}
+
+func (m *MockUserRepository) FindTakenEmails(ctx context.Context, canonicalEmails []string) ([]string, error) {
+	var taken []string
+	for _, email := range canonicalEmails {
+		if m.emailTaken(email, "") {
+			taken = append(taken, email)
+		}
+	}
+	return taken, nil
 }
 
 func (m *MockUserRepository) GetByUUID(ctx context.Context, uuid string) (*models.User, error) {
-	if user, exists := m.users[uuid]; exists {
-		return user, nil
+	if user, exists := m.users[uuid]; exists && user.DeletedAt == nil {
+		found := *user
+		return &found, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+func (m *MockUserRepository) GetByIDs(ctx context.Context, ids []string) ([]models.User, error) {
+	var users []models.User
+	for _, id := range ids {
+		if user, exists := m.lookup(id); exists && user.DeletedAt == nil {
+			users = append(users, *user)
+		}
+	}
+	return users, nil
+}
+
+func (m *MockUserRepository) BulkCreate(ctx context.Context, users []*models.User, atomic bool) ([]error, error) {
+	return m.bulk(users, atomic, func(user *models.User) error {
+		return m.Create(ctx, user)
+	}), nil
+}
+
+func (m *MockUserRepository) BulkUpdate(ctx context.Context, users []*models.User, atomic bool) ([]error, error) {
+	return m.bulk(users, atomic, func(user *models.User) error {
+		return m.Update(ctx, user.UUID, user)
+	}), nil
+}
+
+func (m *MockUserRepository) BulkDelete(ctx context.Context, users []*models.User, deletedBy string, atomic bool) ([]error, error) {
+	return m.bulk(users, atomic, func(user *models.User) error {
+		stored, exists := m.lookup(user.UUID)
+		if !exists || stored.DeletedAt != nil {
+			return models.ErrNotFound
+		}
+		if stored.Version != user.Version {
+			return models.ErrVersionConflict
+		}
+		if err := m.Delete(ctx, user.UUID, deletedBy); err != nil {
+			return err
+		}
+		*user = *stored
+		return nil
+	}), nil
+}
+
+// bulk aplica write a cada usuario; con atomic restaura el estado anterior si alguno falla,
+// como la transacción del repositorio real
+func (m *MockUserRepository) bulk(users []*models.User, atomic bool, write func(user *models.User) error) []error {
+	snapshot := make(map[string]models.User, len(m.users))
+	for uuid, user := range m.users {
+		snapshot[uuid] = *user
+	}
+
+	itemErrs := make([]error, len(users))
+	for i, user := range users {
+		if itemErrs[i] = write(user); itemErrs[i] != nil && atomic {
+			m.users = make(map[string]*models.User, len(snapshot))
+			for uuid, user := range snapshot {
+				restored := user
+				m.users[uuid] = &restored
+			}
+			break
+		}
+	}
+	return itemErrs
+}
+
+// MockIdempotencyRepository implementa la interfaz IdempotencyRepositoryInterface para testing
+type MockIdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]*models.IdempotencyRecord
+}
+
+func NewMockIdempotencyRepository() *MockIdempotencyRepository {
+	return &MockIdempotencyRepository{
+		records: make(map[string]*models.IdempotencyRecord),
+	}
+}
+
+func (m *MockIdempotencyRepository) Acquire(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, exists := m.records[record.ID]; exists && existing.ExpiresAt.After(record.CreatedAt) &&
+		(existing.Status == models.IdempotencyCompleted || existing.LockedUntil.After(record.CreatedAt)) {
+		copied := *existing
+		return &copied, nil
+	}
+	copied := *record
+	m.records[record.ID] = &copied
+	return nil, nil
+}
+
+func (m *MockIdempotencyRepository) Complete(ctx context.Context, record *models.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, exists := m.records[record.ID]; exists && existing.Fingerprint == record.Fingerprint && existing.Status == models.IdempotencyInProgress {
+		existing.Status = record.Status
+		existing.ResponseStatus = record.ResponseStatus
+		existing.ResponseHeaders = record.ResponseHeaders
+		existing.ResponseBody = record.ResponseBody
+		existing.ExpiresAt = record.ExpiresAt
 	}
-	return nil, errors.New("user not found")
+	return nil
+}
+
+func (m *MockIdempotencyRepository) Release(ctx context.Context, id string, fingerprint string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, exists := m.records[id]; exists && existing.Fingerprint == fingerprint && existing.Status == models.IdempotencyInProgress {
+		delete(m.records, id)
+	}
+	return nil
+}
+
+func (m *MockIdempotencyRepository) DeleteCompleted(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, exists := m.records[id]; exists && existing.Status == models.IdempotencyCompleted {
+		delete(m.records, id)
+	}
+	return nil
+}
+
+// MockRefreshTokenRepository implementa la interfaz RefreshTokenRepositoryInterface para testing
+type MockRefreshTokenRepository struct {
+	tokens map[string]*models.RefreshToken
+}
+
+func NewMockRefreshTokenRepository() *MockRefreshTokenRepository {
+	return &MockRefreshTokenRepository{
+		tokens: make(map[string]*models.RefreshToken),
+	}
+}
+
+func (m *MockRefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	m.tokens[token.TokenID] = token
+	return nil
+}
+
+func (m *MockRefreshTokenRepository) GetByTokenID(ctx context.Context, tokenID string) (*models.RefreshToken, error) {
+	if token, exists := m.tokens[tokenID]; exists {
+		copied := *token
+		return &copied, nil
+	}
+	return nil, repository.ErrRefreshTokenNotFound
+}
+
+func (m *MockRefreshTokenRepository) MarkRotated(ctx context.Context, tokenID string) (bool, error) {
+	token, exists := m.tokens[tokenID]
+	if !exists || token.RotatedAt != nil || token.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.RotatedAt = &now
+	return true, nil
+}
+
+func (m *MockRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *MockRefreshTokenRepository) RevokeAllForUser(ctx context.Context, userID string) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+// MockAuditRepository implementa la interfaz AuditRepositoryInterface para testing
+type MockAuditRepository struct {
+	events []models.AuditEvent
+}
+
+func NewMockAuditRepository() *MockAuditRepository {
+	return &MockAuditRepository{}
+}
+
+func (m *MockAuditRepository) Create(ctx context.Context, event *models.AuditEvent) error {
+	// Como el driver de MongoDB, no escribe con un contexto cancelado
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	event.ID = primitive.NewObjectID()
+	m.events = append(m.events, *event)
+	return nil
+}
+
+func (m *MockAuditRepository) Find(ctx context.Context, filter models.AuditFilter, page, limit int64) ([]models.AuditEvent, error) {
+	events := m.filter(filter)
+	start := (page - 1) * limit
+	if start >= int64(len(events)) {
+		return []models.AuditEvent{}, nil
+	}
+	end := start + limit
+	if end > int64(len(events)) {
+		end = int64(len(events))
+	}
+	return events[start:end], nil
+}
+
+func (m *MockAuditRepository) Count(ctx context.Context, filter models.AuditFilter) (int64, error) {
+	return int64(len(m.filter(filter))), nil
+}
+
+// filter retorna los eventos que cumplen el filtro, del más reciente al más antiguo
+func (m *MockAuditRepository) filter(filter models.AuditFilter) []models.AuditEvent {
+	events := []models.AuditEvent{}
+	for i := len(m.events) - 1; i >= 0; i-- {
+		event := m.events[i]
+		if (filter.UserID != "" && event.UserID != filter.UserID && event.UserUUID != filter.UserID) ||
+			(filter.ActorID != "" && event.ActorID != filter.ActorID) ||
+			(filter.Action != "" && event.Action != filter.Action) ||
+			(filter.From != nil && event.Timestamp.Before(*filter.From)) ||
+			(filter.To != nil && event.Timestamp.After(*filter.To)) {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// newTestAuditService crea un servicio de auditoría sobre el repositorio dado
+func newTestAuditService(auditRepo repository.AuditRepositoryInterface) *services.AuditService {
+	return services.NewAuditService(auditRepo, newTestConfig())
+}
+
+// MockImportRepository implementa la interfaz ImportRepositoryInterface para testing.
+// Es seguro para uso concurrente porque los jobs se ejecutan en otra goroutine.
+type MockImportRepository struct {
+	mu         sync.Mutex
+	jobs       map[primitive.ObjectID]models.ImportJob
+	rejections []models.ImportRejection
+}
+
+func NewMockImportRepository() *MockImportRepository {
+	return &MockImportRepository{jobs: make(map[primitive.ObjectID]models.ImportJob)}
+}
+
+func (m *MockImportRepository) CreateJob(ctx context.Context, job *models.ImportJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.ID = primitive.NewObjectID()
+	job.CreatedAt = time.Now()
+	m.jobs[job.ID] = *job
+	return nil
+}
+
+func (m *MockImportRepository) UpdateJob(ctx context.Context, job *models.ImportJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.jobs[job.ID]; !exists {
+		return models.ErrImportNotFound
+	}
+	job.UpdatedAt = time.Now()
+	m.jobs[job.ID] = *job
+	return nil
+}
+
+func (m *MockImportRepository) GetJob(ctx context.Context, id string) (*models.ImportJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, models.ErrImportNotFound
+	}
+	job, exists := m.jobs[objectID]
+	if !exists {
+		return nil, models.ErrImportNotFound
+	}
+	return &job, nil
+}
+
+func (m *MockImportRepository) AddRejections(ctx context.Context, job *models.ImportJob, rejections []models.ImportRejection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rejection := range rejections {
+		rejection.JobID = job.ID
+		m.rejections = append(m.rejections, rejection)
+	}
+	return nil
+}
+
+func (m *MockImportRepository) EachRejection(ctx context.Context, jobID primitive.ObjectID, fn func(rejection models.ImportRejection) error) error {
+	m.mu.Lock()
+	var rejections []models.ImportRejection
+	for _, rejection := range m.rejections {
+		if rejection.JobID == jobID {
+			rejections = append(rejections, rejection)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, rejection := range rejections {
+		if err := fn(rejection); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // MockUserService implementa la interfaz UserServiceInterface para testing
 type MockUserService struct {
-	users map[string]*models.User
+	users   map[string]*models.User
+	deleted map[string]*models.User // Papelera
 }
 
 func NewMockUserService() services.UserServiceInterface {
 	return &MockUserService{
-		users: make(map[string]*models.User),
+		users:   make(map[string]*models.User),
+		deleted: make(map[string]*models.User),
 	}
 }
 
 func (m *MockUserService) CreateUser(ctx context.Context, req models.CreateUserRequest) (*models.User, error) {
 	user := models.NewUser(req)
+	user.ID = primitive.NewObjectID()
+	if req.Password != "" {
+		if err := user.SetPassword(req.Password); err != nil {
+			return nil, err
+		}
+	}
 	m.users[user.UUID] = user
 	return user, nil
 }
 
-func (m *MockUserService) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+// find busca un usuario por UUID o por ObjectID
+func (m *MockUserService) find(id string) (*models.User, bool) {
 	if user, exists := m.users[id]; exists {
+		return user, true
+	}
+	for _, user := range m.users {
+		if user.ID.Hex() == id {
+			return user, true
+		}
+	}
+	return nil, false
+}
+
+func (m *MockUserService) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	if user, exists := m.find(id); exists {
 		return user, nil
 	}
 	return nil, assert.AnError
 }
 
-func (m *MockUserService) GetUsers(ctx context.Context, pageStr, limitStr string) (*models.UsersResponse, error) {
+func (m *MockUserService) GetUserByUUID(ctx context.Context, uuid string) (*models.User, error) {
+	if user, exists := m.users[uuid]; exists {
+		return user, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+func (m *MockUserService) GetUsers(ctx context.Context, query models.UserListQuery) (*models.UsersResponse, error) {
 	var users []models.UserResponse
 	for _, user := range m.users {
 		users = append(users, user.ToResponse())
 	}
+	total := int64(len(users))
 	return &models.UsersResponse{
 		Users: users,
-		Total: int64(len(users)),
+		Total: &total,
 	}, nil
 }
 
-func (m *MockUserService) UpdateUser(ctx context.Context, id string, req models.UpdateUserRequest) (*models.User, error) {
-	if user, exists := m.users[id]; exists {
-		user.Update(req)
+func (m *MockUserService) ReplaceUser(ctx context.Context, id string, req models.ReplaceUserRequest, expectedVersion *int64) (*models.User, error) {
+	if user, exists := m.find(id); exists {
+		if expectedVersion != nil && *expectedVersion != user.Version {
+			return nil, models.ErrPreconditionFailed
+		}
+		user.Replace(req)
+		user.Version++
 		return user, nil
 	}
 	return nil, assert.AnError
 }
 
+func (m *MockUserService) PatchUser(ctx context.Context, id string, patch models.UserPatch, expectedVersion *int64, allowRoles bool, validate services.RequestValidator) (*models.User, error) {
+	user, exists := m.find(id)
+	if !exists {
+		return nil, assert.AnError
+	}
+
+	req, err := patch.Apply(user.ToReplaceRequest())
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(&req); err != nil {
+		return nil, err
+	}
+	if !allowRoles && !models.SameRoles(user.GetRoles(), req.Roles) {
+		return nil, models.ErrForbidden
+	}
+	return m.ReplaceUser(ctx, id, req, expectedVersion)
+}
+
 func (m *MockUserService) DeleteUser(ctx context.Context, id string) error {
-	if _, exists := m.users[id]; exists {
-		delete(m.users, id)
+	if user, exists := m.find(id); exists {
+		now := time.Now()
+		user.DeletedAt = &now
+		user.DeletedBy = reqctx.Actor(ctx)
+		m.deleted[user.UUID] = user
+		delete(m.users, user.UUID)
 		return nil
 	}
 	return assert.AnError
 }
 
+func (m *MockUserService) GetDeletedUsers(ctx context.Context, query models.UserListQuery) (*models.UsersResponse, error) {
+	var users []models.UserResponse
+	for _, user := range m.deleted {
+		users = append(users, user.ToResponse())
+	}
+	total := int64(len(users))
+	return &models.UsersResponse{Users: users, Total: &total}, nil
+}
+
+func (m *MockUserService) PrepareUserExport(ctx context.Context, query models.UserExportQuery) (*models.UserExport, error) {
+	columns, err := models.ParseExportColumns(query.Columns)
+	if err != nil {
+		return nil, err
+	}
+	format := models.ExportFormat(query.Format)
+	if format == "" {
+		format = models.ExportCSV
+	}
+	return &models.UserExport{Format: format, Columns: columns}, nil
+}
+
+// ExportUsers escribe cada usuario como una línea JSON, con los datos personales ocultos si corresponde
+func (m *MockUserService) ExportUsers(ctx context.Context, export *models.UserExport, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, user := range m.users {
+		response := user.ToResponse()
+		if export.MaskPII {
+			response = response.MaskPII()
+		}
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MockUserService) RestoreUser(ctx context.Context, id string) (*models.User, error) {
+	for uuid, user := range m.deleted {
+		if uuid == id || user.ID.Hex() == id {
+			user.DeletedAt = nil
+			user.DeletedBy = ""
+			m.users[uuid] = user
+			delete(m.deleted, uuid)
+			return user, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+func (m *MockUserService) PurgeDeletedUsers(ctx context.Context, retention time.Duration) (int64, error) {
+	purged := int64(len(m.deleted))
+	m.deleted = make(map[string]*models.User)
+	return purged, nil
+}
+
+func (m *MockUserService) BulkCreateUsers(ctx context.Context, req models.BulkCreateRequest, validate services.RequestValidator) (*models.BulkResponse, error) {
+	response := &models.BulkResponse{Atomic: req.Atomic, Committed: true}
+	for i, item := range req.Users {
+		user, _ := m.CreateUser(ctx, item)
+		response.Results = append(response.Results, models.BulkItemResult{Index: i, ID: user.ID.Hex(), UUID: user.UUID, Version: user.Version, Status: models.BulkCreated})
+		response.Succeeded++
+	}
+	return response, nil
+}
+
+func (m *MockUserService) BulkUpdateUsers(ctx context.Context, req models.BulkUpdateRequest, allowRoles bool, validate services.RequestValidator) (*models.BulkResponse, error) {
+	response := &models.BulkResponse{Atomic: req.Atomic, Committed: true}
+	for i, item := range req.Users {
+		result := models.BulkItemResult{Index: i, Status: models.BulkUpdated}
+		user, exists := m.find(item.ID)
+		if exists && !allowRoles {
+			patch, _ := models.NewUserPatch(models.MIMEMergePatch, item.Changes)
+			if req, err := patch.Apply(user.ToReplaceRequest()); err == nil && !models.SameRoles(user.GetRoles(), req.Roles) {
+				result.Status = models.BulkForbidden
+				response.Failed++
+				response.Results = append(response.Results, result)
+				continue
+			}
+		}
+		if exists {
+			result.ID, result.UUID, result.Version = user.ID.Hex(), user.UUID, user.Version
+			response.Succeeded++
+		} else {
+			result.Status = models.BulkNotFound
+			response.Failed++
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+func (m *MockUserService) BulkDeleteUsers(ctx context.Context, req models.BulkDeleteRequest) (*models.BulkResponse, error) {
+	response := &models.BulkResponse{Atomic: req.Atomic, Committed: true}
+	for i, id := range req.IDs {
+		result := models.BulkItemResult{Index: i, Status: models.BulkDeleted}
+		if err := m.DeleteUser(ctx, id); err != nil {
+			result.Status = models.BulkNotFound
+			response.Failed++
+		} else {
+			response.Succeeded++
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
 func (m *MockUserService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	for _, user := range m.users {
-		if user.Email == email {
+		if models.CanonicalEmail(user.Email, false) == models.CanonicalEmail(email, false) {
 			return user, nil
 		}
 	}
-	return nil, assert.AnError
+	return nil, models.ErrNotFound
+}
+
+func (m *MockUserService) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	for _, user := range m.users {
+		if user.Email == email && user.CheckPassword(password) {
+			return user, nil
+		}
+	}
+	return nil, models.ErrInvalidCredentials
 }
 
 func (m *MockUserService) ValidateUserData(req models.CreateUserRequest) error {
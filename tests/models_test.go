@@ -1,6 +1,9 @@
 package tests
 
 import (
+	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -183,6 +186,10 @@ func TestUserUpdatePartial(t *testing.T) {
 		t.Errorf("Expected Name %s, got %s", req.Name, user.Name)
 	}
 
+	if user.NameLower != "john updated" {
+		t.Errorf("Expected NameLower %s, got %s", "john updated", user.NameLower)
+	}
+
 	if user.Email != originalEmail {
 		t.Errorf("Expected Email to remain %s, got %s", originalEmail, user.Email)
 	}
@@ -204,3 +211,206 @@ func TestUserUpdatePartial(t *testing.T) {
 		t.Error("Expected UpdatedAt to be updated")
 	}
 }
+
+func TestUserPassword(t *testing.T) {
+	user := &models.User{Name: "John Doe", Email: "john.doe@example.com", Age: 30}
+
+	// Sin contraseña nunca se autentica
+	if user.CheckPassword("") {
+		t.Error("Expected CheckPassword to fail when no password is set")
+	}
+
+	if err := user.SetPassword("S3cure-passw0rd"); err != nil {
+		t.Fatalf("SetPassword() error = %v", err)
+	}
+
+	if !user.CheckPassword("S3cure-passw0rd") {
+		t.Error("Expected CheckPassword to succeed with the right password")
+	}
+
+	if user.CheckPassword("wrong-password") {
+		t.Error("Expected CheckPassword to fail with a wrong password")
+	}
+
+	// El hash no debe aparecer en ninguna representación JSON
+	for _, value := range []interface{}{user, user.ToResponse()} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		if strings.Contains(string(data), user.PasswordHash) || strings.Contains(string(data), "password") {
+			t.Errorf("Expected password hash to be hidden, got %s", data)
+		}
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	tests := []struct {
+		name       string
+		roles      []models.Role
+		permission models.Permission
+		global     bool
+		self       bool
+	}{
+		{name: "Admin deletes", roles: []models.Role{models.RoleAdmin}, permission: models.PermUsersDelete, global: true, self: true},
+		{name: "Support writes", roles: []models.Role{models.RoleSupport}, permission: models.PermUsersWrite, global: true, self: true},
+		{name: "Support reads PII", roles: []models.Role{models.RoleSupport}, permission: models.PermUsersReadPII, global: false, self: false},
+		{name: "Support deletes", roles: []models.Role{models.RoleSupport}, permission: models.PermUsersDelete, global: false, self: false},
+		{name: "Self reads", roles: []models.Role{models.RoleSelf}, permission: models.PermUsersRead, global: false, self: true},
+		{name: "Self deletes", roles: []models.Role{models.RoleSelf}, permission: models.PermUsersDelete, global: false, self: false},
+		{name: "Self manages roles", roles: []models.Role{models.RoleSelf}, permission: models.PermUsersManageRoles, global: false, self: false},
+		{name: "No roles", roles: nil, permission: models.PermUsersRead, global: false, self: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := models.HasPermission(tt.roles, tt.permission); got != tt.global {
+				t.Errorf("HasPermission() = %v, want %v", got, tt.global)
+			}
+			if got := models.HasSelfPermission(tt.roles, tt.permission); got != tt.self {
+				t.Errorf("HasSelfPermission() = %v, want %v", got, tt.self)
+			}
+		})
+	}
+
+	// Los usuarios nuevos sin roles explícitos son RoleSelf
+	user := models.NewUser(models.CreateUserRequest{Name: "John Doe", Email: "john.doe@example.com", Age: 30})
+	if len(user.Roles) != 1 || user.Roles[0] != models.RoleSelf {
+		t.Errorf("Expected default roles [self], got %v", user.Roles)
+	}
+}
+
+func TestUserResponseMaskPII(t *testing.T) {
+	response := models.UserResponse{
+		Name:    "John Doe",
+		Email:   "john.doe@example.com",
+		Phone:   "+1234567890",
+		Address: "123 Main St",
+	}
+
+	masked := response.MaskPII()
+
+	if masked.Name != response.Name {
+		t.Errorf("Expected Name to be kept, got %s", masked.Name)
+	}
+	if masked.Email != "j***@example.com" {
+		t.Errorf("Expected masked email, got %s", masked.Email)
+	}
+	if masked.Phone != "***7890" {
+		t.Errorf("Expected masked phone, got %s", masked.Phone)
+	}
+	if masked.Address != "***" {
+		t.Errorf("Expected masked address, got %s", masked.Address)
+	}
+}
+
+func TestParseUserSort(t *testing.T) {
+	tests := []struct {
+		name    string
+		sort    string
+		want    []models.SortField
+		wantErr bool
+	}{
+		{name: "Default sort", sort: "", want: models.DefaultUserSort},
+		{name: "Multiple fields", sort: "name,-age", want: []models.SortField{{Field: "name"}, {Field: "age", Desc: true}}},
+		{name: "Duplicated field", sort: "age, -age", want: []models.SortField{{Field: "age"}}},
+		{name: "Field not allowed", sort: "password_hash", wantErr: true},
+		{name: "Operator injection", sort: "$where", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := models.ParseUserSort(tt.sort)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseUserSort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseUserSort() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameRoles(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []models.Role
+		want bool
+	}{
+		{name: "Same roles in another order", a: []models.Role{models.RoleAdmin, models.RoleSupport}, b: []models.Role{models.RoleSupport, models.RoleAdmin}, want: true},
+		{name: "Repeated roles", a: []models.Role{models.RoleSupport}, b: []models.Role{models.RoleSupport, models.RoleSupport}, want: true},
+		{name: "No roles is self", a: nil, b: []models.Role{models.RoleSelf}, want: true},
+		{name: "Added role", a: []models.Role{models.RoleSelf}, b: []models.Role{models.RoleSelf, models.RoleAdmin}, want: false},
+		{name: "Replaced role", a: []models.Role{models.RoleSupport}, b: []models.Role{models.RoleAdmin}, want: false},
+		{name: "Removed roles", a: []models.Role{models.RoleAdmin}, b: []models.Role{}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := models.SameRoles(tt.a, tt.b); got != tt.want {
+				t.Errorf("SameRoles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalEmail(t *testing.T) {
+	tests := []struct {
+		name          string
+		email         string
+		providerRules bool
+		wantDisplay   string
+		wantCanonical string
+	}{
+		{name: "Trims and lowercases the domain", email: "  John.Doe@Example.COM ", wantDisplay: "John.Doe@example.com", wantCanonical: "john.doe@example.com"},
+		{name: "Gmail without provider rules", email: "John.Doe+news@Gmail.com", wantDisplay: "John.Doe+news@gmail.com", wantCanonical: "john.doe+news@gmail.com"},
+		{name: "Gmail with provider rules", email: "John.Doe+news@Gmail.com", providerRules: true, wantDisplay: "John.Doe+news@gmail.com", wantCanonical: "johndoe@gmail.com"},
+		{name: "Googlemail alias", email: "john.doe@googlemail.com", providerRules: true, wantDisplay: "john.doe@googlemail.com", wantCanonical: "johndoe@gmail.com"},
+		{name: "Other providers keep dots and tags", email: "john.doe+news@example.com", providerRules: true, wantDisplay: "john.doe+news@example.com", wantCanonical: "john.doe+news@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := models.NormalizeEmail(tt.email); got != tt.wantDisplay {
+				t.Errorf("NormalizeEmail() = %q, want %q", got, tt.wantDisplay)
+			}
+			if got := models.CanonicalEmail(tt.email, tt.providerRules); got != tt.wantCanonical {
+				t.Errorf("CanonicalEmail() = %q, want %q", got, tt.wantCanonical)
+			}
+		})
+	}
+}
+
+func TestParseRateLimitPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    map[string]models.RateLimitPolicy
+		wantErr bool
+	}{
+		{name: "Disabled", spec: "none", want: map[string]models.RateLimitPolicy{}},
+		{name: "Burst defaults to the limit", spec: "auth=10/1m", want: map[string]models.RateLimitPolicy{
+			"auth": {Name: "auth", Limit: 10, Period: time.Minute, Burst: 10},
+		}},
+		{name: "Several policies with burst", spec: "users.read=300/1m, users.write=60/1m:20", want: map[string]models.RateLimitPolicy{
+			"users.read":  {Name: "users.read", Limit: 300, Period: time.Minute, Burst: 300},
+			"users.write": {Name: "users.write", Limit: 60, Period: time.Minute, Burst: 20},
+		}},
+		{name: "Missing period", spec: "auth=10", wantErr: true},
+		{name: "Invalid period", spec: "auth=10/minute", wantErr: true},
+		{name: "Zero limit", spec: "auth=0/1m", wantErr: true},
+		{name: "Invalid burst", spec: "auth=10/1m:x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := models.ParseRateLimitPolicies(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRateLimitPolicies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRateLimitPolicies() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
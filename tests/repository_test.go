@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"go-users-api/models"
+	"go-users-api/repository"
+)
+
+// newMockDatabase crea un cliente de MongoDB simulado: no necesita un servidor, responde con las
+// respuestas añadidas con AddMockResponses y permite inspeccionar los comandos enviados
+func newMockDatabase(t *testing.T) *mtest.T {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	t.Cleanup(mt.Close)
+	return mt
+}
+
+func TestRepositoryGetByIDs(t *testing.T) {
+	objectID := primitive.NewObjectID()
+
+	tests := []struct {
+		name      string
+		ids       []string
+		wantOr    []string // Campos de cada rama del $or enviado
+		wantQuery bool
+	}{
+		{name: "Only ObjectIDs", ids: []string{objectID.Hex()}, wantOr: []string{"_id"}, wantQuery: true},
+		{name: "Only UUIDs", ids: []string{"550e8400-e29b-41d4-a716-446655440000"}, wantOr: []string{"uuid"}, wantQuery: true},
+		{name: "Both", ids: []string{objectID.Hex(), "550e8400-e29b-41d4-a716-446655440000"}, wantOr: []string{"_id", "uuid"}, wantQuery: true},
+		{name: "No IDs", ids: nil, wantQuery: false},
+	}
+
+	mt := newMockDatabase(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			repo := repository.NewUserRepository(mt.DB)
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, mt.DB.Name()+".users", mtest.FirstBatch))
+
+			_, err := repo.GetByIDs(context.Background(), tt.ids)
+			assert.NoError(t, err)
+
+			started := mt.GetStartedEvent()
+			if !tt.wantQuery {
+				assert.Nil(t, started)
+				return
+			}
+			assert.Equal(t, "find", started.CommandName)
+
+			// Ninguna rama puede enviar {"$in": null}, que MongoDB rechaza
+			branches, ok := started.Command.Lookup("filter", "$or").ArrayOK()
+			assert.True(t, ok)
+			values, _ := branches.Values()
+			var fields []string
+			for _, value := range values {
+				branch := value.Document()
+				element, _ := branch.IndexErr(0)
+				fields = append(fields, element.Key())
+				in := element.Value().Document().Lookup("$in")
+				assert.Equal(t, bson.TypeArray, in.Type, "branch %s", element.Key())
+			}
+			assert.Equal(t, tt.wantOr, fields)
+		})
+	}
+}
+
+func TestRepositoryEnsureIndexesDropsLegacyEmailIndex(t *testing.T) {
+	tests := []struct {
+		name         string
+		dropResponse bson.D
+		wantErr      bool
+	}{
+		{name: "Legacy index exists", dropResponse: mtest.CreateSuccessResponse()},
+		{name: "Legacy index already dropped", dropResponse: mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 27, Name: "IndexNotFound", Message: "index not found with name [users_email_unique]"})},
+		{name: "Drop fails", dropResponse: mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Name: "Unauthorized", Message: "not authorized"}), wantErr: true},
+	}
+
+	mt := newMockDatabase(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			repo := repository.NewUserRepository(mt.DB)
+			mt.AddMockResponses(tt.dropResponse, mtest.CreateSuccessResponse())
+
+			err := repo.EnsureIndexes(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			started := mt.GetStartedEvent()
+			assert.Equal(t, "dropIndexes", started.CommandName)
+			assert.Equal(t, "users_email_unique", started.Command.Lookup("index").StringValue())
+
+			if !tt.wantErr {
+				assert.Equal(t, "createIndexes", mt.GetStartedEvent().CommandName)
+			}
+		})
+	}
+}
+
+func TestRepositoryCreateMapsEmailConflicts(t *testing.T) {
+	tests := []struct {
+		name       string
+		keyPattern bson.D
+		wantErr    error
+	}{
+		{name: "Email index", keyPattern: bson.D{{Key: "email_canonical", Value: 1}, {Key: "deleted_at", Value: 1}}, wantErr: models.ErrEmailTaken},
+		{name: "Other unique index", keyPattern: bson.D{{Key: "uuid", Value: 1}}},
+	}
+
+	mt := newMockDatabase(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			repo := repository.NewUserRepository(mt.DB)
+			// El nombre del índice del mensaje no debe influir: solo cuenta el keyPattern
+			mt.AddMockResponses(bson.D{
+				{Key: "ok", Value: 1},
+				{Key: "n", Value: 0},
+				{Key: "writeErrors", Value: bson.A{bson.D{
+					{Key: "index", Value: 0},
+					{Key: "code", Value: 11000},
+					{Key: "errmsg", Value: "E11000 duplicate key error collection: test.users index: custom_name dup key"},
+					{Key: "keyPattern", Value: tt.keyPattern},
+				}}},
+			})
+
+			err := repo.Create(context.Background(), &models.User{Name: "Test User", Email: "test@example.com"})
+			assert.Error(t, err)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NotErrorIs(t, err, models.ErrEmailTaken)
+			}
+		})
+	}
+}
+
+func TestRepositoryGetAllPrefixFilters(t *testing.T) {
+	mt := newMockDatabase(t)
+	mt.Run("Anchored prefix on lowercase fields", func(mt *mtest.T) {
+		repo := repository.NewUserRepository(mt.DB)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, mt.DB.Name()+".users", mtest.FirstBatch))
+
+		_, err := repo.GetAll(context.Background(), models.UserFilter{Name: "Jo.hn", Email: "JOHN@"}, 1, 10)
+		assert.NoError(t, err)
+
+		// Sin la opción "i" y anclada al inicio, MongoDB la resuelve como un rango del índice
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		pattern, options := filter.Lookup("name_lower").Regex()
+		assert.Equal(t, `^jo\.hn`, pattern)
+		assert.Empty(t, options)
+		pattern, options = filter.Lookup("email_canonical").Regex()
+		assert.Equal(t, "^john@", pattern)
+		assert.Empty(t, options)
+		assert.Nil(t, filter.Lookup("name").Value)
+		assert.Nil(t, filter.Lookup("email").Value)
+	})
+}
+
+func TestRepositoryEnsureIndexesReportsDuplicateEmails(t *testing.T) {
+	mt := newMockDatabase(t)
+	mt.Run("Duplicates listed", func(mt *mtest.T) {
+		repo := repository.NewUserRepository(mt.DB)
+		first, second := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11000, Name: "DuplicateKey", Message: "E11000 duplicate key error collection: users index: users_email_canonical_unique"}),
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".users", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: bson.D{{Key: "email", Value: "ana@example.com"}, {Key: "deleted_at", Value: nil}}},
+				{Key: "ids", Value: bson.A{first, second}},
+				{Key: "count", Value: 2},
+			}),
+		)
+
+		err := repo.EnsureIndexes(context.Background())
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "ana@example.com")
+		assert.Contains(t, err.Error(), first.Hex())
+		assert.Contains(t, err.Error(), second.Hex())
+
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		assert.Equal(t, "aggregate", mt.GetStartedEvent().CommandName)
+	})
+
+	mt.Run("Report fails", func(mt *mtest.T) {
+		repo := repository.NewUserRepository(mt.DB)
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11000, Name: "DuplicateKey", Message: "E11000 duplicate key error"}),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Name: "Unauthorized", Message: "not authorized"}),
+		)
+
+		// Sin el detalle se conserva el error original del índice
+		err := repo.EnsureIndexes(context.Background())
+		assert.ErrorContains(t, err, "E11000")
+	})
+}
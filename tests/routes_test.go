@@ -2,28 +2,35 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
-	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
 
-	"go-users-api/controllers"
+	"go-users-api/middleware"
 	"go-users-api/models"
+	"go-users-api/repository"
 	"go-users-api/routes"
+	"go-users-api/services"
+	"go-users-api/tracing"
 )
 
 func TestSetupRoutes(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	router := gin.New()
-
-	mockService := NewMockUserService()
-	controller := controllers.NewUserController(mockService)
-
 	// Configurar rutas
-	routes.SetupRoutes(router, controller)
+	router := setupTestRoutes(NewMockUserService())
+	token := newTestAccessToken(models.RoleAdmin)
 
 	tests := []struct {
 		name           string
@@ -67,7 +74,7 @@ func TestSetupRoutes(t *testing.T) {
 			name:   "Update user",
 			method: "PUT",
 			path:   "/api/v1/users/test-id",
-			body: models.UpdateUserRequest{
+			body: models.ReplaceUserRequest{
 				Name:  "John Updated",
 				Email: "john.updated@example.com",
 				Age:   31,
@@ -96,6 +103,7 @@ func TestSetupRoutes(t *testing.T) {
 			}
 
 			assert.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
 
 			w := httptest.NewRecorder()
 			router.ServeHTTP(w, req)
@@ -113,36 +121,30 @@ func TestSetupRoutes(t *testing.T) {
 }
 
 func TestHealthCheck(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	router := gin.New()
-
 	// Configurar rutas
-	mockService := NewMockUserService()
-	controller := controllers.NewUserController(mockService)
-	routes.SetupRoutes(router, controller)
+	router := setupTestRoutes(NewMockUserService())
 
-	req, _ := http.NewRequest("GET", "/api/v1/health", nil)
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
+	// /api/v1/health se mantiene por compatibilidad como alias de /readyz
+	for _, path := range []string{"/livez", "/readyz", "/startupz", "/api/v1/health"} {
+		t.Run(path, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, http.StatusOK, w.Code)
 
-	var response map[string]interface{}
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.Equal(t, "ok", response["status"])
-	assert.Equal(t, "API Users BRM is running", response["message"])
-	assert.NotEmpty(t, response["time"])
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.Equal(t, "up", response["status"])
+			assert.NotEmpty(t, response["time"])
+		})
+	}
 }
 
 func TestSwaggerEndpoint(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	router := gin.New()
-
 	// Configurar rutas
-	mockService := NewMockUserService()
-	controller := controllers.NewUserController(mockService)
-	routes.SetupRoutes(router, controller)
+	router := setupTestRoutes(NewMockUserService())
 
 	req, _ := http.NewRequest("GET", "/swagger/index.html", nil)
 	w := httptest.NewRecorder()
@@ -153,13 +155,8 @@ func TestSwaggerEndpoint(t *testing.T) {
 }
 
 func TestCORSHeaders(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	router := gin.New()
-
 	// Configurar rutas
-	mockService := NewMockUserService()
-	controller := controllers.NewUserController(mockService)
-	routes.SetupRoutes(router, controller)
+	router := setupTestRoutes(NewMockUserService())
 
 	tests := []struct {
 		name           string
@@ -205,3 +202,510 @@ func TestCORSHeaders(t *testing.T) {
 		})
 	}
 }
+
+func TestUserRoutesRequireAuthentication(t *testing.T) {
+	router := setupTestRoutes(NewMockUserService())
+
+	tests := []struct {
+		name          string
+		authorization string
+	}{
+		{name: "Missing header", authorization: ""},
+		{name: "Wrong scheme", authorization: "Basic dXNlcjpwYXNz"},
+		{name: "Malformed token", authorization: "Bearer not-a-jwt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/api/v1/users", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+
+			var response models.ErrorResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		})
+	}
+}
+
+func TestUserRoutesPermissions(t *testing.T) {
+	mockService := NewMockUserService()
+	router := setupTestRoutes(mockService)
+
+	self, _ := mockService.CreateUser(context.Background(), models.CreateUserRequest{Name: "Self User", Email: "self@example.com", Age: 30, Phone: "+1234567890"})
+	other, _ := mockService.CreateUser(context.Background(), models.CreateUserRequest{Name: "Other User", Email: "other@example.com", Age: 40, Phone: "+0987654321"})
+
+	selfToken := newTestAccessTokenFor(self)
+	supportToken := newTestAccessToken(models.RoleSupport)
+	adminToken := newTestAccessToken(models.RoleAdmin)
+
+	tests := []struct {
+		name           string
+		token          string
+		method         string
+		path           string
+		body           interface{}
+		contentType    string
+		expectedStatus int
+	}{
+		{name: "Self reads own record", token: selfToken, method: "GET", path: "/api/v1/users/" + self.ID.Hex(), expectedStatus: http.StatusOK},
+		{name: "Self reads another record", token: selfToken, method: "GET", path: "/api/v1/users/" + other.ID.Hex(), expectedStatus: http.StatusForbidden},
+		{name: "Self lists users", token: selfToken, method: "GET", path: "/api/v1/users", expectedStatus: http.StatusForbidden},
+		{name: "Self creates user", token: selfToken, method: "POST", path: "/api/v1/users", body: models.CreateUserRequest{Name: "New", Email: "new@example.com", Age: 20}, expectedStatus: http.StatusForbidden},
+		{name: "Self updates own record", token: selfToken, method: "PUT", path: "/api/v1/users/" + self.ID.Hex(), body: models.ReplaceUserRequest{Name: "Self Updated", Email: "self@example.com", Age: 30}, expectedStatus: http.StatusOK},
+		{name: "Self grants itself admin", token: selfToken, method: "PUT", path: "/api/v1/users/" + self.ID.Hex(), body: models.ReplaceUserRequest{Name: "Self User", Email: "self@example.com", Age: 30, Roles: []models.Role{models.RoleAdmin}}, expectedStatus: http.StatusForbidden},
+		{name: "Self updates another record", token: selfToken, method: "PUT", path: "/api/v1/users/" + other.ID.Hex(), body: models.ReplaceUserRequest{Name: "Hacked", Email: "other@example.com", Age: 40}, expectedStatus: http.StatusForbidden},
+		{name: "Self patches own record", token: selfToken, method: "PATCH", path: "/api/v1/users/" + self.ID.Hex(), body: map[string]string{"phone": "+1111111111"}, contentType: models.MIMEMergePatch, expectedStatus: http.StatusOK},
+		{name: "Self patches its roles", token: selfToken, method: "PATCH", path: "/api/v1/users/" + self.ID.Hex(), body: []map[string]interface{}{{"op": "add", "path": "/roles/-", "value": "admin"}}, contentType: models.MIMEJSONPatch, expectedStatus: http.StatusForbidden},
+		{name: "Self deletes own record", token: selfToken, method: "DELETE", path: "/api/v1/users/" + self.ID.Hex(), expectedStatus: http.StatusForbidden},
+		{name: "Support lists users", token: supportToken, method: "GET", path: "/api/v1/users", expectedStatus: http.StatusOK},
+		{name: "Support filters users by email", token: supportToken, method: "GET", path: "/api/v1/users?email=other", expectedStatus: http.StatusForbidden},
+		{name: "Support searches users", token: supportToken, method: "GET", path: "/api/v1/users?q=main", expectedStatus: http.StatusForbidden},
+		{name: "Support sorts users by email", token: supportToken, method: "GET", path: "/api/v1/users?sort=name,-email", expectedStatus: http.StatusForbidden},
+		{name: "Support sorts users by name", token: supportToken, method: "GET", path: "/api/v1/users?sort=-name&name=other", expectedStatus: http.StatusOK},
+		{name: "Admin filters users by email", token: adminToken, method: "GET", path: "/api/v1/users?email=other&q=main&sort=email", expectedStatus: http.StatusOK},
+		{name: "Support updates another record", token: supportToken, method: "PUT", path: "/api/v1/users/" + other.ID.Hex(), body: models.ReplaceUserRequest{Name: "Other User", Email: "other@example.com", Age: 41}, expectedStatus: http.StatusOK},
+		{name: "Support assigns roles", token: supportToken, method: "PUT", path: "/api/v1/users/" + other.ID.Hex(), body: models.ReplaceUserRequest{Name: "Other User", Email: "other@example.com", Age: 41, Roles: []models.Role{models.RoleSupport}}, expectedStatus: http.StatusForbidden},
+		{name: "Support clears roles", token: supportToken, method: "PUT", path: "/api/v1/users/" + other.ID.Hex(), body: json.RawMessage(`{"name": "Other User", "email": "other@example.com", "age": 41, "roles": []}`), expectedStatus: http.StatusForbidden},
+		{name: "Support deletes user", token: supportToken, method: "DELETE", path: "/api/v1/users/" + other.ID.Hex(), expectedStatus: http.StatusForbidden},
+		{name: "Admin assigns roles", token: adminToken, method: "PUT", path: "/api/v1/users/" + other.ID.Hex(), body: models.ReplaceUserRequest{Name: "Other User", Email: "other@example.com", Age: 41, Roles: []models.Role{models.RoleSupport}}, expectedStatus: http.StatusOK},
+		{name: "Admin deletes user", token: adminToken, method: "DELETE", path: "/api/v1/users/" + other.ID.Hex(), expectedStatus: http.StatusOK},
+		{name: "Support lists trash", token: supportToken, method: "GET", path: "/api/v1/users/trash", expectedStatus: http.StatusForbidden},
+		{name: "Support restores user", token: supportToken, method: "POST", path: "/api/v1/users/" + other.ID.Hex() + "/restore", expectedStatus: http.StatusForbidden},
+		{name: "Admin lists trash", token: adminToken, method: "GET", path: "/api/v1/users/trash", expectedStatus: http.StatusOK},
+		{name: "Admin restores user", token: adminToken, method: "POST", path: "/api/v1/users/" + other.ID.Hex() + "/restore", expectedStatus: http.StatusOK},
+		{name: "Admin restores active user", token: adminToken, method: "POST", path: "/api/v1/users/" + other.ID.Hex() + "/restore", expectedStatus: http.StatusNotFound},
+		{name: "Self reads own record by UUID", token: selfToken, method: "GET", path: "/api/v1/users/" + self.UUID, expectedStatus: http.StatusOK},
+		{name: "Self reads another record by UUID", token: selfToken, method: "GET", path: "/api/v1/users/" + other.UUID, expectedStatus: http.StatusForbidden},
+		{name: "Self uses by-uuid on own record", token: selfToken, method: "GET", path: "/api/v1/users/by-uuid/" + self.UUID, expectedStatus: http.StatusOK},
+		{name: "Self uses by-uuid on another record", token: selfToken, method: "GET", path: "/api/v1/users/by-uuid/" + other.UUID, expectedStatus: http.StatusForbidden},
+		{name: "Self looks up by email", token: selfToken, method: "GET", path: "/api/v1/users/by-email?email=self@example.com", expectedStatus: http.StatusForbidden},
+		{name: "Support looks up by email", token: supportToken, method: "GET", path: "/api/v1/users/by-email?email=other@example.com", expectedStatus: http.StatusForbidden},
+		{name: "Support reads by UUID", token: supportToken, method: "GET", path: "/api/v1/users/by-uuid/" + other.UUID, expectedStatus: http.StatusOK},
+		{name: "Admin looks up by email", token: adminToken, method: "GET", path: "/api/v1/users/by-email?email=Other@Example.com", expectedStatus: http.StatusOK},
+		{name: "Admin looks up unknown email", token: adminToken, method: "GET", path: "/api/v1/users/by-email?email=nobody@example.com", expectedStatus: http.StatusNotFound},
+		{name: "Admin looks up invalid email", token: adminToken, method: "GET", path: "/api/v1/users/by-email?email=not-an-email", expectedStatus: http.StatusBadRequest},
+		{name: "Admin reads unknown UUID", token: adminToken, method: "GET", path: "/api/v1/users/by-uuid/00000000-0000-0000-0000-000000000000", expectedStatus: http.StatusNotFound},
+		{name: "Self reads own history", token: selfToken, method: "GET", path: "/api/v1/users/" + self.ID.Hex() + "/history", expectedStatus: http.StatusForbidden},
+		{name: "Support reads history", token: supportToken, method: "GET", path: "/api/v1/users/" + other.ID.Hex() + "/history", expectedStatus: http.StatusForbidden},
+		{name: "Admin reads history", token: adminToken, method: "GET", path: "/api/v1/users/" + other.ID.Hex() + "/history", expectedStatus: http.StatusOK},
+		{name: "Support queries audit", token: supportToken, method: "GET", path: "/api/v1/audit", expectedStatus: http.StatusForbidden},
+		{name: "Admin queries audit", token: adminToken, method: "GET", path: "/api/v1/audit?action=user.deleted&from=2020-01-01T00:00:00Z", expectedStatus: http.StatusOK},
+		{name: "Admin queries audit with unknown action", token: adminToken, method: "GET", path: "/api/v1/audit?action=user.hacked", expectedStatus: http.StatusBadRequest},
+		{name: "Self bulk creates users", token: selfToken, method: "POST", path: "/api/v1/users/bulk", body: models.BulkCreateRequest{Users: []models.CreateUserRequest{{Name: "New", Email: "new@example.com", Age: 20}}}, expectedStatus: http.StatusForbidden},
+		{name: "Support bulk creates users with roles", token: supportToken, method: "POST", path: "/api/v1/users/bulk", body: models.BulkCreateRequest{Users: []models.CreateUserRequest{{Name: "New", Email: "new@example.com", Age: 20, Roles: []models.Role{models.RoleAdmin}}}}, expectedStatus: http.StatusForbidden},
+		{name: "Support bulk creates users", token: supportToken, method: "POST", path: "/api/v1/users/bulk", body: models.BulkCreateRequest{Users: []models.CreateUserRequest{{Name: "New", Email: "new@example.com", Age: 20}}}, expectedStatus: http.StatusOK},
+		{name: "Support bulk creates nothing", token: supportToken, method: "POST", path: "/api/v1/users/bulk", body: models.BulkCreateRequest{}, expectedStatus: http.StatusBadRequest},
+		{name: "Support bulk updates roles", token: supportToken, method: "PATCH", path: "/api/v1/users/bulk", body: models.BulkUpdateRequest{Users: []models.BulkUpdateItem{{ID: other.ID.Hex(), Changes: json.RawMessage(`{"roles": ["admin"]}`)}}}, expectedStatus: http.StatusMultiStatus},
+		{name: "Support bulk updates capitalized roles", token: supportToken, method: "PATCH", path: "/api/v1/users/bulk", body: models.BulkUpdateRequest{Users: []models.BulkUpdateItem{{ID: other.ID.Hex(), Changes: json.RawMessage(`{"Roles": ["admin"]}`)}}}, expectedStatus: http.StatusMultiStatus},
+		{name: "Support bulk updates with a missing user", token: supportToken, method: "PATCH", path: "/api/v1/users/bulk", body: models.BulkUpdateRequest{Users: []models.BulkUpdateItem{{ID: other.ID.Hex(), Changes: json.RawMessage(`{"age": 42}`)}, {ID: primitive.NewObjectID().Hex(), Changes: json.RawMessage(`{"age": 42}`)}}}, expectedStatus: http.StatusMultiStatus},
+		{name: "Support bulk deletes users", token: supportToken, method: "POST", path: "/api/v1/users/bulk/delete", body: models.BulkDeleteRequest{IDs: []string{other.ID.Hex()}}, expectedStatus: http.StatusForbidden},
+		{name: "Admin bulk deletes users", token: adminToken, method: "POST", path: "/api/v1/users/bulk/delete", body: models.BulkDeleteRequest{IDs: []string{other.ID.Hex()}}, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body *bytes.Buffer
+			if tt.body != nil {
+				jsonBody, _ := json.Marshal(tt.body)
+				body = bytes.NewBuffer(jsonBody)
+			} else {
+				body = &bytes.Buffer{}
+			}
+
+			req, _ := http.NewRequest(tt.method, tt.path, body)
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			req.Header.Set("Content-Type", contentType)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestUserRoutesPatchRoles(t *testing.T) {
+	userService := services.NewUserService(NewMockUserRepository(), newTestAuditService(NewMockAuditRepository()), newTestConfig())
+	router := setupTestRoutes(userService)
+
+	self, err := userService.CreateUser(context.Background(), models.CreateUserRequest{Name: "Self User", Email: "self@example.com", Age: 30})
+	assert.NoError(t, err)
+	selfToken := newTestAccessTokenFor(self)
+	adminToken := newTestAccessToken(models.RoleAdmin)
+
+	// json.Unmarshal acepta claves con otras mayúsculas, así que "Roles" también modifica los roles
+	tests := []struct {
+		name           string
+		token          string
+		contentType    string
+		body           string
+		expectedStatus int
+		expectedRoles  []models.Role
+	}{
+		{name: "Self merge patch with capitalized roles", token: selfToken, contentType: models.MIMEMergePatch, body: `{"Roles": ["admin"]}`, expectedStatus: http.StatusForbidden, expectedRoles: []models.Role{models.RoleSelf}},
+		{name: "Self merge patch with uppercase roles", token: selfToken, contentType: models.MIMEMergePatch, body: `{"ROLES": ["admin"]}`, expectedStatus: http.StatusForbidden, expectedRoles: []models.Role{models.RoleSelf}},
+		{name: "Self JSON patch with capitalized roles", token: selfToken, contentType: models.MIMEJSONPatch, body: `[{"op": "add", "path": "/Roles", "value": ["admin"]}]`, expectedStatus: http.StatusForbidden, expectedRoles: []models.Role{models.RoleSelf}},
+		{name: "Self JSON patch adding a role", token: selfToken, contentType: models.MIMEJSONPatch, body: `[{"op": "add", "path": "/roles/-", "value": "admin"}]`, expectedStatus: http.StatusForbidden, expectedRoles: []models.Role{models.RoleSelf}},
+		{name: "Self patch keeping the same roles", token: selfToken, contentType: models.MIMEMergePatch, body: `{"age": 31, "roles": ["self"]}`, expectedStatus: http.StatusOK, expectedRoles: []models.Role{models.RoleSelf}},
+		{name: "Admin merge patch with capitalized roles", token: adminToken, contentType: models.MIMEMergePatch, body: `{"Roles": ["support"]}`, expectedStatus: http.StatusOK, expectedRoles: []models.Role{models.RoleSupport}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("PATCH", "/api/v1/users/"+self.ID.Hex(), strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			stored, err := userService.GetUserByID(context.Background(), self.ID.Hex())
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedRoles, stored.GetRoles())
+		})
+	}
+}
+
+func TestUserRoutesMaskPII(t *testing.T) {
+	mockService := NewMockUserService()
+	router := setupTestRoutes(mockService)
+
+	user, _ := mockService.CreateUser(context.Background(), models.CreateUserRequest{Name: "John Doe", Email: "john.doe@example.com", Age: 30, Phone: "+1234567890", Address: "123 Main St"})
+
+	tests := []struct {
+		name          string
+		token         string
+		expectedEmail string
+		expectedPhone string
+	}{
+		{name: "Admin sees PII", token: newTestAccessToken(models.RoleAdmin), expectedEmail: "john.doe@example.com", expectedPhone: "+1234567890"},
+		{name: "Support gets masked PII", token: newTestAccessToken(models.RoleSupport), expectedEmail: "j***@example.com", expectedPhone: "***7890"},
+		{name: "Self sees own PII", token: newTestAccessTokenFor(user), expectedEmail: "john.doe@example.com", expectedPhone: "+1234567890"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/api/v1/users/"+user.ID.Hex(), nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Data models.UserResponse `json:"data"`
+			}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedEmail, response.Data.Email)
+			assert.Equal(t, tt.expectedPhone, response.Data.Phone)
+		})
+	}
+}
+
+func TestRateLimitRoutes(t *testing.T) {
+	policies, err := models.ParseRateLimitPolicies("ip=3/1h,users=100/1h")
+	assert.NoError(t, err)
+	deps := newTestDependencies(NewMockUserService())
+	deps.RateLimitService = services.NewRateLimitService(repository.NewMemoryRateLimitRepository(), policies)
+	router := setupTestRouter()
+	routes.SetupRoutes(router, deps)
+
+	request := func(path, token, remoteAddr string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr + ":1234"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Las peticiones sin token o con un token inválido cuentan en el límite por IP de todas las rutas autenticadas
+	assert.Equal(t, http.StatusUnauthorized, request("/api/v1/users", "", "192.0.2.1").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("/api/v1/imports/"+primitive.NewObjectID().Hex(), "invalid", "192.0.2.1").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("/api/v1/audit", "invalid", "192.0.2.1").Code)
+
+	w := request("/api/v1/users", newTestAccessToken(models.RoleAdmin), "192.0.2.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, `3;w=3600;burst=3;policy="ip"`, w.Header().Get("RateLimit-Policy"))
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// Otra IP no se ve afectada; la política del usuario reemplaza las cabeceras de la política por IP
+	w = request("/api/v1/users", newTestAccessToken(models.RoleAdmin), "192.0.2.2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `100;w=3600;burst=100;policy="users"`, w.Header().Get("RateLimit-Policy"))
+}
+
+// newImportRequest crea una petición multipart de importación con el archivo y los campos dados
+func newImportRequest(token, fileName, content string, fields map[string]string) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if fileName != "" {
+		part, _ := writer.CreateFormFile("file", fileName)
+		part.Write([]byte(content))
+	}
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", "/api/v1/users/import", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestImportRoutes(t *testing.T) {
+	userService := services.NewUserService(NewMockUserRepository(), newTestAuditService(NewMockAuditRepository()), newTestConfig())
+	router := setupTestRoutes(userService)
+
+	support := createTestUser()
+	support.ID = primitive.NewObjectID()
+	support.Roles = []models.Role{models.RoleSupport}
+	supportToken := newTestAccessTokenFor(support)
+	otherSupportToken := newTestAccessToken(models.RoleSupport)
+	adminToken := newTestAccessToken(models.RoleAdmin)
+	csvFile := "name,email,age,roles\nAna,ana@example.com,25,\nRoot,root@example.com,40,admin\n"
+
+	tests := []struct {
+		name           string
+		token          string
+		fileName       string
+		content        string
+		fields         map[string]string
+		expectedStatus int
+	}{
+		{name: "Self imports users", token: newTestAccessToken(models.RoleSelf), fileName: "users.csv", content: csvFile, expectedStatus: http.StatusForbidden},
+		{name: "Support imports without file", token: supportToken, fields: map[string]string{"format": "csv"}, expectedStatus: http.StatusBadRequest},
+		{name: "Support imports unknown format", token: supportToken, fileName: "users.txt", content: csvFile, expectedStatus: http.StatusBadRequest},
+		{name: "Support imports with invalid mapping", token: supportToken, fileName: "users.csv", content: csvFile, fields: map[string]string{"mapping": "[1]"}, expectedStatus: http.StatusBadRequest},
+		{name: "Support imports a large file synchronously", token: supportToken, fileName: "users.csv", content: csvFile + strings.Repeat("x", 8<<10), expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "Support imports a file above the limit", token: supportToken, fileName: "users.csv", content: strings.Repeat("x", 2<<20), fields: map[string]string{"async": "true"}, expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "Support dry-runs an import with roles", token: supportToken, fileName: "users.csv", content: csvFile, fields: map[string]string{"dry_run": "true"}, expectedStatus: http.StatusMultiStatus},
+		{name: "Admin imports users with roles", token: adminToken, fileName: "users.csv", content: csvFile, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, newImportRequest(tt.token, tt.fileName, tt.content, tt.fields))
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+
+	// Importación asíncrona: solo quien la inició o un administrador pueden consultarla
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newImportRequest(supportToken, "users.ndjson", `{"name": "Luis", "email": "luis@example.com", "age": 30}`, map[string]string{"async": "true"}))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	var job models.ImportJob
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, models.ImportNDJSON, job.Format)
+	assert.Equal(t, "/api/v1/imports/"+job.ID.Hex(), w.Header().Get("Location"))
+
+	jobTests := []struct {
+		name           string
+		token          string
+		path           string
+		expectedStatus int
+	}{
+		{name: "Creator reads the job", token: supportToken, path: "/api/v1/imports/" + job.ID.Hex(), expectedStatus: http.StatusOK},
+		{name: "Another support user reads the job", token: otherSupportToken, path: "/api/v1/imports/" + job.ID.Hex(), expectedStatus: http.StatusNotFound},
+		{name: "Admin reads the job", token: adminToken, path: "/api/v1/imports/" + job.ID.Hex(), expectedStatus: http.StatusOK},
+		{name: "Creator downloads the rejected rows", token: supportToken, path: "/api/v1/imports/" + job.ID.Hex() + "/rejected", expectedStatus: http.StatusOK},
+		{name: "Admin reads an unknown job", token: adminToken, path: "/api/v1/imports/not-an-id", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range jobTests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestExportRoutes(t *testing.T) {
+	userService := services.NewUserService(NewMockUserRepository(), newTestAuditService(NewMockAuditRepository()), newTestConfig())
+	userService.CreateUser(context.Background(), models.CreateUserRequest{Name: "Ana", Email: "ana@example.com", Age: 25})
+	router := setupTestRoutes(userService)
+
+	tests := []struct {
+		name                string
+		token               string
+		query               string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{name: "Self exports users", token: newTestAccessToken(models.RoleSelf), expectedStatus: http.StatusForbidden},
+		{name: "Support exports an unknown format", token: newTestAccessToken(models.RoleSupport), query: "?format=pdf", expectedStatus: http.StatusBadRequest},
+		{name: "Support exports an unknown column", token: newTestAccessToken(models.RoleSupport), query: "?columns=password", expectedStatus: http.StatusBadRequest},
+		{name: "Support exports users filtered by email", token: newTestAccessToken(models.RoleSupport), query: "?email=ana", expectedStatus: http.StatusForbidden},
+		{name: "Support exports users sorted by email", token: newTestAccessToken(models.RoleSupport), query: "?sort=-email", expectedStatus: http.StatusForbidden},
+		{name: "Support exports masked emails", token: newTestAccessToken(models.RoleSupport), query: "?columns=email", expectedStatus: http.StatusOK, expectedContentType: "text/csv; charset=utf-8", expectedBody: "email\n" + models.MaskEmail("ana@example.com") + "\n"},
+		{name: "Admin exports NDJSON", token: newTestAccessToken(models.RoleAdmin), query: "?format=ndjson&columns=name,email", expectedStatus: http.StatusOK, expectedContentType: "application/x-ndjson", expectedBody: `{"name":"Ana","email":"ana@example.com"}` + "\n"},
+		{name: "Admin exports XLSX", token: newTestAccessToken(models.RoleAdmin), query: "?format=xlsx", expectedStatus: http.StatusOK, expectedContentType: models.ExportXLSX.ContentType()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/api/v1/users/export"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedContentType != "" {
+				assert.Equal(t, tt.expectedContentType, w.Header().Get("Content-Type"))
+				assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment; filename=\"users-")
+			} else {
+				assert.Empty(t, w.Header().Get("Content-Disposition"))
+			}
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	userService := services.NewUserService(repository.NewObservedUserRepository(NewMockUserRepository()), newTestAuditService(NewMockAuditRepository()), newTestConfig())
+	router := setupTestRoutes(userService)
+	adminToken := newTestAccessToken(models.RoleAdmin)
+
+	request := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Un alta, un email duplicado, una consulta por ID y una ruta inexistente
+	user := `{"name": "Ana", "email": "metrics@example.com", "age": 30}`
+	assert.Equal(t, http.StatusCreated, request("POST", "/api/v1/users", adminToken, user).Code)
+	assert.Equal(t, http.StatusConflict, request("POST", "/api/v1/users", adminToken, user).Code)
+	request("GET", "/api/v1/users/"+primitive.NewObjectID().Hex(), adminToken, "")
+	request("GET", "/no/such/path", "", "")
+
+	// Sin token (o con otro) no se exponen las métricas
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/metrics", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/metrics", adminToken, "").Code)
+
+	w := request("GET", "/metrics", testMetricsToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	for _, series := range []string{
+		`users_api_http_requests_total{method="POST",route="/api/v1/users",status="201"}`,
+		`users_api_http_requests_total{method="GET",route="/api/v1/users/:id",status="404"}`,
+		`users_api_http_requests_total{method="GET",route="unmatched",status="404"}`,
+		`users_api_http_request_duration_seconds_bucket{method="POST",route="/api/v1/users",status="409",le="+Inf"}`,
+		`users_api_mongo_operation_duration_seconds_count{operation="GetByID"}`,
+		`users_api_user_changes_total{action="user.created"}`,
+		`users_api_user_conflicts_total{reason="email_taken"}`,
+		"go_goroutines",
+	} {
+		assert.Contains(t, body, series)
+	}
+	assert.NotContains(t, body, `route="/no/such/path"`)
+	assert.NotContains(t, body, `mongo_operation_errors_total{operation="GetByID"}`)
+}
+
+func TestTracing(t *testing.T) {
+	// El exportador stdout escribe los spans en un archivo, sin necesidad de un collector
+	traceFile := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{Exporter: tracing.ExporterStdout, File: traceFile})
+	assert.NoError(t, err)
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	userService := services.NewTracedUserService(services.NewUserService(
+		repository.NewObservedUserRepository(NewMockUserRepository()), newTestAuditService(NewMockAuditRepository()), newTestConfig()))
+	router := setupTestRoutes(userService)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest("GET", "/api/v1/users/"+primitive.NewObjectID().Hex(), nil)
+	req.Header.Set("Authorization", "Bearer "+newTestAccessToken(models.RoleAdmin))
+	req.Header.Set(middleware.TraceParentHeader, "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Un comando de MongoDB dentro de la misma traza
+	monitor := tracing.MongoMonitor()
+	ctx := tracing.ContextWithTraceParent(context.Background(), "00-"+traceID+"-00f067aa0ba902b7-01")
+	command, _ := bson.Marshal(bson.D{{Key: "find", Value: "users"}, {Key: "filter", Value: bson.D{{Key: "email", Value: "ana@example.com"}}}})
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: command, DatabaseName: "users_brm", CommandName: "find", RequestID: 1, ConnectionID: "mongo:27017-3"})
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 1}})
+
+	assert.NoError(t, shutdown(context.Background()))
+
+	type exportedSpan struct {
+		Name        string
+		SpanContext struct{ TraceID, SpanID string }
+		Parent      struct{ SpanID string }
+		Status      struct{ Code string }
+		Attributes  []struct {
+			Key   string
+			Value struct{ Value any }
+		}
+	}
+	file, err := os.Open(traceFile)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	spans := map[string]exportedSpan{}
+	decoder := json.NewDecoder(file)
+	for decoder.More() {
+		var span exportedSpan
+		assert.NoError(t, decoder.Decode(&span))
+		assert.Equal(t, traceID, span.SpanContext.TraceID, span.Name)
+		spans[span.Name] = span
+	}
+
+	// Servidor -> servicio -> repositorio, colgando del span recibido en traceparent
+	server, service, repo := spans["GET /api/v1/users/:id"], spans["UserService.GetUserByID"], spans["UserRepository.GetByID"]
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID)
+	assert.Equal(t, server.SpanContext.SpanID, service.Parent.SpanID)
+	assert.Equal(t, service.SpanContext.SpanID, repo.Parent.SpanID)
+
+	// Un usuario inexistente no marca los spans como fallidos
+	assert.NotEqual(t, "Error", service.Status.Code)
+	assert.NotEqual(t, "Error", repo.Status.Code)
+
+	// El span del comando no incluye el filtro, que contiene datos personales
+	mongoSpan, found := spans["find users"]
+	assert.True(t, found)
+	attributes := map[string]any{}
+	for _, attribute := range mongoSpan.Attributes {
+		attributes[attribute.Key] = attribute.Value.Value
+	}
+	assert.Equal(t, "mongodb", attributes["db.system"])
+	assert.Equal(t, "users", attributes["db.collection.name"])
+	assert.Equal(t, "mongo", attributes["server.address"])
+	content, _ := os.ReadFile(traceFile)
+	assert.NotContains(t, string(content), "ana@example.com")
+}
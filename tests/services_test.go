@@ -1,15 +1,27 @@
 package tests
 
 import (
+	"archive/zip"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"go-users-api/models"
+	"go-users-api/repository"
+	"go-users-api/reqctx"
 	"go-users-api/services"
 )
 
 func TestValidateUserData(t *testing.T) {
-	service := services.NewUserService(nil)
+	service := services.NewUserService(nil, nil, newTestConfig())
 
 	tests := []struct {
 		name    string
@@ -75,7 +87,7 @@ func TestValidateUserData(t *testing.T) {
 
 func TestServiceCreateUser(t *testing.T) {
 	mockRepo := NewMockUserRepository()
-	service := services.NewUserService(mockRepo)
+	service := services.NewUserService(mockRepo, newTestAuditService(NewMockAuditRepository()), newTestConfig())
 
 	req := models.CreateUserRequest{
 		Name:    "John Doe",
@@ -112,7 +124,7 @@ func TestServiceCreateUser(t *testing.T) {
 
 func TestServiceGetUserByID(t *testing.T) {
 	mockRepo := NewMockUserRepository()
-	service := services.NewUserService(mockRepo)
+	service := services.NewUserService(mockRepo, newTestAuditService(NewMockAuditRepository()), newTestConfig())
 
 	// Crear un usuario primero
 	req := models.CreateUserRequest{
@@ -148,7 +160,7 @@ func TestServiceGetUserByID(t *testing.T) {
 
 func TestServiceGetUsers(t *testing.T) {
 	mockRepo := NewMockUserRepository()
-	service := services.NewUserService(mockRepo)
+	service := services.NewUserService(mockRepo, newTestAuditService(NewMockAuditRepository()), newTestConfig())
 
 	// Crear algunos usuarios
 	users := []models.CreateUserRequest{
@@ -162,7 +174,7 @@ func TestServiceGetUsers(t *testing.T) {
 	}
 
 	// Test obtener usuarios
-	response, err := service.GetUsers(context.Background(), "1", "10")
+	response, err := service.GetUsers(context.Background(), models.UserListQuery{Page: "1", Limit: "10"})
 	if err != nil {
 		t.Errorf("GetUsers() error = %v", err)
 	}
@@ -171,14 +183,14 @@ func TestServiceGetUsers(t *testing.T) {
 		t.Errorf("Expected 3 users, got %d", len(response.Users))
 	}
 
-	if response.Total != 3 {
-		t.Errorf("Expected total 3, got %d", response.Total)
+	if response.Total == nil || *response.Total != 3 {
+		t.Errorf("Expected total 3, got %v", response.Total)
 	}
 }
 
 func TestServiceUpdateUser(t *testing.T) {
 	mockRepo := NewMockUserRepository()
-	service := services.NewUserService(mockRepo)
+	service := services.NewUserService(mockRepo, newTestAuditService(NewMockAuditRepository()), newTestConfig())
 
 	// Crear un usuario
 	req := models.CreateUserRequest{
@@ -192,7 +204,7 @@ func TestServiceUpdateUser(t *testing.T) {
 	createdUser, _ := service.CreateUser(context.Background(), req)
 
 	// Test actualizar usuario
-	updateReq := models.UpdateUserRequest{
+	updateReq := models.ReplaceUserRequest{
 		Name:    "John Updated",
 		Email:   "john.updated@example.com",
 		Age:     31,
@@ -200,9 +212,9 @@ func TestServiceUpdateUser(t *testing.T) {
 		Address: "456 Oak Ave, Town, State",
 	}
 
-	updatedUser, err := service.UpdateUser(context.Background(), createdUser.UUID, updateReq)
+	updatedUser, err := service.ReplaceUser(context.Background(), createdUser.UUID, updateReq, nil)
 	if err != nil {
-		t.Errorf("UpdateUser() error = %v", err)
+		t.Errorf("ReplaceUser() error = %v", err)
 	}
 
 	if updatedUser.Name != updateReq.Name {
@@ -214,7 +226,7 @@ func TestServiceUpdateUser(t *testing.T) {
 	}
 
 	// Test actualizar usuario inexistente
-	_, err = service.UpdateUser(context.Background(), "non-existent-id", updateReq)
+	_, err = service.ReplaceUser(context.Background(), "non-existent-id", updateReq, nil)
 	if err == nil {
 		t.Error("Expected error for non-existent user")
 	}
@@ -226,7 +238,7 @@ func TestServiceUpdateUser(t *testing.T) {
 
 func TestServiceDeleteUser(t *testing.T) {
 	mockRepo := NewMockUserRepository()
-	service := services.NewUserService(mockRepo)
+	service := services.NewUserService(mockRepo, newTestAuditService(NewMockAuditRepository()), newTestConfig())
 
 	// Crear un usuario
 	req := models.CreateUserRequest{
@@ -261,3 +273,863 @@ func TestServiceDeleteUser(t *testing.T) {
 		t.Errorf("Expected error 'user not found', got %s", err.Error())
 	}
 }
+
+func TestServiceAuthenticate(t *testing.T) {
+	mockRepo := NewMockUserRepository()
+	service := services.NewUserService(mockRepo, newTestAuditService(NewMockAuditRepository()), newTestConfig())
+
+	req := models.CreateUserRequest{
+		Name:     "John Doe",
+		Email:    "john.doe@example.com",
+		Age:      30,
+		Password: "S3cure-passw0rd",
+	}
+
+	createdUser, err := service.CreateUser(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	// La contraseña nunca se guarda en texto plano
+	if createdUser.PasswordHash == "" || createdUser.PasswordHash == req.Password {
+		t.Error("Expected password to be stored as a hash")
+	}
+
+	// Test credenciales correctas
+	user, err := service.Authenticate(context.Background(), req.Email, req.Password)
+	if err != nil {
+		t.Errorf("Authenticate() error = %v", err)
+	}
+	if user != nil && user.UUID != createdUser.UUID {
+		t.Errorf("Expected user %s, got %s", createdUser.UUID, user.UUID)
+	}
+
+	// Test contraseña incorrecta y email inexistente
+	for _, email := range []string{req.Email, "unknown@example.com"} {
+		_, err = service.Authenticate(context.Background(), email, "wrong-password")
+		if err != models.ErrInvalidCredentials {
+			t.Errorf("Expected ErrInvalidCredentials for %s, got %v", email, err)
+		}
+	}
+}
+
+func TestAuthServiceRefreshRotation(t *testing.T) {
+	userService := NewMockUserService()
+	refreshRepo := NewMockRefreshTokenRepository()
+	authService := services.NewAuthService(userService, newTestTokenService(), refreshRepo)
+	ctx := context.Background()
+
+	userService.CreateUser(ctx, models.CreateUserRequest{Name: "John Doe", Email: "john@example.com", Age: 30, Password: "S3cure-passw0rd"})
+	login := models.LoginRequest{Email: "john@example.com", Password: "S3cure-passw0rd"}
+
+	first, err := authService.Login(ctx, login)
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	// Cada uso rota el token
+	second, err := authService.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("Expected a new refresh token after rotation")
+	}
+
+	// Una sesión independiente no debe verse afectada por la reutilización en otra
+	otherSession, err := authService.Login(ctx, login)
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	// Reutilizar un token ya rotado revoca toda la familia
+	if _, err := authService.Refresh(ctx, first.RefreshToken); err != models.ErrTokenReused {
+		t.Errorf("Expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err := authService.Refresh(ctx, second.RefreshToken); err != models.ErrInvalidToken {
+		t.Errorf("Expected revoked token to be rejected with ErrInvalidToken, got %v", err)
+	}
+	if _, err := authService.Refresh(ctx, otherSession.RefreshToken); err != nil {
+		t.Errorf("Expected other session to remain valid, got %v", err)
+	}
+}
+
+func TestAuthServiceLogout(t *testing.T) {
+	userService := NewMockUserService()
+	refreshRepo := NewMockRefreshTokenRepository()
+	authService := services.NewAuthService(userService, newTestTokenService(), refreshRepo)
+	ctx := context.Background()
+
+	user, _ := userService.CreateUser(ctx, models.CreateUserRequest{Name: "John Doe", Email: "john@example.com", Age: 30, Password: "S3cure-passw0rd"})
+	login := models.LoginRequest{Email: "john@example.com", Password: "S3cure-passw0rd"}
+
+	first, _ := authService.Login(ctx, login)
+	second, _ := authService.Login(ctx, login)
+	third, _ := authService.Login(ctx, login)
+
+	// Logout revoca solo la sesión del token presentado
+	if err := authService.Logout(ctx, first.RefreshToken); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+	if _, err := authService.Refresh(ctx, first.RefreshToken); err != models.ErrInvalidToken {
+		t.Errorf("Expected logged out session to be rejected, got %v", err)
+	}
+	if _, err := authService.Refresh(ctx, second.RefreshToken); err != nil {
+		t.Errorf("Expected other session to remain valid, got %v", err)
+	}
+
+	// LogoutAll revoca todas las sesiones restantes
+	if err := authService.LogoutAll(ctx, user.ID.Hex()); err != nil {
+		t.Fatalf("LogoutAll() error = %v", err)
+	}
+	if _, err := authService.Refresh(ctx, third.RefreshToken); err != models.ErrInvalidToken {
+		t.Errorf("Expected all sessions to be revoked, got %v", err)
+	}
+
+	// Un token de acceso no sirve como token de refresco
+	if err := authService.Logout(ctx, newTestAccessToken()); err != models.ErrInvalidToken {
+		t.Errorf("Expected access token to be rejected, got %v", err)
+	}
+}
+
+func TestServiceGetUsersFilters(t *testing.T) {
+	mockRepo := NewMockUserRepository()
+	service := services.NewUserService(mockRepo, newTestAuditService(NewMockAuditRepository()), newTestConfig())
+	ctx := context.Background()
+
+	for _, req := range []models.CreateUserRequest{
+		{Name: "John Doe", Email: "john.doe@example.com", Age: 30},
+		{Name: "Jane Smith", Email: "jane.smith@example.com", Age: 25},
+		{Name: "Johnny Bravo", Email: "johnny@example.com", Age: 45},
+	} {
+		service.CreateUser(ctx, req)
+	}
+
+	minAge, maxAge := 26, 40
+
+	// Test filtros combinados
+	response, err := service.GetUsers(ctx, models.UserListQuery{Name: "JOHN", MinAge: &minAge, MaxAge: &maxAge, Sort: "name,-age"})
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if len(response.Users) != 1 || response.Users[0].Name != "John Doe" {
+		t.Errorf("Expected only John Doe, got %+v", response.Users)
+	}
+
+	// Test rango de edad inválido
+	_, err = service.GetUsers(ctx, models.UserListQuery{MinAge: &maxAge, MaxAge: &minAge})
+	if !errors.Is(err, models.ErrValidation) {
+		t.Errorf("Expected validation error for inverted age range, got %v", err)
+	}
+
+	// Test campo de ordenamiento fuera de la lista blanca
+	_, err = service.GetUsers(ctx, models.UserListQuery{Sort: "password_hash"})
+	if !errors.Is(err, models.ErrValidation) {
+		t.Errorf("Expected validation error for unknown sort field, got %v", err)
+	}
+}
+
+func TestServiceGetUsersCursor(t *testing.T) {
+	mockRepo := NewMockUserRepository()
+	service := services.NewUserService(mockRepo, newTestAuditService(NewMockAuditRepository()), newTestConfig())
+	ctx := context.Background()
+
+	// Crear 5 usuarios con fechas de creación distintas
+	base := time.Now()
+	for i := 0; i < 5; i++ {
+		user := models.NewUser(models.CreateUserRequest{Name: fmt.Sprintf("User %d", i), Email: fmt.Sprintf("user%d@example.com", i), Age: 30})
+		user.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		mockRepo.Create(ctx, user)
+	}
+
+	names := func(response *models.UsersResponse) []string {
+		var result []string
+		for _, user := range response.Users {
+			result = append(result, user.Name)
+		}
+		return result
+	}
+
+	withoutTotal := false
+	first := ""
+	page1, err := service.GetUsers(ctx, models.UserListQuery{Cursor: &first, Limit: "2", IncludeTotal: &withoutTotal})
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if got := names(page1); !reflect.DeepEqual(got, []string{"User 4", "User 3"}) {
+		t.Errorf("Expected first page [User 4 User 3], got %v", got)
+	}
+	if page1.Total != nil {
+		t.Error("Expected total to be skipped")
+	}
+	if page1.NextCursor == "" || page1.PrevCursor != "" {
+		t.Errorf("Expected only next_cursor on the first page, got next=%q prev=%q", page1.NextCursor, page1.PrevCursor)
+	}
+
+	page2, err := service.GetUsers(ctx, models.UserListQuery{Cursor: &page1.NextCursor, Limit: "2"})
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if got := names(page2); !reflect.DeepEqual(got, []string{"User 2", "User 1"}) {
+		t.Errorf("Expected second page [User 2 User 1], got %v", got)
+	}
+
+	page3, _ := service.GetUsers(ctx, models.UserListQuery{Cursor: &page2.NextCursor, Limit: "2"})
+	if got := names(page3); !reflect.DeepEqual(got, []string{"User 0"}) || page3.NextCursor != "" {
+		t.Errorf("Expected last page [User 0] without next_cursor, got %v next=%q", got, page3.NextCursor)
+	}
+
+	// Volver hacia atrás desde la tercera página
+	back, err := service.GetUsers(ctx, models.UserListQuery{Cursor: &page3.PrevCursor, Limit: "2"})
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if got := names(back); !reflect.DeepEqual(got, []string{"User 2", "User 1"}) {
+		t.Errorf("Expected previous page [User 2 User 1], got %v", got)
+	}
+	if back.NextCursor == "" || back.PrevCursor == "" {
+		t.Error("Expected both cursors on a middle page")
+	}
+
+	// Un cursor manipulado se rechaza
+	tampered := page1.NextCursor[:len(page1.NextCursor)-2] + "xx"
+	if _, err := service.GetUsers(ctx, models.UserListQuery{Cursor: &tampered}); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("Expected validation error for tampered cursor, got %v", err)
+	}
+
+	// El límite máximo se aplica siempre
+	all, _ := service.GetUsers(ctx, models.UserListQuery{Limit: "1000000"})
+	if len(all.Users) != 5 {
+		t.Errorf("Expected 5 users, got %d", len(all.Users))
+	}
+}
+
+func TestServiceUpdateUserVersion(t *testing.T) {
+	mockRepo := NewMockUserRepository()
+	service := services.NewUserService(mockRepo, newTestAuditService(NewMockAuditRepository()), newTestConfig())
+	ctx := context.Background()
+
+	createdUser, _ := service.CreateUser(ctx, models.CreateUserRequest{Name: "John Doe", Email: "john@example.com", Age: 30})
+	if createdUser.Version != 1 {
+		t.Fatalf("Expected new user to start at version 1, got %d", createdUser.Version)
+	}
+
+	// Test actualización con la versión esperada
+	version := int64(1)
+	updatedUser, err := service.ReplaceUser(ctx, createdUser.UUID, models.ReplaceUserRequest{Name: "John Updated", Email: "john@example.com", Age: 30}, &version)
+	if err != nil {
+		t.Fatalf("ReplaceUser() error = %v", err)
+	}
+	if updatedUser.Version != 2 {
+		t.Errorf("Expected version 2 after update, got %d", updatedUser.Version)
+	}
+
+	// Test actualización con una versión obsoleta
+	_, err = service.ReplaceUser(ctx, createdUser.UUID, models.ReplaceUserRequest{Name: "Stale", Email: "john@example.com", Age: 30}, &version)
+	if !errors.Is(err, models.ErrPreconditionFailed) {
+		t.Errorf("Expected ErrPreconditionFailed, got %v", err)
+	}
+
+	// Test escritura concurrente: el usuario cambió entre la lectura y la escritura
+	stale, _ := mockRepo.GetByID(ctx, createdUser.UUID)
+	if _, err := service.ReplaceUser(ctx, createdUser.UUID, models.ReplaceUserRequest{Name: "John Updated", Email: "john@example.com", Age: 31}, nil); err != nil {
+		t.Fatalf("ReplaceUser() error = %v", err)
+	}
+	stale.Name = "Lost update"
+	if err := mockRepo.Update(ctx, createdUser.UUID, stale); !errors.Is(err, models.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict for stale write, got %v", err)
+	}
+}
+
+func TestServiceSoftDelete(t *testing.T) {
+	mockRepo := NewMockUserRepository()
+	service := services.NewUserService(mockRepo, newTestAuditService(NewMockAuditRepository()), newTestConfig())
+	ctx := reqctx.WithActor(context.Background(), "admin-id")
+
+	req := models.CreateUserRequest{Name: "John Doe", Email: "john@example.com", Age: 30}
+	createdUser, _ := service.CreateUser(ctx, req)
+
+	if err := service.DeleteUser(ctx, createdUser.UUID); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+
+	// El usuario eliminado desaparece de las consultas normales
+	if _, err := service.GetUserByID(ctx, createdUser.UUID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("Expected deleted user to be hidden, got %v", err)
+	}
+	if err := service.DeleteUser(ctx, createdUser.UUID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("Expected second delete to return ErrNotFound, got %v", err)
+	}
+
+	// Pero aparece en la papelera con quién lo eliminó
+	trash, err := service.GetDeletedUsers(ctx, models.UserListQuery{})
+	if err != nil {
+		t.Fatalf("GetDeletedUsers() error = %v", err)
+	}
+	if len(trash.Users) != 1 || trash.Users[0].DeletedBy != "admin-id" || trash.Users[0].DeletedAt == nil {
+		t.Fatalf("Expected deleted user in trash with deleted_by, got %+v", trash.Users)
+	}
+
+	// Restaurar
+	restored, err := service.RestoreUser(ctx, createdUser.UUID)
+	if err != nil {
+		t.Fatalf("RestoreUser() error = %v", err)
+	}
+	if restored.DeletedAt != nil {
+		t.Error("Expected restored user to leave the trash")
+	}
+	if _, err := service.GetUserByID(ctx, createdUser.UUID); err != nil {
+		t.Errorf("Expected restored user to be visible, got %v", err)
+	}
+
+	// No se puede restaurar si otro usuario tomó el email mientras estaba en la papelera
+	service.DeleteUser(ctx, createdUser.UUID)
+	if _, err := service.CreateUser(ctx, req); err != nil {
+		t.Fatalf("Expected email of a deleted user to be reusable, got %v", err)
+	}
+	if _, err := service.RestoreUser(ctx, createdUser.UUID); !errors.Is(err, models.ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken when restoring, got %v", err)
+	}
+
+	// La purga respeta el periodo de retención
+	if purged, _ := service.PurgeDeletedUsers(ctx, time.Hour); purged != 0 {
+		t.Errorf("Expected nothing purged within retention, got %d", purged)
+	}
+	if purged, _ := service.PurgeDeletedUsers(ctx, 0); purged != 1 {
+		t.Errorf("Expected 1 user purged, got %d", purged)
+	}
+	if _, err := service.RestoreUser(ctx, createdUser.UUID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("Expected purged user to be gone, got %v", err)
+	}
+}
+
+func TestIdempotencyServiceSecretChange(t *testing.T) {
+	repo := NewMockIdempotencyRepository()
+	ctx := context.Background()
+
+	// La respuesta se guarda con el secreto de un proceso anterior
+	cfg := newTestConfig()
+	before := services.NewIdempotencyService(repo, cfg)
+	if stored, err := before.Begin(ctx, "admin:key-1", "fingerprint"); err != nil || stored != nil {
+		t.Fatalf("Begin() = %v, %v; want the request to run", stored, err)
+	}
+	if err := before.Complete(ctx, "admin:key-1", "fingerprint", 201, nil, []byte(`{"id":"1"}`)); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if stored, err := before.Begin(ctx, "admin:key-1", "fingerprint"); err != nil || string(stored.ResponseBody) != `{"id":"1"}` {
+		t.Fatalf("Begin() = %v, %v; want the stored response", stored, err)
+	}
+
+	// Tras reiniciar con otro secreto la respuesta no se puede descifrar: se descarta y la
+	// petición vuelve a ejecutarse en lugar de fallar durante todo el TTL
+	cfg.IdempotencySecret = "another-idempotency-secret"
+	after := services.NewIdempotencyService(repo, cfg)
+	stored, err := after.Begin(ctx, "admin:key-1", "fingerprint")
+	if err != nil || stored != nil {
+		t.Fatalf("Begin() = %v, %v; want the request to run again", stored, err)
+	}
+	if _, err := after.Begin(ctx, "admin:key-1", "fingerprint"); !errors.Is(err, models.ErrIdempotencyInProgress) {
+		t.Errorf("Expected the key to be held by the new request, got %v", err)
+	}
+}
+
+func TestServiceAuditRecordAfterCancel(t *testing.T) {
+	auditRepo := NewMockAuditRepository()
+	auditService := newTestAuditService(auditRepo)
+	service := services.NewUserService(NewMockUserRepository(), auditService, newTestConfig())
+
+	// El cliente se desconecta después de que el cambio se guardó: el evento no debe perderse
+	ctx, cancel := context.WithCancel(reqctx.WithActor(context.Background(), "admin-id"))
+	user, _ := service.CreateUser(context.Background(), models.CreateUserRequest{Name: "John Doe", Email: "john@example.com", Age: 30})
+	cancel()
+	auditService.Record(ctx, models.AuditUserDeleted, user, nil)
+
+	events, _ := auditRepo.Find(context.Background(), models.AuditFilter{Action: models.AuditUserDeleted}, 1, 10)
+	if len(events) != 1 || events[0].ActorID != "admin-id" {
+		t.Errorf("Expected the deletion to be audited with its actor, got %+v", events)
+	}
+}
+
+func TestServiceAuditTrail(t *testing.T) {
+	mockRepo := NewMockUserRepository()
+	auditService := newTestAuditService(NewMockAuditRepository())
+	service := services.NewUserService(mockRepo, auditService, newTestConfig())
+	ctx := reqctx.WithActor(context.Background(), "admin-id")
+	ctx = reqctx.WithRequestID(ctx, "req-1")
+	ctx = reqctx.WithClientIP(ctx, "203.0.113.7")
+
+	createdUser, _ := service.CreateUser(ctx, models.CreateUserRequest{Name: "John Doe", Email: "john@example.com", Age: 30, Phone: "+1234567890"})
+	update := models.ReplaceUserRequest{Name: "John Smith", Email: "john.smith@example.com", Age: 30, Phone: "+1234567890"}
+	if _, err := service.ReplaceUser(ctx, createdUser.UUID, update, nil); err != nil {
+		t.Fatalf("ReplaceUser() error = %v", err)
+	}
+	service.DeleteUser(ctx, createdUser.UUID)
+	service.RestoreUser(ctx, createdUser.UUID)
+
+	history, err := auditService.GetUserHistory(ctx, createdUser.ID.Hex(), models.AuditQuery{})
+	if err != nil {
+		t.Fatalf("GetUserHistory() error = %v", err)
+	}
+	if history.Total != 4 {
+		t.Fatalf("Expected 4 events, got %d", history.Total)
+	}
+
+	// Del más reciente al más antiguo
+	actions := []models.AuditAction{models.AuditUserRestored, models.AuditUserDeleted, models.AuditUserUpdated, models.AuditUserCreated}
+	for i, action := range actions {
+		event := history.Events[i]
+		if event.Action != action {
+			t.Errorf("Event %d: expected %s, got %s", i, action, event.Action)
+		}
+		if event.ActorID != "admin-id" || event.RequestID != "req-1" || event.ClientIP != "203.0.113.7" {
+			t.Errorf("Event %d: expected request metadata, got %+v", i, event)
+		}
+	}
+
+	// La actualización solo registra los campos modificados, con los datos personales enmascarados
+	changes := history.Events[2].Changes
+	expected := []models.AuditChange{
+		{Field: "name", Before: "John Doe", After: "John Smith"},
+		{Field: "email", Before: models.MaskEmail("john@example.com"), After: models.MaskEmail("john.smith@example.com")},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %+v, got %+v", expected, changes)
+	}
+
+	// Consulta global filtrada por acción
+	deletions, err := auditService.QueryEvents(ctx, models.AuditQuery{Action: string(models.AuditUserDeleted)})
+	if err != nil {
+		t.Fatalf("QueryEvents() error = %v", err)
+	}
+	if deletions.Total != 1 || deletions.Events[0].UserID != createdUser.ID.Hex() {
+		t.Errorf("Expected one deletion event, got %+v", deletions.Events)
+	}
+}
+
+// racingUserRepository simula dos altas simultáneas: la comprobación previa nunca ve al otro usuario
+type racingUserRepository struct {
+	repository.UserRepositoryInterface
+}
+
+func (r racingUserRepository) ExistsByEmail(ctx context.Context, email string) (bool, error) {
+	return false, nil
+}
+
+func TestServiceCreateUserDuplicateEmail(t *testing.T) {
+	service := services.NewUserService(racingUserRepository{NewMockUserRepository()}, newTestAuditService(NewMockAuditRepository()), newTestConfig())
+	ctx := context.Background()
+
+	if _, err := service.CreateUser(ctx, models.CreateUserRequest{Name: "John Doe", Email: "john@example.com", Age: 30}); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	// El repositorio rechaza el duplicado aunque la comprobación previa no lo detecte,
+	// y la comparación no distingue mayúsculas
+	_, err := service.CreateUser(ctx, models.CreateUserRequest{Name: "John Again", Email: "John@Example.com", Age: 31})
+	if !errors.Is(err, models.ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken, got %v", err)
+	}
+}
+
+func TestServiceCanonicalEmailLookups(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.EmailProviderRules = true
+	service := services.NewUserService(NewMockUserRepository(), newTestAuditService(NewMockAuditRepository()), cfg)
+	ctx := context.Background()
+
+	user, err := service.CreateUser(ctx, models.CreateUserRequest{Name: "John Doe", Email: "John.Doe@Gmail.COM", Age: 30})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if user.Email != "John.Doe@gmail.com" || user.EmailCanonical != "johndoe@gmail.com" {
+		t.Errorf("Expected display and canonical emails, got %q and %q", user.Email, user.EmailCanonical)
+	}
+
+	// Las búsquedas usan la forma canónica
+	if found, err := service.GetUserByEmail(ctx, "johndoe+work@gmail.com"); err != nil || found.UUID != user.UUID {
+		t.Errorf("Expected lookup by an equivalent email to find the user, got %v", err)
+	}
+	if _, err := service.CreateUser(ctx, models.CreateUserRequest{Name: "John Again", Email: "j.o.h.n.doe@googlemail.com", Age: 31}); !errors.Is(err, models.ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken for an equivalent email, got %v", err)
+	}
+
+	// Cambiar solo las mayúsculas del email no es un conflicto consigo mismo
+	update := models.ReplaceUserRequest{Name: "John Doe", Email: "JOHN.DOE@gmail.com", Age: 30}
+	updated, err := service.ReplaceUser(ctx, user.UUID, update, nil)
+	if err != nil {
+		t.Fatalf("ReplaceUser() error = %v", err)
+	}
+	if updated.Email != "JOHN.DOE@gmail.com" || updated.EmailCanonical != "johndoe@gmail.com" {
+		t.Errorf("Expected updated display email with the same canonical form, got %q and %q", updated.Email, updated.EmailCanonical)
+	}
+}
+
+func TestServiceBulkCreateUsers(t *testing.T) {
+	mockRepo := NewMockUserRepository()
+	service := services.NewUserService(mockRepo, newTestAuditService(NewMockAuditRepository()), newTestConfig())
+	ctx := context.Background()
+	service.CreateUser(ctx, models.CreateUserRequest{Name: "Existing", Email: "taken@example.com", Age: 30})
+
+	users := []models.CreateUserRequest{
+		{Name: "Ana", Email: "ana@example.com", Age: 25},
+		{Name: "Invalid", Email: "not-an-email", Age: 25},
+		{Name: "Taken", Email: "Taken@Example.com", Age: 40},
+	}
+	statuses := func(response *models.BulkResponse) []models.BulkItemStatus {
+		var result []models.BulkItemStatus
+		for _, item := range response.Results {
+			result = append(result, item.Status)
+		}
+		return result
+	}
+
+	// Modo atómico: un solo fallo impide crear el resto
+	response, err := service.BulkCreateUsers(ctx, models.BulkCreateRequest{Atomic: true, Users: users}, validateTestRequest)
+	if err != nil {
+		t.Fatalf("BulkCreateUsers() error = %v", err)
+	}
+	want := []models.BulkItemStatus{models.BulkSkipped, models.BulkInvalid, models.BulkSkipped}
+	if response.Committed || !reflect.DeepEqual(statuses(response), want) {
+		t.Errorf("Expected atomic request to be rolled back with %v, got committed=%t %v", want, response.Committed, statuses(response))
+	}
+	if exists, _ := mockRepo.ExistsByEmail(ctx, "ana@example.com"); exists {
+		t.Error("Expected no user to be created in atomic mode")
+	}
+
+	// Sin validación previa fallida, el conflicto se detecta al escribir y también deshace el resto
+	response, _ = service.BulkCreateUsers(ctx, models.BulkCreateRequest{Atomic: true, Users: []models.CreateUserRequest{users[0], users[2]}}, validateTestRequest)
+	want = []models.BulkItemStatus{models.BulkSkipped, models.BulkConflict}
+	if response.Committed || !reflect.DeepEqual(statuses(response), want) {
+		t.Errorf("Expected write conflict to roll back with %v, got committed=%t %v", want, response.Committed, statuses(response))
+	}
+	if exists, _ := mockRepo.ExistsByEmail(ctx, "ana@example.com"); exists {
+		t.Error("Expected the atomic write to be rolled back")
+	}
+
+	// Modo por elemento: se crean los válidos y se informa el resto
+	response, err = service.BulkCreateUsers(ctx, models.BulkCreateRequest{Users: users}, validateTestRequest)
+	if err != nil {
+		t.Fatalf("BulkCreateUsers() error = %v", err)
+	}
+	want = []models.BulkItemStatus{models.BulkCreated, models.BulkInvalid, models.BulkConflict}
+	if !response.Committed || !reflect.DeepEqual(statuses(response), want) {
+		t.Errorf("Expected %v, got %v", want, statuses(response))
+	}
+	if response.Succeeded != 1 || response.Failed != 2 || response.Results[0].UUID == "" {
+		t.Errorf("Expected counters and the created user's UUID, got %+v", response)
+	}
+	if len(response.Results[1].Errors) == 0 || response.Results[1].Errors[0].Field != "email" {
+		t.Errorf("Expected field errors for the invalid item, got %+v", response.Results[1])
+	}
+
+	// Límite de elementos por petición
+	tooMany := make([]models.CreateUserRequest, newTestConfig().BulkMaxItems+1)
+	if _, err := service.BulkCreateUsers(ctx, models.BulkCreateRequest{Users: tooMany}, validateTestRequest); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("Expected validation error above the item limit, got %v", err)
+	}
+}
+
+func TestServiceBulkUpdateUsersRoles(t *testing.T) {
+	service := services.NewUserService(NewMockUserRepository(), newTestAuditService(NewMockAuditRepository()), newTestConfig())
+	ctx := reqctx.WithActor(context.Background(), "support-id")
+
+	ana, _ := service.CreateUser(ctx, models.CreateUserRequest{Name: "Ana", Email: "ana@example.com", Age: 25})
+	luis, _ := service.CreateUser(ctx, models.CreateUserRequest{Name: "Luis", Email: "luis@example.com", Age: 35})
+	marta, _ := service.CreateUser(ctx, models.CreateUserRequest{Name: "Marta", Email: "marta@example.com", Age: 45})
+
+	// Sin permiso para gestionar roles, se rechaza cualquier cambio de roles aunque la clave
+	// use otras mayúsculas, que json.Unmarshal también acepta
+	response, err := service.BulkUpdateUsers(ctx, models.BulkUpdateRequest{Users: []models.BulkUpdateItem{
+		{ID: ana.ID.Hex(), Changes: json.RawMessage(`{"Roles": ["admin"]}`)},
+		{ID: luis.ID.Hex(), Changes: json.RawMessage(`{"age": 36, "roles": ["self"]}`)},
+		{ID: marta.ID.Hex(), Changes: json.RawMessage(`{"roles": ["support"]}`)},
+	}}, false, validateTestRequest)
+	if err != nil {
+		t.Fatalf("BulkUpdateUsers() error = %v", err)
+	}
+	want := []models.BulkItemStatus{models.BulkForbidden, models.BulkUpdated, models.BulkForbidden}
+	for i, status := range want {
+		if response.Results[i].Status != status {
+			t.Errorf("Item %d: expected %s, got %+v", i, status, response.Results[i])
+		}
+	}
+	if stored, _ := service.GetUserByID(ctx, ana.UUID); !models.SameRoles(stored.GetRoles(), []models.Role{models.RoleSelf}) {
+		t.Errorf("Expected Ana to keep her roles, got %v", stored.Roles)
+	}
+
+	// Con permiso, el cambio se aplica
+	response, err = service.BulkUpdateUsers(ctx, models.BulkUpdateRequest{Users: []models.BulkUpdateItem{
+		{ID: ana.ID.Hex(), Changes: json.RawMessage(`{"Roles": ["support"]}`)},
+	}}, true, validateTestRequest)
+	if err != nil {
+		t.Fatalf("BulkUpdateUsers() error = %v", err)
+	}
+	if response.Results[0].Status != models.BulkUpdated {
+		t.Errorf("Expected the role change to be applied, got %+v", response.Results[0])
+	}
+	if stored, _ := service.GetUserByID(ctx, ana.UUID); !models.SameRoles(stored.GetRoles(), []models.Role{models.RoleSupport}) {
+		t.Errorf("Expected Ana to be support, got %v", stored.Roles)
+	}
+}
+
+func TestServiceBulkUpdateAndDeleteUsers(t *testing.T) {
+	mockRepo := NewMockUserRepository()
+	auditRepo := NewMockAuditRepository()
+	service := services.NewUserService(mockRepo, newTestAuditService(auditRepo), newTestConfig())
+	ctx := reqctx.WithActor(context.Background(), "admin-id")
+
+	ana, _ := service.CreateUser(ctx, models.CreateUserRequest{Name: "Ana", Email: "ana@example.com", Age: 25})
+	luis, _ := service.CreateUser(ctx, models.CreateUserRequest{Name: "Luis", Email: "luis@example.com", Age: 35})
+	marta, _ := service.CreateUser(ctx, models.CreateUserRequest{Name: "Marta", Email: "marta@example.com", Age: 45})
+	staleVersion := int64(99)
+
+	response, err := service.BulkUpdateUsers(ctx, models.BulkUpdateRequest{Users: []models.BulkUpdateItem{
+		{ID: ana.ID.Hex(), Changes: json.RawMessage(`{"age": 26}`)},
+		{ID: luis.UUID, Version: &staleVersion, Changes: json.RawMessage(`{"age": 36}`)},
+		{ID: "not-an-id", Changes: json.RawMessage(`{"age": 1}`)},
+		{ID: primitive.NewObjectID().Hex(), Changes: json.RawMessage(`{"age": 1}`)},
+		{ID: marta.ID.Hex(), Changes: json.RawMessage(`{"email": "ana@example.com"}`)},
+		{ID: ana.UUID, Changes: json.RawMessage(`{"age": 27}`)},
+	}}, true, validateTestRequest)
+	if err != nil {
+		t.Fatalf("BulkUpdateUsers() error = %v", err)
+	}
+	want := []models.BulkItemStatus{models.BulkUpdated, models.BulkConflict, models.BulkInvalid, models.BulkNotFound, models.BulkConflict, models.BulkInvalid}
+	for i, status := range want {
+		if response.Results[i].Status != status {
+			t.Errorf("Item %d: expected %s, got %+v", i, status, response.Results[i])
+		}
+	}
+	if updated, _ := service.GetUserByID(ctx, ana.UUID); updated.Age != 26 || updated.Version != 2 {
+		t.Errorf("Expected Ana to be updated to version 2, got %+v", updated)
+	}
+
+	response, err = service.BulkDeleteUsers(ctx, models.BulkDeleteRequest{IDs: []string{ana.UUID, luis.ID.Hex(), luis.ID.Hex()}})
+	if err != nil {
+		t.Fatalf("BulkDeleteUsers() error = %v", err)
+	}
+	if response.Succeeded != 2 || response.Results[2].Status != models.BulkInvalid {
+		t.Errorf("Expected two deletions and the repeated ID to be rejected, got %+v", response.Results)
+	}
+	trash, _ := service.GetDeletedUsers(ctx, models.UserListQuery{})
+	if len(trash.Users) != 2 || trash.Users[0].DeletedBy != "admin-id" {
+		t.Errorf("Expected both users in the trash, got %+v", trash.Users)
+	}
+
+	// Cada cambio aplicado queda en la auditoría
+	deletions, _ := auditRepo.Count(ctx, models.AuditFilter{Action: models.AuditUserDeleted})
+	updates, _ := auditRepo.Count(ctx, models.AuditFilter{Action: models.AuditUserUpdated})
+	if deletions != 2 || updates != 1 {
+		t.Errorf("Expected 2 deletion and 1 update audit events, got %d and %d", deletions, updates)
+	}
+}
+
+func TestServiceImportUsers(t *testing.T) {
+	mockRepo := NewMockUserRepository()
+	userService := services.NewUserService(mockRepo, newTestAuditService(NewMockAuditRepository()), newTestConfig())
+	importService := services.NewImportService(NewMockImportRepository(), userService, newTestConfig())
+	ctx := context.Background()
+	userService.CreateUser(ctx, models.CreateUserRequest{Name: "Existing", Email: "taken@example.com", Age: 30})
+
+	csvFile := "Nombre;Correo;age;Notas\n" +
+		"Ana;ana@example.com;25;ok\n" +
+		"Luis;not-an-email;35;bad email\n" +
+		"Marta;marta@example.com;abc;bad age\n" +
+		"Taken;TAKEN@example.com;40;duplicate\n" +
+		"Ana again;Ana@Example.com;26;duplicate in file\n" +
+		"Broken;row\n"
+	opts := models.ImportOptions{
+		Format:    models.ImportCSV,
+		Delimiter: ';',
+		Mapping:   map[string]string{"Nombre": "name", "Correo": "email"},
+	}
+	lines := func(result *models.ImportResult) []int {
+		var rejectedLines []int
+		for _, rejection := range result.Rejections {
+			rejectedLines = append(rejectedLines, rejection.Line)
+		}
+		return rejectedLines
+	}
+
+	// Dry run: informa los errores por línea sin crear nada
+	dryRun := opts
+	dryRun.DryRun = true
+	result, err := importService.ImportUsers(ctx, strings.NewReader(csvFile), int64(len(csvFile)), dryRun, validateTestRequest)
+	if err != nil {
+		t.Fatalf("ImportUsers() error = %v", err)
+	}
+	if result.Processed != 6 || result.Created != 1 || result.Rejected != 5 {
+		t.Errorf("Expected 6 processed, 1 valid and 5 rejected rows, got %+v", result.ImportStats)
+	}
+	if want := []int{3, 4, 5, 6, 7}; !reflect.DeepEqual(lines(result), want) {
+		t.Errorf("Expected rejected lines %v, got %v", want, lines(result))
+	}
+	if exists, _ := mockRepo.ExistsByEmail(ctx, "ana@example.com"); exists {
+		t.Error("Expected dry run not to create users")
+	}
+	if rejection := result.Rejections[0]; rejection.Errors[0].Field != "email" || rejection.Record[3] != "bad email" {
+		t.Errorf("Expected the email error and the original record, got %+v", rejection)
+	}
+
+	// Importación real
+	result, err = importService.ImportUsers(ctx, strings.NewReader(csvFile), int64(len(csvFile)), opts, validateTestRequest)
+	if err != nil {
+		t.Fatalf("ImportUsers() error = %v", err)
+	}
+	if result.Created != 1 || result.Rejected != 5 {
+		t.Errorf("Expected 1 created and 5 rejected rows, got %+v", result.ImportStats)
+	}
+	if user, err := userService.GetUserByEmail(ctx, "ana@example.com"); err != nil || user.Age != 25 {
+		t.Errorf("Expected Ana to be imported, got %+v, %v", user, err)
+	}
+
+	// NDJSON, con roles rechazados si no se pueden asignar
+	ndjsonFile := `{"name": "Pedro", "email": "pedro@example.com", "age": 50}` + "\n\n" +
+		`{"name": "Root", "email": "root@example.com", "age": 50, "roles": ["admin"]}` + "\n" +
+		`{"name": "Typo", "email": "typo@example.com", "age": "50"}` + "\n" +
+		`not json`
+	result, err = importService.ImportUsers(ctx, strings.NewReader(ndjsonFile), int64(len(ndjsonFile)), models.ImportOptions{Format: models.ImportNDJSON}, validateTestRequest)
+	if err != nil {
+		t.Fatalf("ImportUsers() error = %v", err)
+	}
+	if result.Created != 1 || !reflect.DeepEqual(lines(result), []int{3, 4, 5}) {
+		t.Errorf("Expected Pedro to be created and lines 3-5 rejected, got %+v", result)
+	}
+	if result.Rejections[1].Errors[0].Field != "age" {
+		t.Errorf("Expected a type error on age, got %+v", result.Rejections[1])
+	}
+
+	// Errores de cabecera y tamaño
+	_, err = importService.ImportUsers(ctx, strings.NewReader("name,phone\nAna,123\n"), 20, models.ImportOptions{Format: models.ImportCSV, Delimiter: ','}, validateTestRequest)
+	if !errors.Is(err, models.ErrValidation) {
+		t.Errorf("Expected validation error for missing columns, got %v", err)
+	}
+	_, err = importService.ImportUsers(ctx, strings.NewReader(""), newTestConfig().ImportSyncMaxBytes+1, opts, validateTestRequest)
+	if !errors.Is(err, models.ErrFileTooLarge) {
+		t.Errorf("Expected ErrFileTooLarge above the synchronous limit, got %v", err)
+	}
+}
+
+func TestServiceImportUsersAsync(t *testing.T) {
+	mockRepo := NewMockUserRepository()
+	userService := services.NewUserService(mockRepo, newTestAuditService(NewMockAuditRepository()), newTestConfig())
+	importService := services.NewImportService(NewMockImportRepository(), userService, newTestConfig())
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go importService.Run(jobsCtx)
+
+	// Más filas que el tamaño de lote para que la importación avance en varios lotes
+	var file strings.Builder
+	file.WriteString("name,email,age\n")
+	for i := 0; i < 120; i++ {
+		fmt.Fprintf(&file, "User %d,user%d@example.com,%d\n", i, i, 20+i%50)
+	}
+	file.WriteString("Invalid,invalid,0\n")
+
+	ctx := reqctx.WithActor(context.Background(), "admin-id")
+	opts := models.ImportOptions{Format: models.ImportCSV, Delimiter: ','}
+	job, err := importService.StartImport(ctx, strings.NewReader(file.String()), int64(file.Len()), opts, validateTestRequest)
+	if err != nil {
+		t.Fatalf("StartImport() error = %v", err)
+	}
+	if job.Status != models.ImportPending || job.CreatedBy != "admin-id" {
+		t.Errorf("Expected a pending job created by the actor, got %+v", job)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != models.ImportCompleted && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		job, _ = importService.GetImportJob(ctx, job.ID.Hex())
+	}
+	if job.Status != models.ImportCompleted || job.Processed != 121 || job.Created != 120 || job.Rejected != 1 {
+		t.Fatalf("Expected a completed job with 120 created and 1 rejected rows, got %+v", job)
+	}
+	if count, _ := mockRepo.Count(ctx, models.UserFilter{}); count != 120 {
+		t.Errorf("Expected 120 imported users, got %d", count)
+	}
+
+	var report strings.Builder
+	if err := importService.WriteRejections(ctx, job, &report); err != nil {
+		t.Fatalf("WriteRejections() error = %v", err)
+	}
+	want := "line,error,name,email,age\n122,age must be between 1 and 120,Invalid,invalid,0\n"
+	if report.String() != want {
+		t.Errorf("Expected report %q, got %q", want, report.String())
+	}
+
+	// Una cabecera sin las columnas obligatorias se rechaza sin crear el job
+	if _, err := importService.StartImport(ctx, strings.NewReader("nombre\nAna\n"), 10, opts, validateTestRequest); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("Expected validation error for an invalid header, got %v", err)
+	}
+}
+
+func TestServiceExportUsers(t *testing.T) {
+	mockRepo := NewMockUserRepository()
+	userService := services.NewUserService(mockRepo, newTestAuditService(NewMockAuditRepository()), newTestConfig())
+	ctx := context.Background()
+	userService.CreateUser(ctx, models.CreateUserRequest{Name: "=HYPERLINK(\"http://evil\")", Email: "ana@example.com", Age: 25, Phone: "+34 600-000-000"})
+	userService.CreateUser(ctx, models.CreateUserRequest{Name: "Luis <&>", Email: "luis@example.com", Age: 35, Address: "Calle 1, 2º"})
+
+	export := func(query models.UserExportQuery, maskPII bool) string {
+		t.Helper()
+		prepared, err := userService.PrepareUserExport(ctx, query)
+		if err != nil {
+			t.Fatalf("PrepareUserExport() error = %v", err)
+		}
+		prepared.MaskPII = maskPII
+
+		var buf strings.Builder
+		if err := userService.ExportUsers(ctx, prepared, &buf); err != nil {
+			t.Fatalf("ExportUsers() error = %v", err)
+		}
+		return buf.String()
+	}
+
+	// CSV con columnas seleccionadas, del más reciente al más antiguo, fórmulas escapadas y teléfonos intactos
+	got := export(models.UserExportQuery{Columns: "name,phone,age"}, false)
+	want := "name,phone,age\nLuis <&>,,35\n\"'=HYPERLINK(\"\"http://evil\"\")\",+34 600-000-000,25\n"
+	if got != want {
+		t.Errorf("Unexpected CSV export:\n%s\nwant:\n%s", got, want)
+	}
+
+	// NDJSON con datos personales ocultos y filtros del listado
+	minAge := 30
+	got = export(models.UserExportQuery{Format: "ndjson", Columns: "email,address", MinAge: &minAge}, true)
+	want = fmt.Sprintf(`{"email":%q,"address":%q}`, models.MaskEmail("luis@example.com"), models.MaskAddress("Calle 1, 2º")) + "\n"
+	if got != want {
+		t.Errorf("Unexpected NDJSON export: %s, want %s", got, want)
+	}
+
+	// XLSX: un zip con la hoja y el texto escapado como XML
+	got = export(models.UserExportQuery{Format: "xlsx", Columns: "name,age"}, false)
+	archive, err := zip.NewReader(strings.NewReader(got), int64(len(got)))
+	if err != nil {
+		t.Fatalf("Expected a zip archive, got error %v", err)
+	}
+	var sheet string
+	for _, file := range archive.File {
+		if file.Name == "xl/worksheets/sheet1.xml" {
+			content, _ := file.Open()
+			data, _ := io.ReadAll(content)
+			sheet = string(data)
+		}
+	}
+	for _, cell := range []string{
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">name</t></is></c>`,
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">Luis &lt;&amp;&gt;</t></is></c>`,
+		`<c r="B3"><v>25</v></c>`,
+	} {
+		if !strings.Contains(sheet, cell) {
+			t.Errorf("Expected the sheet to contain %s, got %s", cell, sheet)
+		}
+	}
+
+	// Parámetros inválidos
+	if _, err := userService.PrepareUserExport(ctx, models.UserExportQuery{Columns: "name,password"}); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("Expected validation error for an unknown column, got %v", err)
+	}
+	if _, err := userService.PrepareUserExport(ctx, models.UserExportQuery{Sort: "password"}); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("Expected validation error for an invalid sort, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MongoMonitor retorna un monitor de comandos para el cliente de MongoDB que crea un span de
+// cliente por cada comando, hijo del span del contexto de la operación (ej. "find users").
+// No se registra el comando en sí porque sus filtros y documentos contienen datos personales.
+func MongoMonitor() *event.CommandMonitor {
+	// Los spans en curso se indexan por el RequestID del driver, único en todo el cliente
+	var spans sync.Map
+
+	finish := func(requestID int64, failure string) {
+		value, ok := spans.LoadAndDelete(requestID)
+		if !ok {
+			return
+		}
+		span := value.(trace.Span)
+		if failure != "" {
+			span.SetStatus(codes.Error, failure)
+		}
+		span.End()
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			attrs := []attribute.KeyValue{
+				semconv.DBSystemMongoDB,
+				semconv.DBNamespace(evt.DatabaseName),
+				semconv.DBOperationName(evt.CommandName),
+			}
+			name := evt.CommandName
+			if collection, ok := evt.Command.Lookup(evt.CommandName).StringValueOK(); ok {
+				attrs = append(attrs, semconv.DBCollectionName(collection))
+				name += " " + collection
+			}
+			attrs = append(attrs, serverAttributes(evt.ConnectionID)...)
+
+			_, span := Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+			spans.Store(evt.RequestID, span)
+		},
+		Succeeded: func(_ context.Context, evt *event.CommandSucceededEvent) {
+			finish(evt.RequestID, "")
+		},
+		Failed: func(_ context.Context, evt *event.CommandFailedEvent) {
+			finish(evt.RequestID, evt.Failure)
+		},
+	}
+}
+
+// serverAttributes extrae la dirección del servidor del ConnectionID del driver ("host:puerto[-n]")
+func serverAttributes(connectionID string) []attribute.KeyValue {
+	if i := strings.LastIndex(connectionID, "-"); i > strings.LastIndex(connectionID, ":") {
+		connectionID = connectionID[:i]
+	}
+	host, portText, err := net.SplitHostPort(connectionID)
+	if err != nil {
+		return nil
+	}
+	attrs := []attribute.KeyValue{semconv.ServerAddress(host)}
+	if port, err := strconv.Atoi(portText); err == nil {
+		attrs = append(attrs, semconv.ServerPort(port))
+	}
+	return attrs
+}
@@ -0,0 +1,135 @@
+// Package tracing configura las trazas de OpenTelemetry: el exportador (OTLP o archivo), la
+// propagación W3C Trace Context y los spans de la aplicación y de los comandos de MongoDB.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"go-users-api/models"
+)
+
+// ServiceName identifica a la aplicación en las trazas
+const ServiceName = "go-users-api"
+
+// Exportadores soportados
+const (
+	ExporterNone   = "none"   // Sin exportador: solo se propaga el contexto de traza recibido
+	ExporterOTLP   = "otlp"   // OTLP sobre HTTP hacia un collector
+	ExporterStdout = "stdout" // JSON en la salida estándar o en un archivo, sin collector
+)
+
+// Options configura el exportador de trazas
+type Options struct {
+	Exporter string
+	Endpoint string // URL del collector OTLP (ej. http://otel-collector:4318); vacío usa OTEL_EXPORTER_OTLP_ENDPOINT
+	File     string // Archivo del exportador stdout; vacío escribe en la salida estándar
+}
+
+// Setup instala el proveedor de trazas global con el exportador indicado y la propagación W3C.
+// Retorna la función que vacía los spans pendientes y cierra el exportador al apagar el servidor.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	closeFile := func() error { return nil }
+	switch opts.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var clientOptions []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			clientOptions = append(clientOptions, otlptracehttp.WithEndpointURL(opts.Endpoint))
+		}
+		var err error
+		if exporter, err = otlptracehttp.New(ctx, clientOptions...); err != nil {
+			return nil, err
+		}
+	case ExporterStdout:
+		var w io.Writer = os.Stdout
+		if opts.File != "" {
+			file, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+			if err != nil {
+				return nil, err
+			}
+			w, closeFile = file, file.Close
+		}
+		var err error
+		if exporter, err = stdouttrace.New(stdouttrace.WithWriter(w)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q, use none, otlp or stdout", opts.Exporter)
+	}
+
+	provider := NewProvider(exporter)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeErr := closeFile(); err == nil {
+			err = closeErr
+		}
+		return err
+	}, nil
+}
+
+// NewProvider crea un proveedor de trazas que envía los spans al exportador en lotes. Se respeta
+// la decisión de muestreo del servicio que llama; sin traza de origen se muestrea todo.
+func NewProvider(exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	)
+}
+
+// Tracer retorna el tracer de la aplicación del proveedor global; se obtiene en cada llamada
+// para que los tests puedan instalar su propio proveedor
+func Tracer() trace.Tracer {
+	return otel.Tracer(ServiceName)
+}
+
+// Start inicia un span interno hijo del span del contexto
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End termina el span registrando el error si lo hay. Se usa con defer y el error nombrado del
+// método. Los errores esperados (un usuario inexistente, un conflicto) se registran como evento
+// pero no marcan el span como fallido.
+func End(span trace.Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+		if !models.IsExpected(*err) {
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+	}
+	span.End()
+}
+
+// TraceParent retorna la cabecera traceparent W3C del span del contexto, o "" si no hay un span válido
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// ContextWithTraceParent retorna un contexto cuyo span padre es el de la cabecera traceparent
+// indicada. Permite continuar la traza de una petición en una tarea en segundo plano.
+func ContextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{"traceparent": traceParent})
+}